@@ -5,9 +5,11 @@ go 1.23.0
 toolchain go1.23.2
 
 require (
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/handlers v1.5.2
 	github.com/gorilla/mux v1.8.1
 	github.com/jackc/pgx/v5 v5.5.3
+	github.com/robfig/cron/v3 v3.0.1
 )
 
 require (
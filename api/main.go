@@ -45,12 +45,21 @@ func main() {
 
 	apiRouter := mainRouter.PathPrefix("/api/v1").Subrouter()
 
-	workflowService, err := workflow.NewService(db.GetPool())
+	mailer, err := workflow.NewMailerFromEnv()
+	if err != nil {
+		slog.Error("Failed to configure mailer", "error", err)
+		return
+	}
+
+	workflowService, err := workflow.NewService(db.GetPool(), workflow.WithMailer(mailer))
 	if err != nil {
 		slog.Error("Failed to create workflow service", "error", err)
 		return
 	}
 
+	workflowService.Start(ctx)
+	defer workflowService.Close()
+
 	workflowService.LoadRoutes(apiRouter, false)
 
 	// Configure CORS
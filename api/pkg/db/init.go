@@ -27,6 +27,117 @@ func InitDatabase(ctx context.Context, pool *pgxpool.Pool) error {
 		
 		-- Create index on updated_at for sorting
 		CREATE INDEX IF NOT EXISTS idx_workflows_updated_at ON workflows (updated_at DESC);
+
+		-- The current revision of each workflow
+		ALTER TABLE workflows ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0;
+
+		-- Every save of a workflow creates a new immutable revision
+		CREATE TABLE IF NOT EXISTS workflow_versions (
+			workflow_id UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+			version INTEGER NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			definition JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (workflow_id, version)
+		);
+
+		-- Workflows saved before versioning existed become revision 1
+		INSERT INTO workflow_versions (workflow_id, version, name, definition, created_at)
+			SELECT id, 1, name, definition, updated_at FROM workflows WHERE version = 0
+			ON CONFLICT DO NOTHING;
+		UPDATE workflows SET version = 1 WHERE version = 0;
+
+		-- Every workflow run, with a snapshot of the definition and inputs it ran with
+		CREATE TABLE IF NOT EXISTS workflow_executions (
+			id UUID PRIMARY KEY,
+			workflow_id UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+			workflow_version INTEGER NOT NULL DEFAULT 0,
+			definition JSONB NOT NULL,
+			inputs JSONB NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			finished_at TIMESTAMP WITH TIME ZONE
+		);
+
+		-- Executions recorded before versioning existed have no revision
+		ALTER TABLE workflow_executions ADD COLUMN IF NOT EXISTS workflow_version INTEGER NOT NULL DEFAULT 0;
+
+		-- Create index for listing the executions of a workflow, most recent first
+		CREATE INDEX IF NOT EXISTS idx_workflow_executions_workflow_id ON workflow_executions (workflow_id, started_at DESC);
+
+		-- Runs stopped at a waiting node keep the state to resume them from, and when
+		-- their wait expires, if it does
+		ALTER TABLE workflow_executions ADD COLUMN IF NOT EXISTS state JSONB;
+		ALTER TABLE workflow_executions ADD COLUMN IF NOT EXISTS resume_at TIMESTAMP WITH TIME ZONE;
+
+		-- Create index for finding the waiting runs whose wait has expired
+		CREATE INDEX IF NOT EXISTS idx_workflow_executions_resume_at ON workflow_executions (resume_at) WHERE status = 'waiting';
+
+		-- Runs started by a subworkflow node, and how deeply they are nested. The parent is
+		-- not a foreign key, synchronous runs are only recorded once they finish
+		ALTER TABLE workflow_executions ADD COLUMN IF NOT EXISTS parent_id UUID;
+		ALTER TABLE workflow_executions ADD COLUMN IF NOT EXISTS depth INTEGER NOT NULL DEFAULT 0;
+
+		-- Asynchronous runs waiting for a worker, or leased to one. A run whose lease
+		-- expires without a heartbeat is claimed again by another worker
+		CREATE TABLE IF NOT EXISTS execution_queue (
+			execution_id UUID PRIMARY KEY REFERENCES workflow_executions (id) ON DELETE CASCADE,
+			enqueued_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			attempts INTEGER NOT NULL DEFAULT 0,
+			lease_owner TEXT,
+			lease_expires_at TIMESTAMP WITH TIME ZONE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_execution_queue_enqueued_at ON execution_queue (enqueued_at);
+
+		-- Schedules that run workflows periodically
+		CREATE TABLE IF NOT EXISTS schedules (
+			id UUID PRIMARY KEY,
+			workflow_id UUID NOT NULL REFERENCES workflows (id) ON DELETE CASCADE,
+			cron_expression TEXT NOT NULL,
+			timezone TEXT NOT NULL DEFAULT 'UTC',
+			form_data JSONB,
+			condition JSONB,
+			missed_fire_policy VARCHAR(32) NOT NULL DEFAULT 'skip',
+			paused BOOLEAN NOT NULL DEFAULT FALSE,
+			next_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			last_run_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+
+		-- Create index for finding the schedules that are due
+		CREATE INDEX IF NOT EXISTS idx_schedules_next_run_at ON schedules (next_run_at) WHERE NOT paused;
+
+		-- The inbound URLs of workflows started by webhooks, one per workflow
+		CREATE TABLE IF NOT EXISTS webhooks (
+			workflow_id UUID PRIMARY KEY REFERENCES workflows (id) ON DELETE CASCADE,
+			token TEXT NOT NULL UNIQUE,
+			secret TEXT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+
+		-- The steps of each run, in the order they were recorded
+		CREATE TABLE IF NOT EXISTS execution_steps (
+			execution_id UUID NOT NULL REFERENCES workflow_executions (id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			node_id VARCHAR(255) NOT NULL,
+			node_type VARCHAR(64) NOT NULL,
+			label TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			status VARCHAR(32) NOT NULL,
+			branch TEXT NOT NULL DEFAULT '',
+			iteration INTEGER NOT NULL DEFAULT 0,
+			source_handle VARCHAR(255) NOT NULL DEFAULT '',
+			output JSONB,
+			error TEXT NOT NULL DEFAULT '',
+			started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			duration_ms BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (execution_id, position)
+		);
+
+		-- Steps recorded before loops existed never ran more than once
+		ALTER TABLE execution_steps ADD COLUMN IF NOT EXISTS iteration INTEGER NOT NULL DEFAULT 0;
 	`
 
 	if _, err := pool.Exec(ctx, createTableSQL); err != nil {
@@ -46,7 +157,44 @@ func InitDatabase(ctx context.Context, pool *pgxpool.Pool) error {
 func seedSampleWorkflow(ctx context.Context, pool *pgxpool.Pool) error {
 	slog.Info("Seeding sample workflow...")
 
-	workflowDef := workflow.WorkflowGraph{
+	definitionJSON, err := json.Marshal(sampleWorkflowDefinition())
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO workflows (id, name, definition, version) VALUES ($1, $2, $3, 1) ON CONFLICT (id) DO NOTHING`
+	_, err = pool.Exec(ctx, query, "550e8400-e29b-41d4-a716-446655440000", "Weather Alert Workflow", definitionJSON)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO workflow_versions (workflow_id, version, name, definition) VALUES ($1, 1, $2, $3) ON CONFLICT DO NOTHING`
+	_, err = pool.Exec(ctx, query, "550e8400-e29b-41d4-a716-446655440000", "Weather Alert Workflow", definitionJSON)
+	if err != nil {
+		return err
+	}
+
+	// Databases seeded before email templates were rendered alert with the raw temperature,
+	// move them to a revision that formats it to one decimal like the default template
+	query = `WITH updated AS (
+			UPDATE workflows SET definition = replace(definition::text, $2, $3)::jsonb, version = version + 1, updated_at = NOW()
+			WHERE id = $1 AND strpos(definition::text, $2) > 0
+			RETURNING id, version, name, definition
+		)
+		INSERT INTO workflow_versions (workflow_id, version, name, definition) SELECT id, version, name, definition FROM updated`
+	_, err = pool.Exec(ctx, query, "550e8400-e29b-41d4-a716-446655440000",
+		"Temperature is {{temperature}}°C!", "Temperature is {{temperature | number(1)}}°C!")
+	if err != nil {
+		return err
+	}
+
+	slog.Info("✅ Sample workflow seeded successfully")
+	return nil
+}
+
+// The definition of the seeded weather alert workflow
+func sampleWorkflowDefinition() workflow.WorkflowGraph {
+	return workflow.WorkflowGraph{
 		ID: "550e8400-e29b-41d4-a716-446655440000",
 		Nodes: []workflow.Node{
 			{
@@ -94,7 +242,7 @@ func seedSampleWorkflow(ctx context.Context, pool *pgxpool.Pool) error {
 							"target": true,
 						},
 						"inputVariables": []string{"city"},
-						"apiEndpoint":    "https://api.open-meteo.com/v1/forecast?latitude={lat}&longitude={lon}&current_weather=true",
+						"apiEndpoint":    "https://api.open-meteo.com/v1/forecast?latitude={{lat}}&longitude={{lon}}&current_weather=true",
 						"options": []map[string]interface{}{
 							{"city": "Sydney", "lat": -33.8688, "lon": 151.2093},
 							{"city": "Melbourne", "lat": -37.8136, "lon": 144.9631},
@@ -138,7 +286,29 @@ func seedSampleWorkflow(ctx context.Context, pool *pgxpool.Pool) error {
 						"inputVariables": []string{"name", "city", "temperature"},
 						"emailTemplate": map[string]interface{}{
 							"subject": "Weather Alert",
-							"body":    "Weather alert for {{city}}! Temperature is {{temperature}}°C!",
+							"body":    "Weather alert for {{city}}! Temperature is {{temperature | number(1)}}°C!",
+						},
+						"outputVariables": []string{"emailSent"},
+					},
+				},
+			},
+			{
+				ID:       "notify-ops",
+				Type:     "email",
+				Position: workflow.Position{X: 794, Y: 520},
+				Data: workflow.NodeData{
+					Label:       "Notify Ops",
+					Description: "Email ops when the weather API is down",
+					Metadata: map[string]interface{}{
+						"hasHandles": map[string]interface{}{
+							"source": true,
+							"target": true,
+						},
+						"inputVariables": []string{"city", "errorMessage"},
+						"emailTemplate": map[string]interface{}{
+							"to":      "ops@example.com",
+							"subject": "Weather API unavailable",
+							"body":    "Could not fetch the weather for {{city}}: {{errorMessage}}",
 						},
 						"outputVariables": []string{"emailSent"},
 					},
@@ -196,20 +366,18 @@ func seedSampleWorkflow(ctx context.Context, pool *pgxpool.Pool) error {
 				Label:      "Alert Sent",
 				LabelStyle: map[string]interface{}{"fill": "#ef4444", "fontWeight": "bold"},
 			},
+			{
+				ID: "e7", Source: "weather-api", Target: "notify-ops", Type: "smoothstep", Animated: true,
+				SourceHandle: workflow.ErrorHandle,
+				Style:        map[string]interface{}{"stroke": "#ef4444", "strokeWidth": 2},
+				Label:        "API Down",
+				LabelStyle:   map[string]interface{}{"fill": "#ef4444", "fontWeight": "bold"},
+			},
+			{
+				ID: "e8", Source: "notify-ops", Target: "end", Type: "smoothstep", Animated: true,
+				Style: map[string]interface{}{"stroke": "#6b7280", "strokeWidth": 2},
+				Label: "Ops Notified",
+			},
 		},
 	}
-
-	definitionJSON, err := json.Marshal(workflowDef)
-	if err != nil {
-		return err
-	}
-
-	query := `INSERT INTO workflows (id, name, definition) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING`
-	_, err = pool.Exec(ctx, query, "550e8400-e29b-41d4-a716-446655440000", "Weather Alert Workflow", definitionJSON)
-	if err != nil {
-		return err
-	}
-
-	slog.Info("✅ Sample workflow seeded successfully")
-	return nil
 }
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+
+	"workflow-code-test/api/services/workflow"
+)
+
+func TestSampleWorkflowIsValid(t *testing.T) {
+	// Validate the definition as it is loaded back from the database
+	data, err := json.Marshal(sampleWorkflowDefinition())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var graph workflow.WorkflowGraph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result := workflow.Validate(graph)
+	if !result.Valid || len(result.Diagnostics) != 0 {
+		t.Errorf("Expected the seeded workflow to be valid without warnings, got %+v", result.Diagnostics)
+	}
+}
+
+func TestSampleWorkflowFormatsTemperature(t *testing.T) {
+	for _, node := range sampleWorkflowDefinition().Nodes {
+		if node.ID != "email" {
+			continue
+		}
+		template := node.Data.Metadata["emailTemplate"].(map[string]interface{})
+		body, err := workflow.RenderTemplate(template["body"].(string), map[string]interface{}{"city": "Sydney", "temperature": 18.0})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if body != "Weather alert for Sydney! Temperature is 18.0°C!" {
+			t.Errorf("Expected the temperature to one decimal, got %q", body)
+		}
+		return
+	}
+	t.Fatal("Expected the sample workflow to have an email node")
+}
@@ -0,0 +1,26 @@
+// Package pgtx runs functions in Postgres transactions. It is kept apart from package db,
+// which seeds the database with workflows, so the workflow service can use it too.
+package pgtx
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WithTransaction runs fn in a transaction on the pool, committing if it succeeds and
+// rolling back if it fails
+func WithTransaction(ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
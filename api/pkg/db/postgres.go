@@ -9,6 +9,8 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/db/pgtx"
 )
 
 var (
@@ -79,15 +81,5 @@ func HealthCheck(ctx context.Context) error {
 }
 
 func WithTransaction(ctx context.Context, fn func(tx pgx.Tx) error) error {
-	tx, err := pool.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback(ctx)
-
-	if err := fn(tx); err != nil {
-		return err
-	}
-
-	return tx.Commit(ctx)
+	return pgtx.WithTransaction(ctx, pool, fn)
 }
@@ -0,0 +1,245 @@
+package workflow
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Output handles of approval nodes. The run waits at the node until someone approves or
+// rejects it, or continues through the timeout handle once the approval expires.
+const (
+	ApprovalApprovedHandle = "approved"
+	ApprovalRejectedHandle = "rejected"
+	ApprovalTimeoutHandle  = "timeout"
+)
+
+// The subject and message of the email sent to approvers, unless the node sets its own
+const (
+	defaultApprovalSubject = "Approval requested"
+	defaultApprovalMessage = "A workflow run is waiting for your approval."
+)
+
+// Errors deciding an approval, returned when the decision cannot be accepted
+var (
+	errNotAwaitingApproval = errors.New("execution is not waiting for an approval")
+	errApprovalExpired     = errors.New("approval has expired")
+	errNotApprover         = errors.New("approver is not allowed to decide this approval")
+	errApprovalToken       = errors.New("approval token is missing or invalid")
+	errNoApprovers         = errors.New("approvers are required unless allowAnyone is true")
+)
+
+// approvalConfig is read from the metadata of an approval node
+type approvalConfig struct {
+	// approvers are the email addresses, or {{placeholders}} for them, of the people who
+	// may decide
+	approvers []string
+	// allowAnyone lets anyone decide, without the token emailed to the approvers. The
+	// approvers are still notified if there are any
+	allowAnyone bool
+	subject     string
+	message     string
+	// expiresAfter is how long the approval waits for a decision, zero if it never expires
+	expiresAfter time.Duration
+	// resultVariable receives the decision
+	resultVariable string
+}
+
+func parseApprovalConfig(node *Node) (*approvalConfig, error) {
+	metadata := node.Data.Metadata
+	config := &approvalConfig{
+		subject:        defaultApprovalSubject,
+		message:        defaultApprovalMessage,
+		resultVariable: "approval",
+	}
+
+	if raw, ok := metadata["approvers"]; ok {
+		approvers, ok := toList(raw)
+		if !ok {
+			return nil, fmt.Errorf("approvers must be a list of email addresses")
+		}
+		for _, approver := range approvers {
+			value, ok := approver.(string)
+			if !ok || value == "" {
+				return nil, fmt.Errorf("approvers must be a list of email addresses")
+			}
+			config.approvers = append(config.approvers, value)
+		}
+	}
+
+	for key, target := range map[string]*string{
+		"subject":        &config.subject,
+		"message":        &config.message,
+		"resultVariable": &config.resultVariable,
+	} {
+		if raw, ok := metadata[key]; ok {
+			value, ok := raw.(string)
+			if !ok || value == "" {
+				return nil, fmt.Errorf("%s must be a non-empty string", key)
+			}
+			*target = value
+		}
+	}
+
+	if raw, ok := metadata["expiresAfter"]; ok && raw != nil {
+		expiresAfter, err := parseDurationValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("expiresAfter %w", err)
+		}
+		config.expiresAfter = expiresAfter
+	}
+
+	if raw, ok := metadata["allowAnyone"]; ok && raw != nil {
+		allowAnyone, ok := raw.(bool)
+		if !ok {
+			return nil, fmt.Errorf("allowAnyone must be a boolean")
+		}
+		config.allowAnyone = allowAnyone
+	}
+	if len(config.approvers) == 0 && !config.allowAnyone {
+		return nil, errNoApprovers
+	}
+
+	return config, nil
+}
+
+// Process the approval node, this emails the approvers and pauses the run until one of them
+// decides, through the approve and reject endpoints of the execution
+func (e *Executor) processApprovalNode(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	config, err := parseApprovalConfig(node)
+	if err != nil {
+		return err
+	}
+
+	approvers := make([]string, 0, len(config.approvers))
+	for _, approver := range config.approvers {
+		rendered, err := RenderTemplate(approver, wfVars)
+		if err != nil {
+			return fmt.Errorf("invalid approver: %w", err)
+		}
+		if rendered != "" {
+			approvers = append(approvers, rendered)
+		}
+	}
+	if len(approvers) == 0 && !config.allowAnyone {
+		return fmt.Errorf("no approvers to ask, every approver rendered empty")
+	}
+
+	subject, err := RenderTemplate(config.subject, wfVars)
+	if err != nil {
+		return fmt.Errorf("invalid approval subject: %w", err)
+	}
+	body, err := RenderTemplate(config.message, wfVars)
+	if err != nil {
+		return fmt.Errorf("invalid approval message: %w", err)
+	}
+
+	wait := &SuspendError{
+		TimeoutHandle: ApprovalTimeoutHandle,
+		TimeoutOutput: map[string]interface{}{"decision": "expired"},
+		Variable:      config.resultVariable,
+		Approvers:     approvers,
+	}
+
+	// Only the approvers are told the token needed to decide, and only its hash is kept with
+	// the run, so neither the approvers nor the token are shown with the run's steps
+	var token string
+	if !config.allowAnyone {
+		if token, err = randomToken(); err != nil {
+			return fmt.Errorf("failed to generate approval token: %w", err)
+		}
+		wait.TokenHash = hashApprovalToken(token)
+	}
+	if id := executionIDFrom(ctx); id != "" {
+		body += fmt.Sprintf("\n\nTo approve, POST to %s/approve\nTo reject, POST to %s/reject", executionURL(id), executionURL(id))
+		if token != "" {
+			body += fmt.Sprintf("\nwith the body {\"approver\": \"<your email address>\", \"token\": \"%s\"}", token)
+		}
+	}
+
+	step.Output = map[string]interface{}{
+		"notified": false,
+	}
+	if config.expiresAfter > 0 {
+		wait.Until = time.Now().Add(config.expiresAfter)
+		step.Output["expiresAt"] = wait.Until.UTC().Format(time.RFC3339)
+	}
+
+	if len(approvers) > 0 {
+		message := &EmailMessage{To: approvers, Subject: subject, Body: body}
+		if _, err := e.mailer.Send(ctx, message); err != nil {
+			return fmt.Errorf("failed to notify approvers: %w", err)
+		}
+		step.Output["notified"] = true
+	}
+
+	return wait
+}
+
+func hashApprovalToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ApprovalRequest is the body of a request to approve or reject a waiting run. The token is
+// the one emailed to the approvers, it is needed unless the node allows anyone to decide
+type ApprovalRequest struct {
+	Approver string `json:"approver"`
+	Token    string `json:"token"`
+	Comment  string `json:"comment"`
+}
+
+// Decide the approval a run is waiting at, setting the decision on the state the run is
+// resumed from. The decision is refused if the run is not waiting at an approval node, the
+// approval has expired, or the request is not from one of the approvers with the token they
+// were emailed, unless the node allows anyone to decide.
+func decideApproval(execution *Execution, handle string, req *ApprovalRequest, now time.Time) error {
+	state := execution.State
+	if execution.Status != "waiting" || state == nil {
+		return errNotAwaitingApproval
+	}
+	node := findNodeByID(execution.Definition.Nodes, state.NodeID)
+	if node == nil || node.Type != "approval" {
+		return errNotAwaitingApproval
+	}
+	if state.WaitUntil != nil && !now.Before(*state.WaitUntil) {
+		return errApprovalExpired
+	}
+
+	// The approvers are rendered when the node runs, and kept with the state along with the
+	// hash of their token
+	if config, err := parseApprovalConfig(node); err != nil || !config.allowAnyone {
+		hash := hashApprovalToken(strings.TrimSpace(req.Token))
+		if req.Token == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(state.TokenHash)) != 1 {
+			return errApprovalToken
+		}
+		allowed := false
+		for _, approver := range state.Approvers {
+			if strings.EqualFold(approver, strings.TrimSpace(req.Approver)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errNotApprover
+		}
+	}
+
+	decision := "approved"
+	if handle == ApprovalRejectedHandle {
+		decision = "rejected"
+	}
+	state.Handle = handle
+	state.Output = map[string]interface{}{
+		"decision":  decision,
+		"approver":  req.Approver,
+		"comment":   req.Comment,
+		"decidedAt": now.UTC().Format(time.RFC3339),
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A workflow that asks the manager to approve a shipment, and cancels it if they reject it
+// or do not decide in time
+func approvalWorkflow(metadata map[string]interface{}) *Workflow {
+	return &Workflow{ID: "550e8400-e29b-41d4-a716-446655440000", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			{ID: "approve", Type: "approval", Data: NodeData{Metadata: metadata}},
+			{ID: "ship", Type: "ship"},
+			{ID: "cancel", Type: "cancel"},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []Edge{
+			{ID: "e1", Source: "start", Target: "approve"},
+			{ID: "e2", Source: "approve", SourceHandle: ApprovalApprovedHandle, Target: "ship"},
+			{ID: "e3", Source: "approve", SourceHandle: ApprovalRejectedHandle, Target: "cancel"},
+			{ID: "e4", Source: "approve", SourceHandle: ApprovalTimeoutHandle, Target: "cancel"},
+			{ID: "e5", Source: "ship", Target: "end"},
+			{ID: "e6", Source: "cancel", Target: "end"},
+		},
+	}}
+}
+
+func approvalExecutor(mailer Mailer) *Executor {
+	executor := NewExecutor(WithMailer(mailer))
+	executor.RegisterNodeType("ship", setVarHandler(0, "shipped", true))
+	executor.RegisterNodeType("cancel", setVarHandler(0, "shipped", false))
+	return executor
+}
+
+func TestExecutor_Approval(t *testing.T) {
+	mailer := NewOutboxMailer("")
+	executor := approvalExecutor(mailer)
+	wf := approvalWorkflow(map[string]interface{}{
+		"approvers":    []interface{}{"{{manager}}"},
+		"subject":      "Ship order {{order}}?",
+		"expiresAfter": "1h",
+	})
+
+	if result := executor.Validate(wf.Definition); !result.Valid || len(result.Diagnostics) != 0 {
+		t.Fatalf("Expected the workflow to be valid, got %+v", result.Diagnostics)
+	}
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{"manager": "boss@example.com", "order": "A-1"})
+	if result.Status != "waiting" || len(result.Steps) != 2 {
+		t.Fatalf("Expected the run to wait at the approval, got %s: %+v", result.Status, result.Steps)
+	}
+	if step := result.Steps[1]; step.NodeID != "approve" || step.Status != "waiting" || step.Output["expiresAt"] == nil {
+		t.Errorf("Expected a waiting approval step, got %+v", step)
+	}
+
+	state := result.State
+	if state == nil || state.NodeID != "approve" || state.WaitUntil == nil || state.TimeoutHandle != ApprovalTimeoutHandle {
+		t.Fatalf("Expected the state to resume from, got %+v", state)
+	}
+	if until := time.Until(*state.WaitUntil); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("Expected the approval to expire in an hour, got %s", until)
+	}
+
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To[0] != "boss@example.com" || messages[0].Subject != "Ship order A-1?" {
+		t.Fatalf("Expected the manager to be asked, got %+v", messages)
+	}
+
+	// The run continues along the handle of the decision, from either decision
+	for handle, shipped := range map[string]bool{ApprovalApprovedHandle: true, ApprovalRejectedHandle: false} {
+		resumed := *state
+		resumed.Handle = handle
+		resumed.Output = map[string]interface{}{"decision": handle}
+
+		result := executor.Resume(context.Background(), wf, &resumed, nil)
+		if result.Status != "completed" {
+			t.Fatalf("Expected the %s run to complete, got %s: %+v", handle, result.Status, result.Steps)
+		}
+		var trace []string
+		for _, step := range result.Steps {
+			trace = append(trace, step.NodeID+":"+step.Status)
+		}
+		next := "ship"
+		if !shipped {
+			next = "cancel"
+		}
+		expected := []string{"approve:completed", next + ":completed", "end:completed"}
+		if !reflect.DeepEqual(trace, expected) {
+			t.Errorf("Expected steps %v, got %v", expected, trace)
+		}
+		if result.Steps[0].SourceHandle != handle || result.Variables["shipped"] != shipped {
+			t.Errorf("Expected the run to leave through %s, got %+v", handle, result.Steps[0])
+		}
+		if decision, _ := result.Variables["approval"].(map[string]interface{}); decision["decision"] != handle {
+			t.Errorf("Expected the decision in the approval variable, got %v", result.Variables["approval"])
+		}
+		if result.Variables["order"] != "A-1" {
+			t.Errorf("Expected the variables to be restored, got %v", result.Variables)
+		}
+	}
+}
+
+func TestExecutor_ApprovalInParallelBranch(t *testing.T) {
+	executor := approvalExecutor(NewOutboxMailer(""))
+	wf := &Workflow{ID: "parallel", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			{ID: "approve", Type: "approval", Data: NodeData{Metadata: map[string]interface{}{"allowAnyone": true}}},
+			{ID: "ship", Type: "ship"},
+			{ID: "join", Type: "join"},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []Edge{
+			{ID: "e1", Source: "start", Target: "approve"},
+			{ID: "e2", Source: "start", Target: "ship"},
+			{ID: "e3", Source: "approve", Target: "join"},
+			{ID: "e4", Source: "ship", Target: "join"},
+			{ID: "e5", Source: "join", Target: "end"},
+		},
+	}}
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "failed" || result.State != nil {
+		t.Fatalf("Expected the run to fail, got %s: %+v", result.Status, result.Steps)
+	}
+	for _, step := range result.Steps {
+		if step.NodeID == "approve" && !strings.Contains(step.Error, "cannot wait inside a parallel branch") {
+			t.Errorf("Expected the approval to fail, got %+v", step)
+		}
+	}
+}
+
+func TestService_Approval(t *testing.T) {
+	wf := approvalWorkflow(map[string]interface{}{"approvers": []interface{}{"boss@example.com"}})
+
+	mailer := NewOutboxMailer("")
+	service := NewServiceWithDependencies(NewMockRepository(wf), approvalExecutor(mailer))
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute?async=true", `{}`)
+	var queued struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &queued); err != nil || queued.ID == "" {
+		t.Fatalf("Expected a queued run, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	exec := waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "waiting"
+	})
+	if len(exec.Steps) != 2 || exec.FinishedAt != nil {
+		t.Errorf("Expected the run to wait at the approval, got %+v", exec)
+	}
+	messages := mailer.Messages()
+	if len(messages) != 1 || !strings.Contains(messages[0].Body, "/api/v1/executions/"+queued.ID+"/approve") {
+		t.Fatalf("Expected the approver to be told how to decide, got %+v", messages)
+	}
+	match := regexp.MustCompile(`"token": "([^"]+)"`).FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatalf("Expected the approver to be sent a token, got %s", messages[0].Body)
+	}
+	token := match[1]
+
+	// Neither the approvers nor the token are shown with the run's steps
+	rec = doRequest(router, "GET", "/api/v1/executions/"+queued.ID, "")
+	if exec.Steps[1].Output["approvers"] != nil || strings.Contains(rec.Body.String(), token) {
+		t.Errorf("Expected the approvers and token to be hidden, got %s", rec.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"approver": "intern@example.com", "token": "` + token + `"}`,
+		`{"approver": "boss@example.com"}`,
+		`{"approver": "boss@example.com", "token": "guess"}`,
+		"",
+	} {
+		rec = doRequest(router, "POST", "/api/v1/executions/"+queued.ID+"/approve", body)
+		if rec.Code != 403 {
+			t.Errorf("Expected %q to be forbidden, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec = doRequest(router, "POST", "/api/v1/executions/"+queued.ID+"/approve", `{"approver": "Boss@example.com", "token": "`+token+`", "comment": "Go ahead"}`)
+	if rec.Code != 202 || rec.Header().Get("Location") != "/api/v1/executions/"+queued.ID {
+		t.Fatalf("Expected the approval to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	exec = waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "completed"
+	})
+	var trace []string
+	for _, step := range exec.Steps {
+		trace = append(trace, step.NodeID+":"+step.Status)
+	}
+	expected := []string{"start:completed", "approve:waiting", "approve:completed", "ship:completed", "end:completed"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, trace)
+	}
+	if output := exec.Steps[2].Output; output["approver"] != "Boss@example.com" || output["comment"] != "Go ahead" {
+		t.Errorf("Expected the decision on the step, got %v", output)
+	}
+	if exec.FinishedAt == nil {
+		t.Errorf("Expected the run to be finished")
+	}
+
+	// Runs can only be decided once
+	rec = doRequest(router, "POST", "/api/v1/executions/"+queued.ID+"/reject", `{"approver": "boss@example.com"}`)
+	if rec.Code != 409 {
+		t.Errorf("Expected a conflict, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(router, "POST", "/api/v1/executions/unknown/approve", `{}`)
+	if rec.Code != 404 {
+		t.Errorf("Expected unknown runs to be not found, got %d", rec.Code)
+	}
+}
+
+func TestScheduler_ExpiresApprovals(t *testing.T) {
+	wf := approvalWorkflow(map[string]interface{}{"expiresAfter": "1m", "allowAnyone": true})
+	repo := NewMockRepository(wf)
+	service := NewServiceWithDependencies(repo, approvalExecutor(NewOutboxMailer("")))
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute?async=true", `{}`)
+	var queued struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &queued)
+	waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "waiting"
+	})
+
+	// Nothing has expired yet
+	if resumed, err := service.scheduler.expire(context.Background(), time.Now()); err != nil || resumed != 0 {
+		t.Fatalf("Expected no runs to expire, got %d: %v", resumed, err)
+	}
+
+	resumed, err := service.scheduler.expire(context.Background(), time.Now().Add(2*time.Minute))
+	if err != nil || resumed != 1 {
+		t.Fatalf("Expected the run to expire, got %d: %v", resumed, err)
+	}
+
+	exec := waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "completed"
+	})
+	decided := exec.Steps[2]
+	if decided.SourceHandle != ApprovalTimeoutHandle || decided.Output["decision"] != "expired" || exec.Steps[3].NodeID != "cancel" {
+		t.Errorf("Expected the run to continue through the timeout handle, got %+v", exec.Steps)
+	}
+
+	// Expired approvals cannot be decided
+	rec = doRequest(router, "POST", "/api/v1/executions/"+queued.ID+"/approve", `{}`)
+	if rec.Code != 409 {
+		t.Errorf("Expected a conflict, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestValidate_Approval(t *testing.T) {
+	executor := approvalExecutor(NewOutboxMailer(""))
+	wf := approvalWorkflow(map[string]interface{}{"expiresAfter": "soon"})
+	result := executor.Validate(wf.Definition)
+	if result.Valid || len(result.Diagnostics) != 1 || result.Diagnostics[0].Code != "invalid_metadata" {
+		t.Errorf("Expected invalid metadata, got %+v", result.Diagnostics)
+	}
+
+	// Approvals that expire need somewhere to go when they do
+	wf = approvalWorkflow(map[string]interface{}{"approvers": []interface{}{"boss@example.com"}, "expiresAfter": "1h"})
+	wf.Definition.Edges = append(wf.Definition.Edges[:3], wf.Definition.Edges[4:]...)
+	result = executor.Validate(wf.Definition)
+	if result.Valid || result.Diagnostics[0].Code != "missing_handle_edge" || !strings.Contains(result.Diagnostics[0].Message, "timeout") {
+		t.Errorf("Expected a missing timeout edge, got %+v", result.Diagnostics)
+	}
+
+	// Approvals that never expire do not
+	delete(wf.Definition.Nodes[1].Data.Metadata, "expiresAfter")
+	if result = executor.Validate(wf.Definition); !result.Valid {
+		t.Errorf("Expected the workflow to be valid, got %+v", result.Diagnostics)
+	}
+
+	// Approvals need approvers, unless they are explicitly open to anyone
+	wf = approvalWorkflow(map[string]interface{}{})
+	result = executor.Validate(wf.Definition)
+	if result.Valid || len(result.Diagnostics) != 1 || !strings.Contains(result.Diagnostics[0].Message, "allowAnyone") {
+		t.Errorf("Expected missing approvers, got %+v", result.Diagnostics)
+	}
+	wf = approvalWorkflow(map[string]interface{}{"allowAnyone": true})
+	result = executor.Validate(wf.Definition)
+	if !result.Valid || len(result.Diagnostics) != 1 || result.Diagnostics[0].Code != "open_approval" {
+		t.Errorf("Expected a warning for the open approval, got %+v", result.Diagnostics)
+	}
+}
+
+func TestDecideApproval_AllowAnyone(t *testing.T) {
+	now := time.Now()
+	waiting := func(metadata map[string]interface{}) *Execution {
+		return &Execution{
+			Status:     "waiting",
+			Definition: approvalWorkflow(metadata).Definition,
+			State:      &RunState{NodeID: "approve"},
+		}
+	}
+
+	// Open approvals are decided by anyone, without a token
+	exec := waiting(map[string]interface{}{"allowAnyone": true})
+	if err := decideApproval(exec, ApprovalApprovedHandle, &ApprovalRequest{Approver: "anyone@example.com"}, now); err != nil {
+		t.Errorf("Expected anyone to decide, got %v", err)
+	}
+	if exec.State.Handle != ApprovalApprovedHandle {
+		t.Errorf("Expected the decision on the state, got %+v", exec.State)
+	}
+
+	// Others always need the emailed token, even when no approvers were kept with the state
+	exec = waiting(map[string]interface{}{"approvers": []interface{}{"{{manager}}"}})
+	if err := decideApproval(exec, ApprovalApprovedHandle, &ApprovalRequest{Approver: "anyone@example.com"}, now); !errors.Is(err, errApprovalToken) {
+		t.Errorf("Expected a token to be required, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package workflow
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReexecutableHandler is implemented by node handlers that declare whether a node is safe
+// to run again when its run is resumed after being interrupted, e.g. by a crash or a deploy,
+// while the node may have been running. Handlers that do not implement it are assumed safe.
+type ReexecutableHandler interface {
+	NodeHandler
+	SafeToReexecute(node *Node) bool
+}
+
+type reexecutionHandler struct {
+	NodeHandler
+	safe func(node *Node) bool
+}
+
+func (h reexecutionHandler) SafeToReexecute(node *Node) bool {
+	return h.safe(node)
+}
+
+// DeclareReexecution wraps the handler, declaring whether each node it runs is safe to run
+// again after an interruption
+func DeclareReexecution(handler NodeHandler, safe func(node *Node) bool) NodeHandler {
+	return reexecutionHandler{NodeHandler: handler, safe: safe}
+}
+
+// NotReexecutable wraps the handler, declaring that no node it runs is safe to run again
+// after an interruption, e.g. because it sends something that must not be sent twice
+func NotReexecutable(handler NodeHandler) NodeHandler {
+	return DeclareReexecution(handler, func(node *Node) bool { return false })
+}
+
+// Whether the node may run again after its run was interrupted
+func (e *Executor) safeToReexecute(node *Node) bool {
+	handler, _ := e.nodeHandler(node.Type)
+	if reexecutable, ok := handler.(ReexecutableHandler); ok {
+		return reexecutable.SafeToReexecute(node)
+	}
+	return true
+}
+
+// The step of a node that is not run again because the run was interrupted while it may
+// have been running
+func interruptedStep(node *Node) ExecutionStep {
+	return ExecutionStep{
+		NodeID:      node.ID,
+		Type:        node.Type,
+		Label:       node.Data.Label,
+		Description: node.Data.Description,
+		Status:      "failed",
+		Error:       fmt.Sprintf("Node %s may have run before the run was interrupted, and is not safe to run again", node.ID),
+		StartedAt:   time.Now(),
+	}
+}
+
+// Take a copy of the state of the branch, stopped at the node
+func (run *execution) snapshot(b *branch, node *Node) *RunState {
+	state := &RunState{
+		NodeID:     node.ID,
+		Variables:  copyVars(b.vars),
+		Path:       append([]string{}, b.path...),
+		Visits:     make(map[string]int, len(b.visits)),
+		Iterations: make(map[string]int, len(b.iterations)),
+		Executed:   run.executed.Load(),
+	}
+	for k, v := range b.visits {
+		state.Visits[k] = v
+	}
+	for k, v := range b.iterations {
+		state.Iterations[k] = v
+	}
+	return state
+}
+
+// Attach a checkpoint to a step of the main branch, the state to resume the run from after
+// the step should the run be interrupted. The step's node is not run again, the run
+// continues along the handle it left through. Steps of other branches have no checkpoint,
+// a run interrupted in them resumes from before the fork or loop they belong to.
+func (run *execution) checkpoint(b *branch, node *Node, step *ExecutionStep) {
+	if !b.root {
+		return
+	}
+	state := run.snapshot(b, node)
+	state.Handle = step.SourceHandle
+	step.checkpoint = state
+
+	// Nodes after the checkpoint cannot have run before the interruption
+	run.recovering.Store(false)
+}
@@ -0,0 +1,210 @@
+package workflow
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestExecutor_ResumeFromCheckpoint(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("count", countHandler)
+	wf := sequenceWorkflow(Node{ID: "start", Type: "start"}, countNode("first", "a"), countNode("second", "b"), Node{ID: "end", Type: "end"})
+
+	var steps []ExecutionStep
+	result := executor.ExecuteWithProgress(context.Background(), wf, map[string]interface{}{}, func(step ExecutionStep) {
+		steps = append(steps, step)
+	})
+	if result.Status != "completed" || len(steps) != 4 {
+		t.Fatalf("Expected the run to complete, got %s: %+v", result.Status, result.Steps)
+	}
+	for _, step := range steps {
+		if step.checkpoint == nil || step.checkpoint.NodeID != step.NodeID {
+			t.Fatalf("Expected every step to be checkpointed, got %+v", step)
+		}
+	}
+
+	// The run is interrupted after the first count, and resumed from its checkpoint
+	checkpoint := steps[1].checkpoint
+	if checkpoint.Variables["a"] != 1.0 || checkpoint.Variables["b"] != nil || checkpoint.Executed != 2 {
+		t.Fatalf("Expected the state after the first count, got %+v", checkpoint)
+	}
+	result = executor.Resume(context.Background(), wf, checkpoint, nil)
+	if result.Status != "completed" || len(result.Steps) != 2 || result.Steps[0].NodeID != "second" {
+		t.Fatalf("Expected the run to continue from the second count, got %s: %+v", result.Status, result.Steps)
+	}
+	if result.Variables["a"] != 1.0 || result.Variables["b"] != 1.0 {
+		t.Errorf("Expected each count to run once, got %v", result.Variables)
+	}
+
+	// Nodes that are not safe to run again fail instead, they may have run before
+	executor.RegisterNodeType("count", NotReexecutable(countHandler))
+	result = executor.Resume(context.Background(), wf, checkpoint, nil)
+	if result.Status != "failed" || len(result.Steps) != 1 {
+		t.Fatalf("Expected the run to fail at the second count, got %s: %+v", result.Status, result.Steps)
+	}
+	if step := result.Steps[0]; step.NodeID != "second" || !strings.Contains(step.Error, "not safe to run again") {
+		t.Errorf("Expected the second count to be refused, got %+v", step)
+	}
+}
+
+func TestExecutor_CheckpointsOnlyMainBranch(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("count", countHandler)
+	wf := &Workflow{ID: "parallel", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			countNode("x", "x"),
+			countNode("y", "y"),
+			{ID: "join", Type: "join"},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []Edge{
+			{ID: "e1", Source: "start", Target: "x"},
+			{ID: "e2", Source: "start", Target: "y"},
+			{ID: "e3", Source: "x", Target: "join"},
+			{ID: "e4", Source: "y", Target: "join"},
+			{ID: "e5", Source: "join", Target: "end"},
+		},
+	}}
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	var checkpointed []string
+	for _, step := range result.Steps {
+		if step.checkpoint != nil {
+			checkpointed = append(checkpointed, step.NodeID)
+		}
+	}
+	if expected := []string{"start", "join", "end"}; !reflect.DeepEqual(checkpointed, expected) {
+		t.Errorf("Expected checkpoints after %v, got %v", expected, checkpointed)
+	}
+}
+
+func TestHTTPNode_Reexecution(t *testing.T) {
+	executor := NewExecutor()
+	for method, safe := range map[string]bool{"": true, "get": true, "PUT": true, "POST": false, "PATCH": false} {
+		node := &Node{ID: "call", Type: "http", Data: NodeData{Metadata: map[string]interface{}{"method": method}}}
+		if executor.safeToReexecute(node) != safe {
+			t.Errorf("Expected %q requests to be safe to make again: %v", method, safe)
+		}
+	}
+	if executor.safeToReexecute(&Node{ID: "notify", Type: "email"}) {
+		t.Errorf("Expected emails not to be sent again")
+	}
+}
+
+func TestRunner_ResumesFromCheckpoint(t *testing.T) {
+	for _, safe := range []bool{true, false} {
+		wf := sequenceWorkflow(Node{ID: "start", Type: "start"}, countNode("count", "count"), Node{ID: "block", Type: "block"}, Node{ID: "end", Type: "end"})
+		repo := NewMockRepository()
+
+		// The block node is interrupted the first time it runs
+		var counted, blocked atomic.Int32
+		started := make(chan struct{})
+		var block NodeHandler = NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+			if blocked.Add(1) == 1 {
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		})
+		if !safe {
+			block = NotReexecutable(block)
+		}
+		executor := NewExecutor()
+		executor.RegisterNodeType("block", block)
+		executor.RegisterNodeType("count", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+			counted.Add(1)
+			return countHandler(ctx, node, wfVars, step)
+		}))
+		config := RunnerConfig{Workers: 1, PollInterval: 10 * time.Millisecond}
+
+		runner := NewRunner(repo, executor, config)
+		runner.Start(context.Background())
+		exec := queueRun(t, repo, wf)
+		<-started
+		runner.Stop()
+
+		stopped, _ := repo.GetExecution(context.Background(), exec.ID)
+		if stopped.State == nil || stopped.State.NodeID != "count" || stopped.State.Steps != 2 {
+			t.Fatalf("Expected the run to be checkpointed after the count, got %+v", stopped.State)
+		}
+
+		// Another worker picks the run up from the checkpoint
+		runner = NewRunner(repo, executor, config)
+		runner.Start(context.Background())
+		status := "completed"
+		if !safe {
+			status = "failed"
+		}
+		finished := waitForStatus(t, repo, exec.ID, status)
+		runner.Stop()
+
+		var trace []string
+		for _, step := range finished.Steps {
+			trace = append(trace, step.NodeID+":"+step.Status)
+		}
+		expected := []string{"start:completed", "count:completed", "block:completed", "end:completed"}
+		if !safe {
+			expected = []string{"start:completed", "count:completed", "block:failed"}
+		}
+		if !reflect.DeepEqual(trace, expected) {
+			t.Errorf("Expected steps %v, got %v", expected, trace)
+		}
+		if counted.Load() != 1 || finished.State != nil || finished.FinishedAt == nil {
+			t.Errorf("Expected the count to run once and the run to finish, counted %d: %+v", counted.Load(), finished)
+		}
+	}
+}
+
+func TestRunner_ExecuteCheckpoints(t *testing.T) {
+	wf := sequenceWorkflow(Node{ID: "start", Type: "start"}, countNode("count", "count"), Node{ID: "block", Type: "block"}, Node{ID: "end", Type: "end"})
+	repo := NewMockRepository()
+
+	// The caller goes away while the block node runs the first time
+	var counted, blocked atomic.Int32
+	var checkpointed *Execution
+	ctx, cancel := context.WithCancel(context.Background())
+	executor := NewExecutor()
+	executor.RegisterNodeType("block", NodeHandlerFunc(func(nodeCtx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		if blocked.Add(1) == 1 {
+			checkpointed, _ = repo.GetExecution(context.Background(), executionIDFrom(nodeCtx))
+			cancel()
+			<-nodeCtx.Done()
+			return nodeCtx.Err()
+		}
+		return nil
+	}))
+	executor.RegisterNodeType("count", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		counted.Add(1)
+		return countHandler(ctx, node, wfVars, step)
+	}))
+
+	runner := NewRunner(repo, executor, RunnerConfig{Workers: 1, PollInterval: 10 * time.Millisecond})
+	runner.Start(context.Background())
+	defer runner.Stop()
+	exec := &Execution{ID: uuid.NewString(), WorkflowID: wf.ID, Definition: wf.Definition, StartedAt: time.Now()}
+	runner.Execute(ctx, exec)
+
+	// The run was recorded as it went, like a queued run
+	if checkpointed == nil || checkpointed.Status != "running" || checkpointed.State == nil || checkpointed.State.NodeID != "count" {
+		t.Fatalf("Expected the run to be checkpointed after the count, got %+v", checkpointed)
+	}
+
+	// A worker picks the run up from the checkpoint
+	finished := waitForStatus(t, repo, exec.ID, "completed")
+	var trace []string
+	for _, step := range finished.Steps {
+		trace = append(trace, step.NodeID+":"+step.Status)
+	}
+	expected := []string{"start:completed", "count:completed", "block:completed", "end:completed"}
+	if !reflect.DeepEqual(trace, expected) || counted.Load() != 1 {
+		t.Errorf("Expected steps %v with one count, got %v and %d counts", expected, trace, counted.Load())
+	}
+}
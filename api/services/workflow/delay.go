@@ -0,0 +1,207 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxInProcessDelay is the longest a delay node waits while holding on to its run.
+// Longer delays stop the run until the scheduler resumes it, so no worker sleeps for hours.
+const defaultMaxInProcessDelay = 30 * time.Second
+
+// WithMaxInProcessDelay sets the longest a delay node waits in-process. Longer delays stop
+// the run with the waiting status, to be resumed by the scheduler when they are up. Zero
+// stops the run for every delay.
+func WithMaxInProcessDelay(d time.Duration) ExecutorOption {
+	return func(e *Executor) {
+		e.maxInProcessDelay = d
+	}
+}
+
+// delayConfig is read from the metadata of a delay node, which sets either a duration or
+// the time to wait until
+type delayConfig struct {
+	duration time.Duration
+	// until is a timestamp or a time of day such as "9am tomorrow", and may use {{placeholders}}
+	until string
+	// location is the timezone until is read in, UTC by default
+	location *time.Location
+}
+
+func parseDelayConfig(node *Node) (*delayConfig, error) {
+	metadata := node.Data.Metadata
+	config := &delayConfig{location: time.UTC}
+
+	rawDuration, hasDuration := metadata["duration"]
+	rawUntil, hasUntil := metadata["until"]
+	if hasDuration == hasUntil {
+		return nil, fmt.Errorf("exactly one of duration and until must be set")
+	}
+
+	if hasDuration {
+		duration, err := parseDurationValue(rawDuration)
+		if err != nil {
+			return nil, fmt.Errorf("duration %w", err)
+		}
+		config.duration = duration
+	}
+
+	if raw, ok := metadata["timezone"]; ok {
+		timezone, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("timezone must be a string")
+		}
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q", timezone)
+		}
+		config.location = loc
+	}
+
+	if hasUntil {
+		until, ok := rawUntil.(string)
+		if !ok || strings.TrimSpace(until) == "" {
+			return nil, fmt.Errorf("until must be a non-empty string")
+		}
+		// Placeholders are only known when the node runs
+		if !strings.Contains(until, "{{") {
+			if _, err := parseDelayUntil(until, config.location, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+		config.until = until
+	}
+
+	return config, nil
+}
+
+// Layouts of the timestamps until may be, the ones without an offset are read in the
+// node's timezone
+var delayTimestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Times of day such as "9am", "9:30pm" and "17:30"
+var clockPattern = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+
+// Read the time a delay waits until relative to now. This is a timestamp, or a time of day
+// optionally followed or preceded by "today" or "tomorrow", e.g. "9am tomorrow". A time of
+// day on its own is its next occurrence. Either may end with "in <timezone>" to be read in
+// that timezone rather than loc, e.g. "9am tomorrow in Australia/Sydney".
+func parseDelayUntil(value string, loc *time.Location, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if i := strings.LastIndex(strings.ToLower(value), " in "); i >= 0 {
+		zone := strings.TrimSpace(value[i+4:])
+		in, err := time.LoadLocation(zone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timezone %q", zone)
+		}
+		value, loc = strings.TrimSpace(value[:i]), in
+	}
+
+	for _, layout := range delayTimestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	days := -1
+	var clock []string
+	for _, field := range strings.Fields(strings.ToLower(value)) {
+		switch field {
+		case "today", "tomorrow":
+			if days >= 0 {
+				return time.Time{}, fmt.Errorf("invalid until %q", value)
+			}
+			days = 0
+			if field == "tomorrow" {
+				days = 1
+			}
+		case "at":
+		default:
+			clock = append(clock, field)
+		}
+	}
+	match := clockPattern.FindStringSubmatch(strings.Join(clock, " "))
+	if match == nil {
+		return time.Time{}, fmt.Errorf("invalid until %q, must be a timestamp or a time of day such as \"9am tomorrow\"", value)
+	}
+
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	if match[3] != "" {
+		if hour < 1 || hour > 12 {
+			return time.Time{}, fmt.Errorf("invalid until %q", value)
+		}
+		hour %= 12
+		if match[3] == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid until %q", value)
+	}
+
+	local := now.In(loc)
+	t := time.Date(local.Year(), local.Month(), local.Day()+max(days, 0), hour, minute, 0, 0, loc)
+	if days < 0 && !t.After(local) {
+		t = time.Date(local.Year(), local.Month(), local.Day()+1, hour, minute, 0, 0, loc)
+	}
+	return t, nil
+}
+
+// Process the delay node, this waits for the duration or until the time it is configured
+// with. Short waits sleep in-process, longer ones stop the run until the scheduler resumes
+// it once the wait is up.
+func (e *Executor) processDelayNode(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	config, err := parseDelayConfig(node)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	until := now.Add(config.duration)
+	if config.until != "" {
+		rendered, err := RenderTemplate(config.until, wfVars)
+		if err != nil {
+			return fmt.Errorf("invalid until: %w", err)
+		}
+		until, err = parseDelayUntil(rendered, config.location, now)
+		if err != nil {
+			return err
+		}
+	}
+	step.Output = map[string]interface{}{
+		"until": until.UTC().Format(time.RFC3339),
+	}
+
+	wait := until.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+	if wait > e.maxInProcessDelay {
+		// The run continues through the node's outgoing edges once the wait is up
+		return &SuspendError{Until: until, TimeoutOutput: copyVars(step.Output)}
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
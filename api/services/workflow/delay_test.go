@@ -0,0 +1,139 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func delayWorkflow(metadata map[string]interface{}) *Workflow {
+	wf := sequenceWorkflow(
+		Node{ID: "start", Type: "start"},
+		Node{ID: "delay", Type: "delay", Data: NodeData{Metadata: metadata}},
+		Node{ID: "end", Type: "end"},
+	)
+	wf.ID = "550e8400-e29b-41d4-a716-446655440000"
+	return wf
+}
+
+func TestParseDelayUntil(t *testing.T) {
+	sydney, _ := time.LoadLocation("Australia/Sydney")
+	now := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		until    string
+		expected time.Time
+	}{
+		{"11am", time.Date(2026, 3, 10, 11, 0, 0, 0, time.UTC)},
+		{"9am", time.Date(2026, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{"9am today", time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{"tomorrow at 17:30", time.Date(2026, 3, 11, 17, 30, 0, 0, time.UTC)},
+		{"12am", time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"9:15 PM", time.Date(2026, 3, 10, 21, 15, 0, 0, time.UTC)},
+		// 10am in UTC is 9pm in Sydney
+		{"9am tomorrow in Australia/Sydney", time.Date(2026, 3, 11, 9, 0, 0, 0, sydney)},
+		{"8pm in Australia/Sydney", time.Date(2026, 3, 11, 20, 0, 0, 0, sydney)},
+		{"2026-04-01 08:00", time.Date(2026, 4, 1, 8, 0, 0, 0, time.UTC)},
+		{"2026-04-01T08:00:00+02:00", time.Date(2026, 4, 1, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		until, err := parseDelayUntil(tt.until, time.UTC, now)
+		if err != nil || !until.Equal(tt.expected) {
+			t.Errorf("Expected %q to be %s, got %s: %v", tt.until, tt.expected, until, err)
+		}
+	}
+
+	for _, until := range []string{"soon", "13pm", "25:00", "9am today tomorrow", "9am in Mars/Olympus_Mons"} {
+		if _, err := parseDelayUntil(until, time.UTC, now); err == nil {
+			t.Errorf("Expected %q to be invalid", until)
+		}
+	}
+}
+
+func TestExecutor_DelayInProcess(t *testing.T) {
+	executor := NewExecutor()
+	wf := delayWorkflow(map[string]interface{}{"duration": "30ms"})
+
+	started := time.Now()
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "completed" || len(result.Steps) != 3 {
+		t.Fatalf("Expected the run to complete, got %s: %+v", result.Status, result.Steps)
+	}
+	if elapsed := time.Since(started); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected the run to wait for the delay, took %s", elapsed)
+	}
+
+	// Times that have passed do not wait at all
+	wf = delayWorkflow(map[string]interface{}{"until": "{{remindAt}}"})
+	result = executor.Execute(context.Background(), wf, map[string]interface{}{"remindAt": "2020-01-01T00:00:00Z"})
+	if result.Status != "completed" || result.Steps[1].Output["until"] != "2020-01-01T00:00:00Z" {
+		t.Errorf("Expected the run to continue straight away, got %s: %+v", result.Status, result.Steps)
+	}
+}
+
+func TestScheduler_ResumesDelayedRuns(t *testing.T) {
+	wf := delayWorkflow(map[string]interface{}{"duration": "1h"})
+	repo := NewMockRepository(wf)
+	service := NewServiceWithDependencies(repo, NewExecutor(WithMaxInProcessDelay(time.Minute)))
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute?async=true", `{}`)
+	var queued struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &queued)
+	waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "waiting"
+	})
+	exec, _ := repo.GetExecution(context.Background(), queued.ID)
+	if until := exec.State.WaitUntil; until == nil || until.Sub(time.Now()) < 59*time.Minute {
+		t.Fatalf("Expected the run to wait for an hour, got %v", until)
+	}
+
+	if resumed, err := service.scheduler.expire(context.Background(), time.Now()); err != nil || resumed != 0 {
+		t.Fatalf("Expected the run to keep waiting, got %d: %v", resumed, err)
+	}
+	resumed, err := service.scheduler.expire(context.Background(), time.Now().Add(2*time.Hour))
+	if err != nil || resumed != 1 {
+		t.Fatalf("Expected the run to resume, got %d: %v", resumed, err)
+	}
+
+	exec = waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "completed"
+	})
+	var trace []string
+	for _, step := range exec.Steps {
+		trace = append(trace, step.NodeID+":"+step.Status)
+	}
+	if expected := []string{"start:completed", "delay:waiting", "delay:completed", "end:completed"}; !reflect.DeepEqual(trace, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, trace)
+	}
+	if exec.Steps[2].Output["until"] != exec.Steps[1].Output["until"] {
+		t.Errorf("Expected the resumed step to keep the time waited until, got %+v", exec.Steps[2])
+	}
+}
+
+func TestValidate_Delay(t *testing.T) {
+	for _, metadata := range []map[string]interface{}{
+		{},
+		{"duration": "1h", "until": "9am"},
+		{"duration": "soon"},
+		{"until": "someday"},
+		{"until": "9am", "timezone": "Mars/Olympus_Mons"},
+	} {
+		result := Validate(delayWorkflow(metadata).Definition)
+		if result.Valid || len(result.Diagnostics) != 1 || result.Diagnostics[0].Code != "invalid_metadata" {
+			t.Errorf("Expected %v to be invalid metadata, got %+v", metadata, result.Diagnostics)
+		}
+	}
+
+	// Placeholders are only checked when the node runs
+	result := Validate(delayWorkflow(map[string]interface{}{"until": "{{remindAt}}", "timezone": "Europe/London"}).Definition)
+	if !result.Valid {
+		t.Errorf("Expected the delay to be valid, got %+v", result.Diagnostics)
+	}
+}
@@ -3,27 +3,122 @@ package workflow
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Executor struct {
 	httpClient *http.Client
+	mailer     Mailer
+	// maxSteps is the most steps a single run may execute
+	maxSteps int
+	// maxInProcessDelay is the longest a delay node waits without stopping the run
+	maxInProcessDelay time.Duration
+	// workflows are where subworkflow nodes load the workflows they run from
+	workflows WorkflowStore
+
+	mu       sync.RWMutex
+	handlers map[string]NodeHandler
 }
 
-func NewExecutor() *Executor {
-	return &Executor{
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+// ExecutorOption configures an Executor when it is created
+type ExecutorOption func(*Executor)
+
+// WithMailer sets the mailer used by email nodes. By default emails are never delivered,
+// and only the most recent are kept in an in-memory outbox.
+func WithMailer(mailer Mailer) ExecutorOption {
+	return func(e *Executor) {
+		e.mailer = mailer
+	}
+}
+
+func NewExecutor(options ...ExecutorOption) *Executor {
+	e := &Executor{
+		// Requests are bounded by the timeouts of the nodes making them, which every node
+		// type using the client has, see externalNodeTypes
+		httpClient:        &http.Client{},
+		mailer:            NewOutboxMailer(""),
+		maxSteps:          defaultMaxSteps,
+		maxInProcessDelay: defaultMaxInProcessDelay,
+		handlers:          make(map[string]NodeHandler),
+	}
+
+	for _, option := range options {
+		option(e)
 	}
+
+	e.registerBuiltinNodeTypes()
+	return e
+}
+
+// RegisterNodeType registers the handler used to execute nodes of the given type.
+// Registering a type that already exists replaces the previous handler, which
+// allows the built-in node types to be overridden.
+func (e *Executor) RegisterNodeType(nodeType string, handler NodeHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers[nodeType] = handler
+}
+
+// nodeHandler returns the handler registered for the node type, if any
+func (e *Executor) nodeHandler(nodeType string) (NodeHandler, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	handler, ok := e.handlers[nodeType]
+	return handler, ok
+}
+
+// Register the node types that ship with the executor
+func (e *Executor) registerBuiltinNodeTypes() {
+	// Start and end nodes only mark the boundaries of the workflow
+	noop := NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		return nil
+	})
+	e.RegisterNodeType("start", noop)
+	e.RegisterNodeType("end", noop)
+	// Failure nodes start the path run when the workflow fails
+	e.RegisterNodeType("failure", noop)
+
+	// Fork nodes only fan out to their outgoing edges, and join nodes are merged by the
+	// fork that reaches them (they pass straight through when reached by a single path)
+	e.RegisterNodeType("fork", noop)
+	e.RegisterNodeType("join", noop)
+
+	e.RegisterNodeType("form", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		return e.processFormNode(node, wfVars, step)
+	}))
+	e.RegisterNodeType("integration", NodeHandlerFunc(e.processIntegrationNode))
+	e.RegisterNodeType("http", DeclareReexecution(NodeHandlerFunc(e.processHTTPNode), idempotentHTTPNode))
+	e.RegisterNodeType("condition", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		return e.processConditionNode(node, wfVars, step)
+	}))
+	e.RegisterNodeType("switch", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		return e.processSwitchNode(node, wfVars, step)
+	}))
+	// Emails must not be sent twice, should a run be interrupted while sending one
+	e.RegisterNodeType("email", NotReexecutable(NodeHandlerFunc(e.processEmailNode)))
+	e.RegisterNodeType("foreach", NodeHandlerFunc(e.processForeachNode))
+	e.RegisterNodeType("approval", NodeHandlerFunc(e.processApprovalNode))
+	e.RegisterNodeType("delay", NodeHandlerFunc(e.processDelayNode))
+	// Subworkflows may do anything, so they are not run again should a run be interrupted
+	e.RegisterNodeType("subworkflow", NotReexecutable(NodeHandlerFunc(e.processSubworkflowNode)))
 }
 
 func (e *Executor) Execute(ctx context.Context, wf *Workflow, inputs map[string]interface{}) *ExecutionResponse {
-	steps := []ExecutionStep{}
+	return e.ExecuteWithProgress(ctx, wf, inputs, nil)
+}
 
+// ExecuteWithProgress executes the workflow like Execute, calling onStep as each step is
+// recorded so callers can report partial progress. Parallel branches call onStep
+// concurrently, in the order their steps finish.
+func (e *Executor) ExecuteWithProgress(ctx context.Context, wf *Workflow, inputs map[string]interface{}, onStep func(ExecutionStep)) *ExecutionResponse {
 	// Copy the inputs to the variables
 	// This is done to avoid modifying the original inputs
 	// Vars is the shared execution context for the workflow
@@ -34,134 +129,255 @@ func (e *Executor) Execute(ctx context.Context, wf *Workflow, inputs map[string]
 	for k, v := range inputs {
 		wfVars[k] = v
 	}
+
+	// Find the start node, if not found, return a failed response
+	current := findNodeByType(wf.Definition.Nodes, "start")
+	if current == nil {
+		return failedResponse("No start node found in workflow")
+	}
+
+	// The main branch runs from the start node, and forks into concurrent
+	// branches wherever a node has several outgoing edges to follow
+	main := newBranch("", wfVars)
+
+	return e.execute(ctx, wf, current, main, onStep, func(ctx context.Context, run *execution) error {
+		_, err := e.walk(ctx, run, main, current)
+		return err
+	})
+}
+
+// Run the main branch of the workflow with proceed, which walks it from wherever the run
+// starts or resumes, and report how the run ended
+func (e *Executor) execute(ctx context.Context, wf *Workflow, start *Node, main *branch, onStep func(ExecutionStep), proceed func(context.Context, *execution) error) *ExecutionResponse {
 	// Assume completed by default, will be updated if any step fails
 	status := "completed"
-	nodes := wf.Definition.Nodes
-	nodeMap := make(map[string]*Node)
-
-	// Create a map of nodes by ID for quick lookup
-	// Ideal for O(1) lookup time, especially for large workflows
-	for i := range nodes {
-		nodeMap[nodes[i].ID] = &nodes[i]
+	run := newExecution(wf)
+	run.onStep = onStep
+	run.maxSteps = e.maxSteps
+	// Only the main branch may stop at a waiting node
+	main.root = true
+
+	// The start node may limit how long the run can take, the deadline is passed to
+	// every node handler through the context
+	timeout, err := runTimeout(start)
+	if err != nil {
+		return failedResponse(fmt.Sprintf("Invalid start node: %v", err))
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		run.timeout = timeout
+		run.deadline, _ = ctx.Deadline()
 	}
 
-	// Find the start node, if not found, return a failed response
-	current := findNodeByType(nodes, "start")
-	if current == nil {
-		return &ExecutionResponse{
-			ExecutedAt: time.Now().Format(time.RFC3339),
-			Status:     "failed",
-			Steps: []ExecutionStep{{
-				NodeID: "system",
-				Type:   "system",
-				Label:  "System Error",
-				Status: "failed",
-				Error:  "No start node found in workflow",
-			}},
+	switch err := proceed(ctx, run); {
+	case errors.Is(err, errSuspended):
+		status = "waiting"
+	case err != nil:
+		status = "failed"
+		if run.timedOut() {
+			status = "timed_out"
 		}
+		e.runFailurePath(ctx, run, main)
 	}
 
-	// Visited is a map of nodes that have been visited
-	// This is used to check for cycles in the workflow
-	visited := make(map[string]bool)
+	// The workflow is complete, return the execution response
+	return &ExecutionResponse{
+		ExecutedAt: time.Now().Format(time.RFC3339),
+		Status:     status,
+		Steps:      main.steps,
+		Variables:  main.vars,
+		State:      run.state,
+	}
+}
 
+func failedResponse(message string) *ExecutionResponse {
+	return &ExecutionResponse{
+		ExecutedAt: time.Now().Format(time.RFC3339),
+		Status:     "failed",
+		Steps:      []ExecutionStep{systemErrorStep(message)},
+	}
+}
+
+// Walk the graph from the current node, executing each step until the path ends, a step
+// fails, or (for a forked branch) a join node is reached. The join node is returned so the
+// fork that started the branch can merge the results.
+func (e *Executor) walk(ctx context.Context, run *execution, b *branch, current *Node) (*Node, error) {
 	// Loop through the nodes in the workflow, executing each step
 	for current != nil {
-		// Check for cycles
-		if visited[current.ID] {
-			return &ExecutionResponse{
-				ExecutedAt: time.Now().Format(time.RFC3339),
-				Status:     "failed",
-				Steps: append(steps, ExecutionStep{
-					NodeID: "system",
-					Type:   "system",
-					Label:  "System Error",
-					Status: "failed",
-					Error:  fmt.Sprintf("Cycle detected: node %s visited twice", current.ID),
-				}),
-			}
+		if current.Type == "join" && b.forked {
+			return current, nil
 		}
-		visited[current.ID] = true
+		// An iteration of a loop ends when it leads back to its foreach node
+		if current.ID == b.loop {
+			return nil, nil
+		}
+
+		b.start(current)
 
-		step := ExecutionStep{
-			NodeID:      current.ID,
-			Type:        current.Type,
-			Label:       current.Data.Label,
-			Description: current.Data.Description,
-			Status:      "completed",
+		// Check for cycles, visited is used to check for cycles in the workflow. Nodes
+		// can only run again after a loop back-edge leads back to them
+		if err := b.visit(run, current); err != nil {
+			return nil, err
 		}
 
-		// Switch on the node type and execute the appropriate function
-		switch current.Type {
-		case "start":
+		// Branches that were cancelled, because the run was or another branch won their
+		// join, stop before the next node rather than running it
+		if err := ctx.Err(); err != nil && (errors.Is(err, context.Canceled) || !run.timedOut()) {
+			step := systemErrorStep(fmt.Sprintf("Cancelled before node %s ran", current.ID))
+			step.Status = "cancelled"
+			run.record(b, step)
+			return nil, err
+		}
 
-		case "form":
-			if err := e.processFormNode(current, wfVars, &step); err != nil {
-				step.Status = "failed"
-				step.Error = err.Error()
-				status = "failed"
-			}
+		// Runs that have used up their time stop before the next node
+		if run.timedOut() {
+			err := fmt.Errorf("Run timed out after %s", run.timeout)
+			step := systemErrorStep(err.Error())
+			step.Status = "timed_out"
+			run.record(b, step)
+			return nil, err
+		}
 
-		case "integration":
-			if err := e.processIntegrationNode(ctx, current, wfVars, &step); err != nil {
-				step.Status = "failed"
-				step.Error = err.Error()
-				status = "failed"
-			}
+		// Runaway loops fail once the run has used up its step budget
+		if err := run.spend(); err != nil {
+			run.record(b, systemErrorStep(err.Error()))
+			return nil, err
+		}
 
-		case "condition":
-			if err := e.processConditionNode(wfVars, &step); err != nil {
+		// Nodes that may have been running when the run was interrupted only run again
+		// if their handler declares it safe
+		var step ExecutionStep
+		if run.recovering.Load() && !e.safeToReexecute(current) {
+			step = interruptedStep(current)
+		} else {
+			step = e.executeNode(ctx, current, b.vars)
+		}
+		step.Branch = b.name
+		step.Iteration = b.visits[current.ID]
+		b.visits[current.ID]++
+
+		// Foreach nodes run their body for every item before their step is recorded,
+		// then continue through their done edge
+		if current.Type == "foreach" && step.Status == "completed" {
+			if err := e.iterate(ctx, run, b, current, &step); err != nil {
 				step.Status = "failed"
 				step.Error = err.Error()
-				status = "failed"
 			}
+			step.SourceHandle = ForeachDoneHandle
+			step.DurationMs = time.Since(step.StartedAt).Milliseconds()
+		}
 
-		case "email":
-			if err := e.processEmailNode(wfVars, &step); err != nil {
-				step.Status = "failed"
-				step.Error = err.Error()
-				status = "failed"
+		// A waiting node stops the run, which is resumed from its step. Only the main
+		// branch can be resumed, so nodes cannot wait in branches of their own
+		if step.Status == "waiting" {
+			if b.root {
+				run.record(b, step)
+				return nil, run.suspend(b, current, &step)
 			}
-
-		case "end":
-
-		default:
 			step.Status = "failed"
-			step.Error = fmt.Sprintf("Unknown node type: %s", current.Type)
-			status = "failed"
+			step.Error = fmt.Sprintf("Node %s cannot wait inside a parallel branch, foreach body or failure path", current.ID)
 		}
 
+		// A failed step continues along the error edges of its node, if it has any
+		failed := stepFailed(&step) && !run.handleFailure(ctx, b, current, &step)
+
 		// Add the step to the steps array, this will be returned to the client
-		steps = append(steps, step)
-
-		// If the step failed, return the execution response,
-		if step.Status == "failed" {
-			return &ExecutionResponse{
-				ExecutedAt: time.Now().Format(time.RFC3339),
-				Status:     status,
-				Steps:      steps,
-			}
+		if !failed {
+			run.checkpoint(b, current, &step)
 		}
+		run.record(b, step)
 
-		// Find the next node to execute, if no next node, break the loop
-		nextID := findNextNodeID(wf.Definition.Edges, current.ID, wfVars)
-		if nextID == "" {
-			break
+		// If the step failed, stop executing this path
+		if failed {
+			return nil, fmt.Errorf("node %s failed: %s", current.ID, step.Error)
 		}
 
-		// Get the next node from the node map
-		nextNode, exists := nodeMap[nextID]
-		if !exists {
-			break
+		next, err := e.next(ctx, run, b, current, &step)
+		if err != nil {
+			return nil, err
 		}
-		current = nextNode
+		current = next
 	}
 
-	// The workflow is complete, return the execution response
-	return &ExecutionResponse{
-		ExecutedAt: time.Now().Format(time.RFC3339),
-		Status:     status,
-		Steps:      steps,
+	return nil, nil
+}
+
+// Execute a single node with the handler registered for its type
+func (e *Executor) executeNode(ctx context.Context, node *Node, wfVars map[string]interface{}) ExecutionStep {
+	step := ExecutionStep{
+		NodeID:      node.ID,
+		Type:        node.Type,
+		Label:       node.Data.Label,
+		Description: node.Data.Description,
+		Status:      "completed",
+		StartedAt:   time.Now(),
+	}
+
+	// Look up the handler registered for the node type and execute it
+	handler, ok := e.nodeHandler(node.Type)
+	if !ok {
+		step.Status = "failed"
+		step.Error = fmt.Sprintf("Unknown node type: %s", node.Type)
+	} else if err := e.handle(ctx, handler, node, wfVars, &step); errors.As(err, &step.suspend) {
+		step.Status = "waiting"
+	} else if err != nil {
+		step.Status = "failed"
+		step.Error = err.Error()
+		// Steps cut short by their node's timeout, or the run's, are reported as timed out
+		if errors.Is(err, errTimedOut) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			step.Status = "timed_out"
+		}
+	}
+
+	// Render the placeholders in the label and description once the node has run,
+	// so they can refer to its outputs. Text that cannot be rendered is kept as it is
+	if label, err := RenderTemplate(step.Label, wfVars); err == nil {
+		step.Label = label
+	}
+	if description, err := RenderTemplate(step.Description, wfVars); err == nil {
+		step.Description = description
+	}
+
+	step.DurationMs = time.Since(step.StartedAt).Milliseconds()
+	return step
+}
+
+// Find the node to continue with after the given step. If several edges are followed,
+// the branch forks and continues from the join node where the forked branches meet.
+// Returns nil when the path ends.
+func (e *Executor) next(ctx context.Context, run *execution, b *branch, from *Node, step *ExecutionStep) (*Node, error) {
+	for {
+		edges := findNextEdges(run.wf.Definition.Edges, from.ID, step.SourceHandle, b.vars)
+
+		switch len(edges) {
+		case 0:
+			return nil, nil
+		case 1:
+			if err := b.loopBack(run, edges[0]); err != nil {
+				return nil, err
+			}
+			// Edges to nodes that do not exist end the path
+			return run.nodeMap[edges[0].Target], nil
+		}
+
+		join, joinStep, err := e.fork(ctx, run, b, edges)
+		if err != nil || join == nil {
+			return nil, err
+		}
+		from, step = join, joinStep
+	}
+}
+
+func systemErrorStep(message string) ExecutionStep {
+	return ExecutionStep{
+		NodeID:    "system",
+		Type:      "system",
+		Label:     "System Error",
+		Status:    "failed",
+		Error:     message,
+		StartedAt: time.Now(),
 	}
 }
 
@@ -174,6 +390,28 @@ func (e *Executor) processFormNode(node *Node, wfVars map[string]interface{}, st
 		return fmt.Errorf("invalid inputFields in form node metadata")
 	}
 
+	// Inputs are checked against the schema before runs start, but runs started another way,
+	// e.g. by a subworkflow node, are only checked here
+	schema, err := parseInputSchema(node)
+	if err != nil {
+		return err
+	}
+	if schema != nil {
+		checked, errs := schema.check(wfVars)
+		if len(errs) > 0 {
+			problems := make([]string, len(errs))
+			for i, fieldErr := range errs {
+				problems[i] = fieldErr.Field + " " + fieldErr.Message
+			}
+			return fmt.Errorf("invalid input fields: %s", strings.Join(problems, ", "))
+		}
+		for name := range schema.Properties {
+			if value, ok := checked[name]; ok {
+				wfVars[name] = value
+			}
+		}
+	}
+
 	output := make(map[string]interface{})
 	for _, field := range inputFields {
 		fieldName, ok := field.(string)
@@ -192,6 +430,11 @@ func (e *Executor) processFormNode(node *Node, wfVars map[string]interface{}, st
 	return nil
 }
 
+// The endpoint used by integration nodes that do not define an apiEndpoint
+const defaultWeatherEndpoint = "https://api.open-meteo.com/v1/forecast?latitude={{lat | number(4)}}&longitude={{lon | number(4)}}&current_weather=true"
+
+var coordinatePlaceholderPattern = regexp.MustCompile(`\{+(lat|lon)\}+`)
+
 // Process the integration node, this will fetch the weather data for the city
 func (e *Executor) processIntegrationNode(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
 	city, ok := wfVars["city"].(string)
@@ -205,8 +448,24 @@ func (e *Executor) processIntegrationNode(ctx context.Context, node *Node, wfVar
 		return fmt.Errorf("coordinates not found for city: %s", city)
 	}
 
+	// Render the API endpoint with the coordinates of the city
+	endpoint, _ := node.Data.Metadata["apiEndpoint"].(string)
+	if endpoint == "" {
+		endpoint = defaultWeatherEndpoint
+	}
+	// Older workflows use single brace {lat} and {lon} placeholders
+	endpoint = coordinatePlaceholderPattern.ReplaceAllString(endpoint, "{{$1}}")
+
+	endpointVars := copyVars(wfVars)
+	endpointVars["lat"] = lat
+	endpointVars["lon"] = lon
+	url, err := RenderTemplate(endpoint, endpointVars)
+	if err != nil {
+		return fmt.Errorf("invalid apiEndpoint: %w", err)
+	}
+
 	// Fetch the weather data for the city
-	temperature, err := e.fetchWeather(ctx, lat, lon)
+	temperature, err := e.fetchWeather(ctx, url)
 	if err != nil {
 		return fmt.Errorf("failed to fetch weather data: %w", err)
 	}
@@ -222,100 +481,265 @@ func (e *Executor) processIntegrationNode(ctx context.Context, node *Node, wfVar
 	return nil
 }
 
-func (e *Executor) processConditionNode(wfVars map[string]interface{}, step *ExecutionStep) error {
-	temperature, ok := wfVars["temperature"].(float64)
-	if !ok {
-		return fmt.Errorf("temperature not found in variables")
+// The expression used by condition nodes that do not define a conditionExpression
+const defaultConditionExpression = "temperature {{operator}} {{threshold}}"
+
+// Operator names accepted in the operator variable, mapped to expression operators
+var conditionOperators = map[string]string{
+	"greater_than":          ">",
+	"less_than":             "<",
+	"equals":                "==",
+	"not_equals":            "!=",
+	"greater_than_or_equal": ">=",
+	"less_than_or_equal":    "<=",
+}
+
+var conditionPlaceholderPattern = regexp.MustCompile(`\{\{\s*([\w.]+)\s*\}\}`)
+
+// Process the condition node, this will evaluate the conditionExpression from the
+// node metadata against the workflow variables
+func (e *Executor) processConditionNode(node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	source, _ := node.Data.Metadata["conditionExpression"].(string)
+	if source == "" {
+		source = defaultConditionExpression
 	}
 
-	threshold, ok := wfVars["threshold"].(float64)
-	if !ok {
-		if thresholdInt, ok := wfVars["threshold"].(int); ok {
-			threshold = float64(thresholdInt)
-		} else {
-			return fmt.Errorf("threshold not found in variables")
-		}
+	rendered, err := renderConditionExpression(source, wfVars)
+	if err != nil {
+		return err
 	}
 
-	// Get the operator from the variables
-	operator, ok := wfVars["operator"].(string)
-	// default to greater_than if not found
-	if !ok {
-		operator = "greater_than"
+	expr, err := ParseExpression(rendered)
+	if err != nil {
+		return fmt.Errorf("invalid condition expression %q: %w", rendered, err)
 	}
 
-	var conditionMet bool
-	switch operator {
-	case "greater_than":
-		conditionMet = temperature > threshold
-	case "less_than":
-		conditionMet = temperature < threshold
-	case "equals":
-		conditionMet = temperature == threshold
-	case "greater_than_or_equal":
-		conditionMet = temperature >= threshold
-	case "less_than_or_equal":
-		conditionMet = temperature <= threshold
-	default:
-		conditionMet = temperature > threshold
+	conditionMet, err := expr.EvaluateBool(wfVars)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate condition %q: %w", rendered, err)
 	}
 
 	// Store result in variables, this will be used to check if the condition is met
 	// in the next node. Will always overwrite the previous value.
 	wfVars["conditionMet"] = conditionMet
+	step.SourceHandle = strconv.FormatBool(conditionMet)
 
 	step.Output = map[string]interface{}{
 		"conditionMet": conditionMet,
-		"threshold":    threshold,
-		"operator":     operator,
-		"actualValue":  temperature,
-		"message":      fmt.Sprintf("Temperature %.1f°C %s %.1f°C - condition %s", temperature, operator, threshold, map[bool]string{true: "met", false: "not met"}[conditionMet]),
+		"expression":   rendered,
+		"message":      fmt.Sprintf("%s - condition %s", rendered, map[bool]string{true: "met", false: "not met"}[conditionMet]),
+	}
+	// The keys reported before conditions were expressions, for the expressions comparing
+	// temperature with threshold that they were
+	for _, match := range conditionPlaceholderPattern.FindAllStringSubmatch(source, -1) {
+		if match[1] == "operator" {
+			step.Output["operator"], _ = conditionOperator(wfVars)
+		}
+	}
+	if threshold, ok := toFloat(wfVars["threshold"]); ok {
+		step.Output["threshold"] = threshold
+	}
+	if temperature, ok := toFloat(wfVars["temperature"]); ok {
+		step.Output["actualValue"] = temperature
 	}
 
 	return nil
 }
 
-// Process the email node, this will send an email to the user
-// if the condition is met
-func (e *Executor) processEmailNode(wfVars map[string]interface{}, step *ExecutionStep) error {
-	// Get the conditionMet variable from the variables
-	// This is set in the condition node
-	conditionMet, ok := wfVars["conditionMet"].(bool)
-	if !ok || !conditionMet {
-		step.Output = map[string]interface{}{
-			"emailSent": false,
-			"message":   "Condition not met, no email sent",
+// The operator named by the operator variable, and the expression operator it stands for.
+// The variable may also be the expression operator itself. Unknown or missing operators
+// fall back to greater_than, as they did before conditions were expressions
+func conditionOperator(wfVars map[string]interface{}) (string, string) {
+	if v, ok := wfVars["operator"].(string); ok {
+		if op, ok := conditionOperators[v]; ok {
+			return v, op
+		}
+		for name, op := range conditionOperators {
+			if v == op {
+				return name, op
+			}
 		}
-		return nil
 	}
+	return "greater_than", conditionOperators["greater_than"]
+}
 
-	city, ok := wfVars["city"].(string)
+// Process the switch node, this will evaluate the cases from the node metadata in
+// order and select the output handle of the first case that matches
+func (e *Executor) processSwitchNode(node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	metadata := node.Data.Metadata
+	cases, ok := metadata["cases"].([]interface{})
 	if !ok {
-		return fmt.Errorf("city not found in variables")
+		return fmt.Errorf("invalid cases in switch node metadata")
 	}
 
-	temperature, ok := wfVars["temperature"].(float64)
-	if !ok {
-		return fmt.Errorf("temperature not found in variables")
+	for i, c := range cases {
+		switchCase, ok := c.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid case %d in switch node metadata", i)
+		}
+		source, _ := switchCase["expression"].(string)
+		handle, _ := switchCase["handle"].(string)
+		if source == "" || handle == "" {
+			return fmt.Errorf("case %d in switch node must have an expression and a handle", i)
+		}
+
+		rendered, err := renderConditionExpression(source, wfVars)
+		if err != nil {
+			return err
+		}
+		expr, err := ParseExpression(rendered)
+		if err != nil {
+			return fmt.Errorf("invalid expression %q in case %d: %w", rendered, i, err)
+		}
+		matched, err := expr.EvaluateBool(wfVars)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate case %d %q: %w", i, rendered, err)
+		}
+
+		if matched {
+			step.SourceHandle = handle
+			step.Output = map[string]interface{}{
+				"handle":      handle,
+				"matchedCase": i,
+				"expression":  rendered,
+				"message":     fmt.Sprintf("%s - taking %s", rendered, handle),
+			}
+			return nil
+		}
 	}
 
-	email, ok := wfVars["email"].(string)
+	defaultHandle, _ := metadata["defaultHandle"].(string)
+	if defaultHandle == "" {
+		return fmt.Errorf("no case matched and no defaultHandle is configured")
+	}
+
+	step.SourceHandle = defaultHandle
+	step.Output = map[string]interface{}{
+		"handle":  defaultHandle,
+		"message": fmt.Sprintf("No case matched - taking %s", defaultHandle),
+	}
+	return nil
+}
+
+// Substitute the {{variable}} placeholders in a condition expression with expression
+// literals, so the expression can be configured by the inputs (e.g. the operator and threshold)
+func renderConditionExpression(source string, wfVars map[string]interface{}) (string, error) {
+	var renderErr error
+	rendered := conditionPlaceholderPattern.ReplaceAllStringFunc(source, func(match string) string {
+		name := conditionPlaceholderPattern.FindStringSubmatch(match)[1]
+
+		// Only the operator is substituted as an operator, every other string is a literal
+		if name == "operator" {
+			_, op := conditionOperator(wfVars)
+			return op
+		}
+
+		value, ok := wfVars[name]
+		if !ok {
+			if renderErr == nil {
+				renderErr = fmt.Errorf("%s not found in variables", name)
+			}
+			return match
+		}
+
+		switch v := value.(type) {
+		case string:
+			return strconv.Quote(v)
+		case bool:
+			return strconv.FormatBool(v)
+		case nil:
+			return "null"
+		}
+
+		if f, ok := toFloat(value); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+
+		if renderErr == nil {
+			renderErr = fmt.Errorf("variable %s cannot be used in a condition expression", name)
+		}
+		return match
+	})
+
+	return rendered, renderErr
+}
+
+// The email sent by email nodes that do not define an emailTemplate
+var defaultEmailTemplate = map[string]interface{}{
+	"subject": "Weather Alert",
+	"body":    "Weather alert for {{city}}! Temperature is {{temperature | number(1)}}°C!",
+}
+
+// Process the email node, this will send an email to the user with the mailer,
+// rendering the subject and body of the emailTemplate from the node metadata. Templates
+// with a "to" address send to it whether or not the condition was met, such as to notify
+// ops from an error edge.
+func (e *Executor) processEmailNode(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	template, ok := node.Data.Metadata["emailTemplate"].(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("email not found in variables")
+		template = defaultEmailTemplate
+	}
+
+	email, err := RenderTemplate(stringify(template["to"]), wfVars)
+	if err != nil {
+		return fmt.Errorf("invalid email to address: %w", err)
+	}
+
+	if email == "" {
+		// Get the conditionMet variable from the variables
+		// This is set in the condition node
+		conditionMet, ok := wfVars["conditionMet"].(bool)
+		if !ok || !conditionMet {
+			step.Output = map[string]interface{}{
+				"emailSent": false,
+				"message":   "Condition not met, no email sent",
+			}
+			return nil
+		}
+
+		if email, ok = wfVars["email"].(string); !ok {
+			return fmt.Errorf("email not found in variables")
+		}
+	}
+
+	subject, err := RenderTemplate(stringify(template["subject"]), wfVars)
+	if err != nil {
+		return fmt.Errorf("invalid email subject: %w", err)
+	}
+	body, err := RenderTemplate(stringify(template["body"]), wfVars)
+	if err != nil {
+		return fmt.Errorf("invalid email body: %w", err)
+	}
+
+	// The from address in the template overrides the mailer's default
+	from, err := RenderTemplate(stringify(template["from"]), wfVars)
+	if err != nil {
+		return fmt.Errorf("invalid email from address: %w", err)
+	}
+
+	message := &EmailMessage{
+		From:    from,
+		To:      []string{email},
+		Subject: subject,
+		Body:    body,
+	}
+	receipt, err := e.mailer.Send(ctx, message)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
 	}
 
 	emailDraft := map[string]interface{}{
 		"to":        email,
-		"from":      "weather-alerts@example.com",
-		"subject":   "Weather Alert",
-		"body":      fmt.Sprintf("Weather alert for %s! Temperature is %.1f°C!", city, temperature),
-		"timestamp": time.Now().Format(time.RFC3339),
+		"from":      message.From,
+		"subject":   subject,
+		"body":      body,
+		"timestamp": receipt.SentAt.Format(time.RFC3339),
 	}
 
 	step.Output = map[string]interface{}{
 		"emailDraft":     emailDraft,
-		"deliveryStatus": "sent",
-		"messageId":      fmt.Sprintf("msg_%s", time.Now().Format("20060102150405")),
+		"deliveryStatus": receipt.Status,
+		"messageId":      receipt.MessageID,
 		"emailSent":      true,
 	}
 
@@ -350,9 +774,7 @@ func (e *Executor) getCityCoordinates(node *Node, city string) (float64, float64
 	return 0, 0
 }
 
-func (e *Executor) fetchWeather(ctx context.Context, lat, lon float64) (float64, error) {
-	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&current_weather=true", lat, lon)
-
+func (e *Executor) fetchWeather(ctx context.Context, url string) (float64, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return 0, err
@@ -366,7 +788,10 @@ func (e *Executor) fetchWeather(ctx context.Context, lat, lon float64) (float64,
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("weather API error: %s - %s", resp.Status, string(body))
+		return 0, &StatusError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("weather API error: %s - %s", resp.Status, string(body)),
+		}
 	}
 
 	var weatherResp WeatherResponse
@@ -386,26 +811,52 @@ func findNodeByType(nodes []Node, nodeType string) *Node {
 	return nil
 }
 
-// Find the next node to execute, based on the current node and the variables
-func findNextNodeID(edges []Edge, currentNodeID string, wfVars map[string]interface{}) string {
+func findNodeByID(nodes []Node, id string) *Node {
+	for i := range nodes {
+		if nodes[i].ID == id {
+			return &nodes[i]
+		}
+	}
+	return nil
+}
+
+// Find the edges to follow from the current node. Branching nodes select the handle to
+// leave through, in which case the edges for that handle are followed (or the edges without
+// a handle, if there are none). Otherwise every edge without a handle is followed, along with
+// the "true"/"false" edges matching the conditionMet variable.
+func findNextEdges(edges []Edge, currentNodeID, handle string, wfVars map[string]interface{}) []Edge {
+	var matched, unhandled []Edge
+
 	for _, edge := range edges {
-		if edge.Source == currentNodeID {
-
-			// If the source handle is not empty, we need to check if the condition is met
-			// The source handle is the condition that needs to be met to continue to the next node
-			if edge.SourceHandle != "" {
-				conditionMet, ok := wfVars["conditionMet"].(bool)
-				if ok {
-					// If the condition is met, we need to return the target node
-					if (edge.SourceHandle == "true" && conditionMet) ||
-						(edge.SourceHandle == "false" && !conditionMet) {
-						return edge.Target
-					}
-				}
-			} else {
-				return edge.Target
+		if edge.Source != currentNodeID {
+			continue
+		}
+
+		if edge.SourceHandle == "" {
+			unhandled = append(unhandled, edge)
+			if handle == "" {
+				matched = append(matched, edge)
+			}
+			continue
+		}
+
+		if handle != "" {
+			if edge.SourceHandle == handle {
+				matched = append(matched, edge)
 			}
+			continue
+		}
+
+		// The source handle is the condition that needs to be met to continue to the next node
+		conditionMet, ok := wfVars["conditionMet"].(bool)
+		if ok && ((edge.SourceHandle == "true" && conditionMet) ||
+			(edge.SourceHandle == "false" && !conditionMet)) {
+			matched = append(matched, edge)
 		}
 	}
-	return ""
+
+	if handle != "" && len(matched) == 0 {
+		return unhandled
+	}
+	return matched
 }
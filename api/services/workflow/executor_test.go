@@ -2,6 +2,7 @@ package workflow
 
 import (
 	"context"
+	"reflect"
 	"testing"
 )
 
@@ -239,8 +240,12 @@ func TestExecutor_ProcessFormNode(t *testing.T) {
 func TestExecutor_ProcessConditionNode(t *testing.T) {
 	tests := []struct {
 		name        string
+		expression  string
 		vars        map[string]interface{}
 		expectError bool
+		expectMet   bool
+		// Output keys to check, besides conditionMet
+		expectOutput map[string]interface{}
 	}{
 		{
 			name: "valid condition with greater_than operator",
@@ -249,7 +254,9 @@ func TestExecutor_ProcessConditionNode(t *testing.T) {
 				"threshold":   25.0,
 				"operator":    "greater_than",
 			},
-			expectError: false,
+			expectError:  false,
+			expectMet:    true,
+			expectOutput: map[string]interface{}{"operator": "greater_than", "threshold": 25.0, "actualValue": 30.0},
 		},
 		{
 			name: "valid condition with less_than operator",
@@ -259,6 +266,7 @@ func TestExecutor_ProcessConditionNode(t *testing.T) {
 				"operator":    "less_than",
 			},
 			expectError: false,
+			expectMet:   true,
 		},
 		{
 			name: "missing temperature",
@@ -284,6 +292,79 @@ func TestExecutor_ProcessConditionNode(t *testing.T) {
 				"operator":    "greater_than",
 			},
 			expectError: false,
+			expectMet:   true,
+		},
+		{
+			name:       "seeded expression template",
+			expression: "temperature {{operator}} {{threshold}}",
+			vars: map[string]interface{}{
+				"temperature": 18.0,
+				"threshold":   25.0,
+				"operator":    "greater_than_or_equal",
+			},
+			expectError: false,
+			expectMet:   false,
+		},
+		{
+			name:       "nested fields and boolean logic",
+			expression: "weather.wind.speed > 40 && city in ['Sydney', 'Perth']",
+			vars: map[string]interface{}{
+				"city": "Perth",
+				"weather": map[string]interface{}{
+					"wind": map[string]interface{}{"speed": 55.0},
+				},
+			},
+			expectError: false,
+			expectMet:   true,
+		},
+		{
+			name:       "string comparison",
+			expression: "name == 'Jane' || name == 'John'",
+			vars: map[string]interface{}{
+				"name": "Alex",
+			},
+			expectError: false,
+			expectMet:   false,
+		},
+		{
+			// Strings other than the operator are literals, even when they look like one
+			name:       "operator names in other variables",
+			expression: "mode == {{mode}} && temperature {{operator}} {{threshold}}",
+			vars: map[string]interface{}{
+				"mode":        "greater_than",
+				"temperature": 30.0,
+				"threshold":   25.0,
+				"operator":    ">",
+			},
+			expectError: false,
+			expectMet:   true,
+		},
+		{
+			name:         "unknown operator falls back to greater_than",
+			expression:   "temperature {{operator}} {{threshold}}",
+			vars:         map[string]interface{}{"temperature": 30.0, "threshold": 25.0, "operator": "about"},
+			expectError:  false,
+			expectMet:    true,
+			expectOutput: map[string]interface{}{"operator": "greater_than", "expression": "temperature > 25"},
+		},
+		{
+			name:         "missing operator falls back to greater_than",
+			vars:         map[string]interface{}{"temperature": 20.0, "threshold": 25.0},
+			expectError:  false,
+			expectMet:    false,
+			expectOutput: map[string]interface{}{"operator": "greater_than", "threshold": 25.0, "actualValue": 20.0},
+		},
+		{
+			name:        "non-boolean expression",
+			expression:  "temperature + 1",
+			vars:        map[string]interface{}{"temperature": 30.0},
+			expectError: true,
+		},
+		{
+			name:        "invalid expression",
+			expression:  "temperature >",
+			vars:        map[string]interface{}{"temperature": 30.0},
+			expectError: true,
 		},
 	}
 
@@ -292,7 +373,18 @@ func TestExecutor_ProcessConditionNode(t *testing.T) {
 			executor := NewExecutor()
 			step := &ExecutionStep{}
 
-			err := executor.processConditionNode(tt.vars, step)
+			node := &Node{
+				ID:   "condition",
+				Type: "condition",
+				Data: NodeData{
+					Label: "Condition",
+					Metadata: map[string]interface{}{
+						"conditionExpression": tt.expression,
+					},
+				},
+			}
+
+			err := executor.processConditionNode(node, tt.vars, step)
 
 			if tt.expectError {
 				if err == nil {
@@ -305,6 +397,14 @@ func TestExecutor_ProcessConditionNode(t *testing.T) {
 				if step.Output == nil {
 					t.Error("Expected output to be set")
 				}
+				if step.Output["conditionMet"] != tt.expectMet {
+					t.Errorf("Expected conditionMet %v, got %v", tt.expectMet, step.Output["conditionMet"])
+				}
+				for key, expected := range tt.expectOutput {
+					if step.Output[key] != expected {
+						t.Errorf("Expected %s %v, got %v", key, expected, step.Output[key])
+					}
+				}
 			}
 		})
 	}
@@ -370,7 +470,7 @@ func TestExecutor_ProcessEmailNode(t *testing.T) {
 			executor := NewExecutor()
 			step := &ExecutionStep{}
 
-			err := executor.processEmailNode(tt.vars, step)
+			err := executor.processEmailNode(context.Background(), &Node{ID: "email", Type: "email"}, tt.vars, step)
 
 			if tt.expectError {
 				if err == nil {
@@ -388,6 +488,52 @@ func TestExecutor_ProcessEmailNode(t *testing.T) {
 	}
 }
 
+func TestExecutor_ProcessEmailNodeTemplate(t *testing.T) {
+	executor := NewExecutor()
+	node := &Node{
+		ID:   "email",
+		Type: "email",
+		Data: NodeData{
+			Description: "Email {{name}} about {{city}}",
+			Metadata: map[string]interface{}{
+				"emailTemplate": map[string]interface{}{
+					"subject": "{{city | upper}} alert",
+					"body":    "Hi {{name | default('there')}}, it is {{temperature | number(1)}}°C in {{city}}!",
+				},
+			},
+		},
+	}
+	vars := map[string]interface{}{
+		"email":        "john@example.com",
+		"city":         "Sydney",
+		"temperature":  30.0,
+		"conditionMet": true,
+	}
+
+	step := executor.executeNode(context.Background(), node, vars)
+	if step.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %s", step.Status, step.Error)
+	}
+
+	draft := step.Output["emailDraft"].(map[string]interface{})
+	if draft["subject"] != "SYDNEY alert" {
+		t.Errorf("Expected rendered subject, got %q", draft["subject"])
+	}
+	if draft["body"] != "Hi there, it is 30.0°C in Sydney!" {
+		t.Errorf("Expected rendered body, got %q", draft["body"])
+	}
+	// The description refers to a missing variable, so it is kept as it is
+	if step.Description != "Email {{name}} about {{city}}" {
+		t.Errorf("Expected the description to be unchanged, got %q", step.Description)
+	}
+
+	vars["name"] = "John"
+	step = executor.executeNode(context.Background(), node, vars)
+	if step.Description != "Email John about Sydney" {
+		t.Errorf("Expected rendered description, got %q", step.Description)
+	}
+}
+
 func TestExecutor_GetCityCoordinates(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -523,7 +669,7 @@ func TestFindNodeByType(t *testing.T) {
 	}
 }
 
-func TestFindNextNodeID(t *testing.T) {
+func TestFindNextEdges(t *testing.T) {
 	edges := []Edge{
 		{
 			ID:     "e1",
@@ -547,19 +693,30 @@ func TestFindNextNodeID(t *testing.T) {
 			Target:       "end",
 			SourceHandle: "false",
 		},
+		{
+			ID:     "e5",
+			Source: "fork",
+			Target: "weather",
+		},
+		{
+			ID:     "e6",
+			Source: "fork",
+			Target: "news",
+		},
 	}
 
 	tests := []struct {
 		name         string
 		currentNode  string
+		handle       string
 		vars         map[string]interface{}
-		expectedNext string
+		expectedNext []string
 	}{
 		{
 			name:         "simple edge from start to form",
 			currentNode:  "start",
 			vars:         map[string]interface{}{},
-			expectedNext: "form",
+			expectedNext: []string{"form"},
 		},
 		{
 			name:        "condition met - go to email",
@@ -567,7 +724,7 @@ func TestFindNextNodeID(t *testing.T) {
 			vars: map[string]interface{}{
 				"conditionMet": true,
 			},
-			expectedNext: "email",
+			expectedNext: []string{"email"},
 		},
 		{
 			name:        "condition not met - go to end",
@@ -575,22 +732,214 @@ func TestFindNextNodeID(t *testing.T) {
 			vars: map[string]interface{}{
 				"conditionMet": false,
 			},
-			expectedNext: "end",
+			expectedNext: []string{"end"},
 		},
 		{
 			name:         "no next node",
 			currentNode:  "end",
 			vars:         map[string]interface{}{},
-			expectedNext: "",
+			expectedNext: nil,
+		},
+		{
+			name:         "selected handle takes precedence over conditionMet",
+			currentNode:  "condition",
+			handle:       "false",
+			vars:         map[string]interface{}{"conditionMet": true},
+			expectedNext: []string{"end"},
+		},
+		{
+			name:         "all unconditional edges are followed",
+			currentNode:  "fork",
+			vars:         map[string]interface{}{},
+			expectedNext: []string{"weather", "news"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := findNextNodeID(edges, tt.currentNode, tt.vars)
+			result := findNextEdges(edges, tt.currentNode, tt.handle, tt.vars)
 
-			if result != tt.expectedNext {
-				t.Errorf("Expected next node %s, got %s", tt.expectedNext, result)
+			var targets []string
+			for _, edge := range result {
+				targets = append(targets, edge.Target)
+			}
+			if !reflect.DeepEqual(targets, tt.expectedNext) {
+				t.Errorf("Expected next nodes %v, got %v", tt.expectedNext, targets)
+			}
+		})
+	}
+}
+
+func TestExecutor_RegisterNodeType(t *testing.T) {
+	wf := &Workflow{
+		ID:   "test-workflow",
+		Name: "Test Workflow",
+		Definition: WorkflowGraph{
+			ID: "test-workflow",
+			Nodes: []Node{
+				{ID: "start", Type: "start", Data: NodeData{Label: "Start"}},
+				{ID: "slack", Type: "slack", Data: NodeData{Label: "Slack"}},
+				{ID: "end", Type: "end", Data: NodeData{Label: "End"}},
+			},
+			Edges: []Edge{
+				{ID: "e1", Source: "start", Target: "slack"},
+				{ID: "e2", Source: "slack", Target: "end"},
+			},
+		},
+	}
+
+	t.Run("unknown node type fails", func(t *testing.T) {
+		executor := NewExecutor()
+		result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+
+		if result.Status != "failed" {
+			t.Errorf("Expected status failed, got %s", result.Status)
+		}
+		last := result.Steps[len(result.Steps)-1]
+		if last.Error != "Unknown node type: slack" {
+			t.Errorf("Expected unknown node type error, got %q", last.Error)
+		}
+	})
+
+	t.Run("registered node type is executed", func(t *testing.T) {
+		executor := NewExecutor()
+		executor.RegisterNodeType("slack", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+			wfVars["posted"] = true
+			step.Output = map[string]interface{}{"channel": "#alerts"}
+			return nil
+		}))
+
+		result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+
+		if result.Status != "completed" {
+			t.Errorf("Expected status completed, got %s", result.Status)
+		}
+		if len(result.Steps) != 3 {
+			t.Fatalf("Expected 3 steps, got %d", len(result.Steps))
+		}
+		if result.Steps[1].Output["channel"] != "#alerts" {
+			t.Errorf("Expected custom handler output, got %v", result.Steps[1].Output)
+		}
+	})
+}
+
+func TestExecutor_ProcessSwitchNode(t *testing.T) {
+	cases := []interface{}{
+		map[string]interface{}{"expression": "severity >= 8", "handle": "high"},
+		map[string]interface{}{"expression": "severity >= 4", "handle": "medium"},
+	}
+
+	tests := []struct {
+		name           string
+		metadata       map[string]interface{}
+		vars           map[string]interface{}
+		expectError    bool
+		expectedHandle string
+	}{
+		{
+			name:           "first matching case wins",
+			metadata:       map[string]interface{}{"cases": cases, "defaultHandle": "low"},
+			vars:           map[string]interface{}{"severity": 9},
+			expectedHandle: "high",
+		},
+		{
+			name:           "later case matches",
+			metadata:       map[string]interface{}{"cases": cases, "defaultHandle": "low"},
+			vars:           map[string]interface{}{"severity": 5},
+			expectedHandle: "medium",
+		},
+		{
+			name:           "default handle",
+			metadata:       map[string]interface{}{"cases": cases, "defaultHandle": "low"},
+			vars:           map[string]interface{}{"severity": 1},
+			expectedHandle: "low",
+		},
+		{
+			name:        "no match without default",
+			metadata:    map[string]interface{}{"cases": cases},
+			vars:        map[string]interface{}{"severity": 1},
+			expectError: true,
+		},
+		{
+			name:        "missing cases",
+			metadata:    map[string]interface{}{"defaultHandle": "low"},
+			vars:        map[string]interface{}{"severity": 1},
+			expectError: true,
+		},
+		{
+			name: "case without handle",
+			metadata: map[string]interface{}{
+				"cases": []interface{}{map[string]interface{}{"expression": "true"}},
+			},
+			vars:        map[string]interface{}{},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := NewExecutor()
+			step := &ExecutionStep{}
+			node := &Node{ID: "switch", Type: "switch", Data: NodeData{Metadata: tt.metadata}}
+
+			err := executor.processSwitchNode(node, tt.vars, step)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if step.SourceHandle != tt.expectedHandle {
+				t.Errorf("Expected handle %s, got %s", tt.expectedHandle, step.SourceHandle)
+			}
+		})
+	}
+}
+
+func TestExecutor_ExecuteSwitchBranches(t *testing.T) {
+	wf := &Workflow{
+		ID: "test-workflow",
+		Definition: WorkflowGraph{
+			Nodes: []Node{
+				{ID: "start", Type: "start"},
+				{
+					ID:   "severity",
+					Type: "switch",
+					Data: NodeData{Metadata: map[string]interface{}{
+						"cases": []interface{}{
+							map[string]interface{}{"expression": "severity == 'high'", "handle": "high"},
+							map[string]interface{}{"expression": "severity == 'medium'", "handle": "medium"},
+						},
+						"defaultHandle": "low",
+					}},
+				},
+				{ID: "page", Type: "end"},
+				{ID: "ticket", Type: "end"},
+				{ID: "ignore", Type: "end"},
+			},
+			Edges: []Edge{
+				{ID: "e1", Source: "start", Target: "severity"},
+				{ID: "e2", Source: "severity", Target: "page", SourceHandle: "high"},
+				{ID: "e3", Source: "severity", Target: "ticket", SourceHandle: "medium"},
+				{ID: "e4", Source: "severity", Target: "ignore", SourceHandle: "low"},
+			},
+		},
+	}
+
+	for severity, expectedEnd := range map[string]string{"high": "page", "medium": "ticket", "low": "ignore"} {
+		t.Run(severity, func(t *testing.T) {
+			result := NewExecutor().Execute(context.Background(), wf, map[string]interface{}{"severity": severity})
+
+			if result.Status != "completed" {
+				t.Fatalf("Expected status completed, got %s", result.Status)
+			}
+			last := result.Steps[len(result.Steps)-1]
+			if last.NodeID != expectedEnd {
+				t.Errorf("Expected to finish at %s, got %s", expectedEnd, last.NodeID)
 			}
 		})
 	}
@@ -0,0 +1,805 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression is a parsed expression that can be evaluated against the workflow variables.
+//
+// The language supports:
+//   - literals: numbers, 'single' or "double" quoted strings, true, false, null and [lists]
+//   - variables, with nested field access (weather.wind.speed) and indexing (cities[0])
+//   - arithmetic: + - * / % (+ also concatenates strings)
+//   - comparison: == != < <= > >= (numbers and strings)
+//   - membership: in, not in (lists, substrings and map keys)
+//   - boolean logic: && || ! (or the keywords and, or, not)
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// ParseExpression parses an expression so it can be evaluated repeatedly
+func ParseExpression(source string) (*Expression, error) {
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the source of the expression
+func (x *Expression) String() string {
+	return x.source
+}
+
+// Evaluate evaluates the expression against the variables and returns its value
+func (x *Expression) Evaluate(vars map[string]interface{}) (interface{}, error) {
+	return x.root.eval(vars)
+}
+
+// EvaluateBool evaluates the expression and requires the result to be a boolean
+func (x *Expression) EvaluateBool(vars map[string]interface{}) (bool, error) {
+	value, err := x.Evaluate(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q evaluated to %v, expected a boolean", x.source, value)
+	}
+	return b, nil
+}
+
+// EvaluateExpression parses and evaluates an expression in one step
+func EvaluateExpression(source string, vars map[string]interface{}) (interface{}, error) {
+	expr, err := ParseExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	return expr.Evaluate(vars)
+}
+
+// Tokenizer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	num  float64
+}
+
+// Operators are matched longest first
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".", ","}
+
+func tokenizeExpression(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			text := string(runes[start:i])
+			num, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", text, start)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, pos: start, num: num})
+
+		case r == '\'' || r == '"':
+			start := i
+			quote := r
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string at position %d", start)
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == quote {
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), pos: start})
+
+		case unicode.IsLetter(r) || r == '_' || r == '$':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start:i]), pos: start})
+
+		default:
+			matched := false
+			rest := string(runes[i:])
+			for _, op := range exprOperators {
+				if strings.HasPrefix(rest, op) {
+					tokens = append(tokens, token{kind: tokOperator, text: op, pos: i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// Parser
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// Check whether the next token is one of the given operators or keywords
+func (p *exprParser) match(texts ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokOperator && tok.kind != tokIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if tok.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(text string) error {
+	tok := p.next()
+	if tok.kind != tokOperator || tok.text != text {
+		if tok.kind == tokEOF {
+			return fmt.Errorf("expected %q but reached end of expression", text)
+		}
+		return fmt.Errorf("expected %q at position %d, got %q", text, tok.pos, tok.text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.match("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.match("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if _, ok := p.match("!", "not"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if op, ok := p.match("==", "!=", "<=", ">=", "<", ">", "in"); ok {
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+
+	// "not in" is the only place the not keyword may follow an operand
+	if tok := p.peek(); tok.kind == tokIdent && tok.text == "not" {
+		if after := p.tokens[p.pos+1]; after.kind == tokIdent && after.text == "in" {
+			p.pos += 2
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &notNode{operand: &binaryNode{op: "in", left: left, right: right}}, nil
+		}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.match("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.match("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.match("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negateNode{operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.match("."); ok {
+			tok := p.next()
+			if tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at position %d", tok.pos)
+			}
+			node = &fieldNode{target: node, field: tok.text}
+			continue
+		}
+		if _, ok := p.match("["); ok {
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			node = &indexNode{target: node, index: index}
+			continue
+		}
+		return node, nil
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokNumber:
+		return &literalNode{value: tok.num}, nil
+
+	case tokString:
+		return &literalNode{value: tok.text}, nil
+
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		case "and", "or", "not", "in":
+			return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+		}
+		return &variableNode{name: tok.text}, nil
+
+	case tokOperator:
+		switch tok.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+
+		case "[":
+			list := &listNode{}
+			if _, ok := p.match("]"); ok {
+				return list, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if _, ok := p.match(","); ok {
+					continue
+				}
+				if err := p.expect("]"); err != nil {
+					return nil, err
+				}
+				return list, nil
+			}
+		}
+	}
+
+	if tok.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// Evaluation
+
+type exprNode interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(vars map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type listNode struct {
+	items []exprNode
+}
+
+func (n *listNode) eval(vars map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+type variableNode struct {
+	name string
+}
+
+func (n *variableNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("undefined variable: %s", n.name)
+	}
+	return value, nil
+}
+
+type fieldNode struct {
+	target exprNode
+	field  string
+}
+
+func (n *fieldNode) eval(vars map[string]interface{}) (interface{}, error) {
+	target, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := lookupField(target, n.field)
+	if !ok {
+		return nil, fmt.Errorf("undefined field: %s", n.field)
+	}
+	return value, nil
+}
+
+type indexNode struct {
+	target exprNode
+	index  exprNode
+}
+
+func (n *indexNode) eval(vars map[string]interface{}) (interface{}, error) {
+	target, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, ok := index.(string); ok {
+		value, ok := lookupField(target, key)
+		if !ok {
+			return nil, fmt.Errorf("undefined field: %s", key)
+		}
+		return value, nil
+	}
+
+	i, ok := toFloat(index)
+	if !ok || i != math.Trunc(i) {
+		return nil, fmt.Errorf("invalid index: %v", index)
+	}
+	list, ok := toList(target)
+	if !ok {
+		return nil, fmt.Errorf("cannot index %T", target)
+	}
+	if int(i) < 0 || int(i) >= len(list) {
+		return nil, fmt.Errorf("index %d out of range", int(i))
+	}
+	return list[int(i)], nil
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate non-boolean value %v", value)
+	}
+	return !b, nil
+}
+
+type negateNode struct {
+	operand exprNode
+}
+
+func (n *negateNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := toFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate non-numeric value %v", value)
+	}
+	return -f, nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *logicalNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := evalBool(n.left, vars, n.op)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short circuit so the right hand side can guard against missing variables
+	if n.op == "&&" && !left {
+		return false, nil
+	}
+	if n.op == "||" && left {
+		return true, nil
+	}
+
+	return evalBool(n.right, vars, n.op)
+}
+
+func evalBool(node exprNode, vars map[string]interface{}, op string) (bool, error) {
+	value, err := node.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("operator %s requires boolean operands, got %v", op, value)
+	}
+	return b, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compareValues(n.op, left, right)
+	case "in":
+		return containsValue(right, left)
+	case "+":
+		if ls, ok := left.(string); ok {
+			return ls + stringify(right), nil
+		}
+		if rs, ok := right.(string); ok {
+			return stringify(left) + rs, nil
+		}
+	}
+
+	l, lok := toFloat(left)
+	r, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s requires numeric operands, got %v and %v", n.op, left, right)
+	}
+
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	}
+
+	return nil, fmt.Errorf("unknown operator: %s", n.op)
+}
+
+func compareValues(op string, left, right interface{}) (bool, error) {
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			switch op {
+			case "<":
+				return l < r, nil
+			case "<=":
+				return l <= r, nil
+			case ">":
+				return l > r, nil
+			default:
+				return l >= r, nil
+			}
+		}
+	}
+
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			switch op {
+			case "<":
+				return l < r, nil
+			case "<=":
+				return l <= r, nil
+			case ">":
+				return l > r, nil
+			default:
+				return l >= r, nil
+			}
+		}
+	}
+
+	return false, fmt.Errorf("cannot compare %v %s %v", left, op, right)
+}
+
+func containsValue(container, item interface{}) (bool, error) {
+	if s, ok := container.(string); ok {
+		sub, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot search for %v in a string", item)
+		}
+		return strings.Contains(s, sub), nil
+	}
+
+	if list, ok := toList(container); ok {
+		for _, candidate := range list {
+			if valuesEqual(candidate, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if key, ok := item.(string); ok {
+		if _, isMap := toMap(container); isMap {
+			_, found := lookupField(container, key)
+			return found, nil
+		}
+	}
+
+	return false, fmt.Errorf("operator in requires a list, string or map, got %v", container)
+}
+
+// Values are equal if they are numerically equal, or deeply equal otherwise
+func valuesEqual(left, right interface{}) bool {
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			return l == r
+		}
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// Convert any numeric value to a float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Convert any slice value to a []interface{}
+func toList(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case []string:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = v[i]
+		}
+		return list, true
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+// Convert any map keyed by strings to a map[string]interface{}
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	if m, ok := value.(map[string]interface{}); ok {
+		return m, true
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(map[string]interface{}, rv.Len())
+	for _, key := range rv.MapKeys() {
+		m[key.String()] = rv.MapIndex(key).Interface()
+	}
+	return m, true
+}
+
+func lookupField(target interface{}, field string) (interface{}, bool) {
+	m, ok := toMap(target)
+	if !ok {
+		return nil, false
+	}
+	value, ok := m[field]
+	return value, ok
+}
+
+func stringify(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
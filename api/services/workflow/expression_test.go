@@ -0,0 +1,104 @@
+package workflow
+
+import (
+	"testing"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	vars := map[string]interface{}{
+		"temperature": 28.5,
+		"threshold":   25,
+		"city":        "Sydney",
+		"cities":      []interface{}{"Sydney", "Melbourne"},
+		"tags":        []string{"alert", "weather"},
+		"weather": map[string]interface{}{
+			"wind": map[string]interface{}{
+				"speed": 42.0,
+			},
+		},
+		"active": true,
+	}
+
+	tests := []struct {
+		name        string
+		expression  string
+		expected    interface{}
+		expectError bool
+	}{
+		{name: "numeric comparison", expression: "temperature > threshold", expected: true},
+		{name: "int and float equality", expression: "threshold == 25.0", expected: true},
+		{name: "arithmetic precedence", expression: "1 + 2 * 3 - 4 / 2", expected: 5.0},
+		{name: "parentheses", expression: "(1 + 2) * 3", expected: 9.0},
+		{name: "modulo", expression: "7 % 4", expected: 3.0},
+		{name: "unary minus", expression: "-temperature < 0", expected: true},
+		{name: "string equality", expression: "city == 'Sydney'", expected: true},
+		{name: "string ordering", expression: `"apple" < "banana"`, expected: true},
+		{name: "string concatenation", expression: "'Hi ' + city", expected: "Hi Sydney"},
+		{name: "and operator", expression: "active && temperature > 20", expected: true},
+		{name: "or keyword", expression: "temperature < 0 or city == 'Sydney'", expected: true},
+		{name: "not keyword", expression: "not active", expected: false},
+		{name: "bang operator", expression: "!(temperature < 0)", expected: true},
+		{name: "in list literal", expression: "city in ['Perth', 'Sydney']", expected: true},
+		{name: "in list variable", expression: "'Brisbane' in cities", expected: false},
+		{name: "in string slice", expression: "'alert' in tags", expected: true},
+		{name: "not in", expression: "city not in cities", expected: false},
+		{name: "substring in", expression: "'syd' in 'sydney'", expected: true},
+		{name: "key in map", expression: "'wind' in weather", expected: true},
+		{name: "nested field access", expression: "weather.wind.speed >= 40", expected: true},
+		{name: "index access", expression: "cities[1]", expected: "Melbourne"},
+		{name: "bracket field access", expression: "weather['wind'].speed", expected: 42.0},
+		{name: "short circuit guards missing variable", expression: "false && missing > 1", expected: false},
+		{name: "null comparison", expression: "null == null", expected: true},
+		{name: "undefined variable", expression: "missing > 1", expectError: true},
+		{name: "undefined field", expression: "weather.rain > 1", expectError: true},
+		{name: "non-boolean logic operand", expression: "temperature && active", expectError: true},
+		{name: "mismatched comparison", expression: "city > 1", expectError: true},
+		{name: "division by zero", expression: "1 / 0", expectError: true},
+		{name: "unterminated string", expression: "city == 'Sydney", expectError: true},
+		{name: "trailing tokens", expression: "temperature temperature", expectError: true},
+		{name: "missing closing paren", expression: "(1 + 2", expectError: true},
+		{name: "unexpected character", expression: "temperature # 2", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := EvaluateExpression(tt.expression, vars)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got result %v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v (%T), got %v (%T)", tt.expected, tt.expected, result, result)
+			}
+		})
+	}
+}
+
+func TestExpression_EvaluateBool(t *testing.T) {
+	expr, err := ParseExpression("temperature > 25")
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+
+	met, err := expr.EvaluateBool(map[string]interface{}{"temperature": 30.0})
+	if err != nil || !met {
+		t.Errorf("Expected condition to be met, got %v (err %v)", met, err)
+	}
+
+	// The same parsed expression can be evaluated against different variables
+	met, err = expr.EvaluateBool(map[string]interface{}{"temperature": 20.0})
+	if err != nil || met {
+		t.Errorf("Expected condition not to be met, got %v (err %v)", met, err)
+	}
+
+	numeric, _ := ParseExpression("temperature + 1")
+	if _, err := numeric.EvaluateBool(map[string]interface{}{"temperature": 1.0}); err == nil {
+		t.Error("Expected error for non-boolean result")
+	}
+}
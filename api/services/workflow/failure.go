@@ -0,0 +1,65 @@
+package workflow
+
+import (
+	"context"
+	"time"
+)
+
+// ErrorHandle is the output handle of every node that is followed when its step fails,
+// instead of failing the run
+const ErrorHandle = "error"
+
+// Variables describing the failure, set before an error edge or the failure path is followed
+const (
+	errorMessageVariable = "errorMessage"
+	errorNodeVariable    = "errorNodeId"
+)
+
+// Route a failed step along the error edges of its node, if it has any. Runs that were
+// cancelled or ran out of time are not routed, since nothing further can run.
+func (run *execution) handleFailure(ctx context.Context, b *branch, node *Node, step *ExecutionStep) bool {
+	if ctx.Err() != nil || !hasHandleEdge(run.wf.Definition.Edges, node.ID, ErrorHandle) {
+		return false
+	}
+
+	step.SourceHandle = ErrorHandle
+	setErrorVars(b.vars, step)
+	return true
+}
+
+func setErrorVars(vars map[string]interface{}, step *ExecutionStep) {
+	vars[errorMessageVariable] = step.Error
+	vars[errorNodeVariable] = step.NodeID
+}
+
+// Run the workflow's failure path, from its failure node, once the run has failed. The path
+// runs with the variables the run failed with, and its steps are added after the failed
+// step. It cannot rescue the run, which still fails, but can clean up or notify someone.
+func (e *Executor) runFailurePath(ctx context.Context, run *execution, main *branch) {
+	failure := findNodeByType(run.wf.Definition.Nodes, "failure")
+	if failure == nil {
+		return
+	}
+
+	// Runs that ran out of time still clean up, the failure path has no deadline but
+	// the timeouts of its own nodes. Runs that were cancelled are left alone
+	if run.timedOut() {
+		ctx = context.WithoutCancel(ctx)
+		run.deadline = time.Time{}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	for i := len(main.steps) - 1; i >= 0; i-- {
+		if stepFailed(&main.steps[i]) {
+			setErrorVars(main.vars, &main.steps[i])
+			break
+		}
+	}
+
+	// The failure path may run nodes the run has already been through
+	path := newBranch(main.name, main.vars)
+	e.walk(ctx, run, path, failure)
+	main.appendSteps(path.steps)
+}
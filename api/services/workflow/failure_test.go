@@ -0,0 +1,161 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The weather alert, with an error edge that emails ops when the weather API is down
+func weatherAlertWithFallback(endpoint string) *Workflow {
+	wf := retryingWeatherWorkflow(endpoint, nil)
+	delete(wf.Definition.Nodes[1].Data.Metadata, "retry")
+	wf.Definition.Nodes = append(wf.Definition.Nodes, Node{ID: "notify-ops", Type: "email", Data: NodeData{Metadata: map[string]interface{}{
+		"inputVariables": []interface{}{"errorMessage"},
+		"emailTemplate": map[string]interface{}{
+			"to":      "ops@example.com",
+			"subject": "Weather API unavailable",
+			"body":    "Could not fetch the weather for {{city}} at {{errorNodeId}}: {{errorMessage}}",
+		},
+	}}})
+	wf.Definition.Edges = append(wf.Definition.Edges,
+		Edge{ID: "e-error", Source: "weather", SourceHandle: ErrorHandle, Target: "notify-ops"},
+		Edge{ID: "e-notified", Source: "notify-ops", Target: "end"},
+	)
+	return wf
+}
+
+func TestExecutor_ErrorEdge(t *testing.T) {
+	down := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"current_weather": {"temperature": 28.5}}`)
+	}))
+	defer server.Close()
+
+	mailer := NewOutboxMailer("")
+	executor := NewExecutor(WithMailer(mailer))
+	wf := weatherAlertWithFallback(server.URL)
+
+	if result := executor.Validate(wf.Definition); !result.Valid || len(result.Diagnostics) != 0 {
+		t.Fatalf("Expected the fallback to be valid, got %+v", result.Diagnostics)
+	}
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{"city": "Sydney"})
+	if result.Status != "completed" {
+		t.Fatalf("Expected the run to complete through the error edge, got %s: %+v", result.Status, result.Steps)
+	}
+
+	var trace []string
+	for _, step := range result.Steps {
+		trace = append(trace, step.NodeID+":"+step.Status)
+	}
+	expected := []string{"start:completed", "weather:failed", "notify-ops:completed", "end:completed"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, trace)
+	}
+	if result.Steps[1].SourceHandle != ErrorHandle {
+		t.Errorf("Expected the failed step to leave through the error handle, got %q", result.Steps[1].SourceHandle)
+	}
+
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To[0] != "ops@example.com" {
+		t.Fatalf("Expected ops to be emailed, got %+v", messages)
+	}
+	if body := messages[0].Body; !strings.Contains(body, "Sydney at weather: failed to fetch weather data") || !strings.Contains(body, "503") {
+		t.Errorf("Expected the error in the email, got %q", body)
+	}
+
+	// The error edge is not followed when the node succeeds
+	down = false
+	result = executor.Execute(context.Background(), wf, map[string]interface{}{"city": "Sydney"})
+	if result.Status != "completed" || len(result.Steps) != 3 || len(mailer.Messages()) != 1 {
+		t.Errorf("Expected the run to skip the error edge, got %s: %+v", result.Status, result.Steps)
+	}
+	if _, ok := result.Variables["errorMessage"]; ok {
+		t.Errorf("Expected no error variables, got %v", result.Variables)
+	}
+}
+
+func TestExecutor_FailurePath(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("fail", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		wfVars["reserved"] = true
+		return fmt.Errorf("out of stock")
+	}))
+	executor.RegisterNodeType("release", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		step.Output = map[string]interface{}{"released": wfVars["reserved"], "reason": wfVars["errorMessage"], "node": wfVars["errorNodeId"]}
+		return nil
+	}))
+
+	wf := &Workflow{ID: "cleanup", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			{ID: "reserve", Type: "fail"},
+			{ID: "end", Type: "end"},
+			{ID: "on-failure", Type: "failure"},
+			{ID: "release", Type: "release"},
+		},
+		Edges: []Edge{
+			{ID: "e1", Source: "start", Target: "reserve"},
+			{ID: "e2", Source: "reserve", Target: "end"},
+			{ID: "e3", Source: "on-failure", Target: "release"},
+			{ID: "e4", Source: "release", Target: "end"},
+		},
+	}}
+
+	if result := executor.Validate(wf.Definition); !result.Valid || len(result.Diagnostics) != 0 {
+		t.Fatalf("Expected the failure path to be valid and reachable, got %+v", result.Diagnostics)
+	}
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "failed" {
+		t.Fatalf("Expected the run to still fail, got %s", result.Status)
+	}
+
+	var trace []string
+	for _, step := range result.Steps {
+		trace = append(trace, step.NodeID+":"+step.Status)
+	}
+	// The end node runs on the failure path even though the main path never reached it
+	expected := []string{"start:completed", "reserve:failed", "on-failure:completed", "release:completed", "end:completed"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, trace)
+	}
+	output := result.Steps[3].Output
+	if output["released"] != true || output["reason"] != "out of stock" || output["node"] != "reserve" {
+		t.Errorf("Expected the failure path to see the error, got %v", output)
+	}
+
+	// The failure path does not run when the workflow succeeds
+	wf.Definition.Nodes[1].Type = "release"
+	result = executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "completed" || len(result.Steps) != 3 {
+		t.Errorf("Expected only the main path to run, got %s: %+v", result.Status, result.Steps)
+	}
+}
+
+func TestValidate_Failure(t *testing.T) {
+	wf := testWorkflow()
+	wf.Definition.Nodes = append(wf.Definition.Nodes, Node{ID: "f1", Type: "failure"}, Node{ID: "f2", Type: "failure"})
+
+	result := Validate(wf.Definition)
+	if result.Valid || result.Diagnostics[0].Code != "multiple_failure" || result.Diagnostics[0].NodeID != "f2" {
+		t.Errorf("Expected a multiple failure diagnostic, got %+v", result.Diagnostics)
+	}
+
+	// Error variables are only available along error edges
+	wf = weatherAlertWithFallback("http://localhost")
+	wf.Definition.Nodes[2].Data.Metadata = map[string]interface{}{"inputVariables": []interface{}{"errorMessage"}}
+	result = Validate(wf.Definition)
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].Code != "variable_not_produced" || result.Diagnostics[0].NodeID != "end" {
+		t.Errorf("Expected the end node to be warned about errorMessage, got %+v", result.Diagnostics)
+	}
+}
@@ -0,0 +1,223 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Output handles of foreach nodes. The item edge leads to the loop body, which is run
+// once per item, and the done edge is followed once every item has been processed.
+const (
+	ForeachItemHandle = "item"
+	ForeachDoneHandle = "done"
+)
+
+// Foreach nodes fail rather than iterate over more items than their maxIterations, or this
+// many if they do not set one
+const defaultMaxIterations = 100
+
+// foreachConfig is read from the metadata of a foreach node
+type foreachConfig struct {
+	// itemVariable and indexVariable are bound to the current item and its index in the body
+	itemVariable  string
+	indexVariable string
+	// resultVariable receives the list collected from each iteration
+	resultVariable string
+	// collect names the variable collected from each iteration. Without one, the
+	// variables each iteration changed are collected
+	collect       string
+	maxIterations int
+	concurrency   int
+}
+
+func parseForeachConfig(node *Node) (*foreachConfig, error) {
+	metadata := node.Data.Metadata
+	config := &foreachConfig{
+		itemVariable:   "item",
+		indexVariable:  "index",
+		resultVariable: "results",
+		maxIterations:  defaultMaxIterations,
+		concurrency:    1,
+	}
+
+	for key, target := range map[string]*string{
+		"itemVariable":   &config.itemVariable,
+		"indexVariable":  &config.indexVariable,
+		"resultVariable": &config.resultVariable,
+		"collect":        &config.collect,
+	} {
+		if raw, ok := metadata[key]; ok {
+			value, ok := raw.(string)
+			if !ok || value == "" {
+				return nil, fmt.Errorf("%s must be a variable name", key)
+			}
+			*target = value
+		}
+	}
+
+	for key, target := range map[string]*int{
+		"maxIterations": &config.maxIterations,
+		"concurrency":   &config.concurrency,
+	} {
+		if raw, ok := metadata[key]; ok {
+			value, ok := toFloat(raw)
+			if !ok || value < 1 || value != float64(int(value)) {
+				return nil, fmt.Errorf("%s must be a positive whole number", key)
+			}
+			*target = int(value)
+		}
+	}
+
+	return config, nil
+}
+
+// Process the foreach node, this resolves the list to iterate over from the items
+// metadata: a list, a {{placeholder}}, or an expression such as cities or $.order.lines
+func (e *Executor) processForeachNode(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	config, err := parseForeachConfig(node)
+	if err != nil {
+		return err
+	}
+
+	raw, ok := node.Data.Metadata["items"]
+	if !ok {
+		return fmt.Errorf("foreach node has no items")
+	}
+	value, err := renderTemplateValue(raw, wfVars)
+	if err != nil {
+		return err
+	}
+	if source, ok := value.(string); ok {
+		if value, err = EvaluateExpression(source, wfVars); err != nil {
+			return fmt.Errorf("failed to evaluate items %q: %w", source, err)
+		}
+	}
+
+	items, ok := toList(value)
+	if !ok {
+		return fmt.Errorf("items must be a list, got %T", value)
+	}
+	if len(items) > config.maxIterations {
+		return fmt.Errorf("foreach over %d items exceeds maxIterations %d", len(items), config.maxIterations)
+	}
+
+	step.Output = map[string]interface{}{
+		"items": items,
+	}
+	return nil
+}
+
+// Run the body of a foreach node once per item, in branches of their own. Iterations run
+// from the item edge until their path ends or leads back to the foreach node, and only the
+// collected results are kept: other variables set by the body do not leak out of the loop.
+func (e *Executor) iterate(ctx context.Context, run *execution, parent *branch, node *Node, step *ExecutionStep) error {
+	config, err := parseForeachConfig(node)
+	if err != nil {
+		return err
+	}
+	items, _ := step.Output["items"].([]interface{})
+
+	if !hasHandleEdge(run.wf.Definition.Edges, node.ID, ForeachItemHandle) {
+		return fmt.Errorf("foreach node %s has no %q edge", node.ID, ForeachItemHandle)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	snapshot := copyVars(parent.vars)
+	children := make([]*branch, 0, len(items))
+	errs := make([]error, len(items))
+
+	// Iterations take a slot before they start, so at most concurrency run at once. A
+	// failure cancels the iterations in progress and stops new ones from starting
+	slots := make(chan struct{}, config.concurrency)
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		child := parent.child(fmt.Sprintf("%s[%d]", branchName(parent.name, node.ID), i), copyVars(snapshot))
+		child.loop = node.ID
+		child.vars[config.itemVariable] = item
+		child.vars[config.indexVariable] = i
+		children = append(children, child)
+
+		wg.Add(1)
+		go func(i int, child *branch) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			first, err := e.next(ctx, run, child, node, &ExecutionStep{SourceHandle: ForeachItemHandle})
+			if err == nil {
+				_, err = e.walk(ctx, run, child, first)
+			}
+			if err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}(i, child)
+	}
+	wg.Wait()
+
+	// The first iteration to fail is reported, the others failed because they were cancelled
+	failed := -1
+	for i := range children {
+		if errs[i] != nil && failed < 0 {
+			failed = i
+		}
+	}
+
+	results := make([]interface{}, 0, len(children))
+	for i, child := range children {
+		if i != failed && errs[i] != nil {
+			markCancelled(child.steps)
+		}
+		parent.appendSteps(child.steps)
+		results = append(results, config.collected(snapshot, child.vars))
+	}
+
+	if failed >= 0 {
+		return fmt.Errorf("iteration %d failed: %w", failed, errs[failed])
+	}
+
+	parent.vars[config.resultVariable] = results
+	step.Output["results"] = results
+	step.Output["iterations"] = len(results)
+	return nil
+}
+
+// The result of an iteration, the collected variable or every variable the iteration changed
+func (config *foreachConfig) collected(snapshot, vars map[string]interface{}) interface{} {
+	if config.collect != "" {
+		return vars[config.collect]
+	}
+
+	changed := make(map[string]interface{})
+	for k, v := range vars {
+		if k == config.itemVariable || k == config.indexVariable {
+			continue
+		}
+		if old, ok := snapshot[k]; ok && reflect.DeepEqual(old, v) {
+			continue
+		}
+		changed[k] = v
+	}
+	return changed
+}
+
+func hasHandleEdge(edges []Edge, source, handle string) bool {
+	for _, edge := range edges {
+		if edge.Source == source && edge.SourceHandle == handle {
+			return true
+		}
+	}
+	return false
+}
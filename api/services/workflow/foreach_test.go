@@ -0,0 +1,209 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Build a workflow that loops over the items, running the body node for each one and
+// leading back to the foreach node, then ends
+func foreachWorkflow(metadata map[string]interface{}, body Node) *Workflow {
+	return &Workflow{ID: "loop", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			{ID: "loop", Type: "foreach", Data: NodeData{Label: "Each city", Metadata: metadata}},
+			body,
+			{ID: "end", Type: "end"},
+		},
+		Edges: []Edge{
+			{ID: "e-start", Source: "start", Target: "loop"},
+			{ID: "e-item", Source: "loop", SourceHandle: ForeachItemHandle, Target: body.ID},
+			{ID: "e-back", Source: body.ID, Target: "loop"},
+			{ID: "e-done", Source: "loop", SourceHandle: ForeachDoneHandle, Target: "end"},
+		},
+	}}
+}
+
+func TestExecutor_ForeachWeatherForEveryCity(t *testing.T) {
+	temperatures := map[string]float64{"-33.8688": 25, "-37.8136": 18.5, "-27.4698": 30, "-31.9505": 33, "-34.9285": 21}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"current_weather": {"temperature": %v}}`, temperatures[r.URL.Query().Get("latitude")])
+	}))
+	defer server.Close()
+
+	weather := Node{ID: "weather", Type: "integration", Data: NodeData{
+		Label: "Weather for {{city}}",
+		Metadata: map[string]interface{}{
+			"apiEndpoint": server.URL + "?latitude={{lat}}&longitude={{lon}}",
+			"options": []interface{}{
+				map[string]interface{}{"city": "Sydney", "lat": -33.8688, "lon": 151.2093},
+				map[string]interface{}{"city": "Melbourne", "lat": -37.8136, "lon": 144.9631},
+				map[string]interface{}{"city": "Brisbane", "lat": -27.4698, "lon": 153.0251},
+				map[string]interface{}{"city": "Perth", "lat": -31.9505, "lon": 115.8605},
+				map[string]interface{}{"city": "Adelaide", "lat": -34.9285, "lon": 138.6007},
+			},
+		},
+	}}
+	wf := foreachWorkflow(map[string]interface{}{
+		"items":          "{{cities}}",
+		"itemVariable":   "city",
+		"collect":        "temperature",
+		"resultVariable": "temperatures",
+		"concurrency":    2,
+	}, weather)
+
+	executor := NewExecutor()
+	if result := executor.Validate(wf.Definition); !result.Valid {
+		t.Fatalf("Expected the loop to be valid, got %+v", result.Diagnostics)
+	}
+
+	inputs := map[string]interface{}{"cities": []interface{}{"Sydney", "Melbourne", "Brisbane", "Perth", "Adelaide"}}
+	result := executor.Execute(context.Background(), wf, inputs)
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %+v", result.Status, result.Steps)
+	}
+
+	expected := []interface{}{25.0, 18.5, 30.0, 33.0, 21.0}
+	if !reflect.DeepEqual(result.Variables["temperatures"], expected) {
+		t.Errorf("Expected temperatures %v, got %v", expected, result.Variables["temperatures"])
+	}
+	if _, ok := result.Variables["city"]; ok {
+		t.Errorf("Expected the loop variable not to leak out of the loop")
+	}
+
+	// Iteration steps are recorded in item order, before the foreach step that summarises them
+	var order []string
+	for _, step := range result.Steps {
+		order = append(order, step.NodeID+"@"+step.Branch)
+	}
+	expectedOrder := []string{"start@", "weather@loop[0]", "weather@loop[1]", "weather@loop[2]", "weather@loop[3]", "weather@loop[4]", "loop@", "end@"}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Errorf("Expected steps %v, got %v", expectedOrder, order)
+	}
+	if result.Steps[3].Label != "Weather for Brisbane" {
+		t.Errorf("Expected the label to be rendered for the item, got %q", result.Steps[3].Label)
+	}
+	if result.Steps[6].Output["iterations"] != 5 {
+		t.Errorf("Expected the foreach step to report 5 iterations, got %v", result.Steps[6].Output)
+	}
+}
+
+func TestExecutor_ForeachCollectsChangedVariables(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("double", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		wfVars["doubled"] = wfVars["item"].(float64) * 2
+		wfVars["position"] = wfVars["index"]
+		return nil
+	}))
+
+	// The body ends without leading back to the foreach node
+	wf := foreachWorkflow(map[string]interface{}{"items": []interface{}{1.0, 2.0}}, Node{ID: "double", Type: "double"})
+	wf.Definition.Edges = append(wf.Definition.Edges[:2], wf.Definition.Edges[3])
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{"unchanged": true})
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %+v", result.Status, result.Steps)
+	}
+
+	expected := []interface{}{
+		map[string]interface{}{"doubled": 2.0, "position": 0},
+		map[string]interface{}{"doubled": 4.0, "position": 1},
+	}
+	if !reflect.DeepEqual(result.Variables["results"], expected) {
+		t.Errorf("Expected results %v, got %v", expected, result.Variables["results"])
+	}
+}
+
+func TestExecutor_ForeachConcurrency(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("slow", setVarHandler(50*time.Millisecond, "done", true))
+
+	wf := foreachWorkflow(map[string]interface{}{"items": "[1, 2, 3, 4]", "concurrency": 4}, Node{ID: "slow", Type: "slow"})
+
+	started := time.Now()
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	elapsed := time.Since(started)
+
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %+v", result.Status, result.Steps)
+	}
+	// The iterations sleep for 50ms each, so they must have run concurrently
+	if elapsed >= 150*time.Millisecond {
+		t.Errorf("Expected iterations to run concurrently, took %s", elapsed)
+	}
+}
+
+func TestExecutor_ForeachFailures(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("check", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		if wfVars["item"] == "bad" {
+			return fmt.Errorf("bad item")
+		}
+		return nil
+	}))
+	body := Node{ID: "check", Type: "check"}
+
+	tests := []struct {
+		name     string
+		metadata map[string]interface{}
+		inputs   map[string]interface{}
+		error    string
+		steps    int
+	}{
+		{
+			name:     "iteration fails",
+			metadata: map[string]interface{}{"items": "items"},
+			inputs:   map[string]interface{}{"items": []interface{}{"good", "bad", "good"}},
+			error:    "iteration 1 failed: node check failed: bad item",
+			// The third iteration never starts
+			steps: 4,
+		},
+		{
+			name:     "too many items",
+			metadata: map[string]interface{}{"items": "items", "maxIterations": 2},
+			inputs:   map[string]interface{}{"items": []interface{}{"a", "b", "c"}},
+			error:    "foreach over 3 items exceeds maxIterations 2",
+			steps:    2,
+		},
+		{
+			name:     "not a list",
+			metadata: map[string]interface{}{"items": "items"},
+			inputs:   map[string]interface{}{"items": "Sydney"},
+			error:    "items must be a list, got string",
+			steps:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := executor.Execute(context.Background(), foreachWorkflow(tt.metadata, body), tt.inputs)
+			if result.Status != "failed" || len(result.Steps) != tt.steps {
+				t.Fatalf("Expected a failed run with %d steps, got %s: %+v", tt.steps, result.Status, result.Steps)
+			}
+			last := result.Steps[len(result.Steps)-1]
+			if last.NodeID != "loop" || !strings.Contains(last.Error, tt.error) {
+				t.Errorf("Expected the foreach step to fail with %q, got %q", tt.error, last.Error)
+			}
+		})
+	}
+}
+
+func TestValidate_Foreach(t *testing.T) {
+	wf := foreachWorkflow(map[string]interface{}{"items": "cities", "concurrency": 0}, Node{ID: "end2", Type: "end"})
+	wf.Definition.Edges = wf.Definition.Edges[:1]
+	wf.Definition.Edges = append(wf.Definition.Edges, Edge{ID: "e-done", Source: "loop", Target: "end"})
+
+	codes := make(map[string]bool)
+	for _, d := range Validate(wf.Definition).Diagnostics {
+		codes[d.Code] = true
+	}
+	if !codes["missing_handle_edge"] || !codes["invalid_metadata"] {
+		t.Errorf("Expected missing item edge and invalid concurrency diagnostics, got %v", codes)
+	}
+}
@@ -0,0 +1,219 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Responses larger than this are rejected, so a misbehaving service cannot exhaust memory
+const maxHTTPResponseBytes = 10 << 20
+
+// The method of the request made by the http node, GET unless the node sets one
+func httpMethod(node *Node) string {
+	if m, ok := node.Data.Metadata["method"].(string); ok && m != "" {
+		return strings.ToUpper(m)
+	}
+	return http.MethodGet
+}
+
+// Whether the http node's request is idempotent, so it is safe to make again should the
+// run be interrupted while making it
+func idempotentHTTPNode(node *Node) bool {
+	switch httpMethod(node) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Process the http node, this will call an HTTP endpoint configured in the node metadata:
+//
+//   - method: the HTTP method, defaults to GET
+//   - url: the URL, a template with {{variable}} placeholders
+//   - headers, query: maps of names to value templates
+//   - body: a JSON body, either a string or a JSON value whose strings may contain placeholders
+//   - expectedStatus: the acceptable status codes, defaults to any 2xx status
+//   - responseMapping: maps output variables to selectors into the JSON response,
+//     e.g. {"temperature": "$.current_weather.temperature"}
+//   - responseVariable: stores the whole decoded response in a variable
+func (e *Executor) processHTTPNode(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	metadata := node.Data.Metadata
+	method := httpMethod(node)
+
+	rawURL, ok := metadata["url"].(string)
+	if !ok || rawURL == "" {
+		return fmt.Errorf("url not found in http node metadata")
+	}
+	target, err := RenderTemplate(rawURL, wfVars)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
+	reqURL, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", target, err)
+	}
+	if query, ok := metadata["query"].(map[string]interface{}); ok {
+		values := reqURL.Query()
+		for name, raw := range query {
+			value, err := renderTemplateValue(raw, wfVars)
+			if err != nil {
+				return fmt.Errorf("invalid query parameter %s: %w", name, err)
+			}
+			values.Set(name, stringify(value))
+		}
+		reqURL.RawQuery = values.Encode()
+	}
+
+	var body io.Reader
+	if rawBody, ok := metadata["body"]; ok && rawBody != nil {
+		payload, err := renderHTTPBody(rawBody, wfVars)
+		if err != nil {
+			return fmt.Errorf("invalid body: %w", err)
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL.String(), body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	if headers, ok := metadata["headers"].(map[string]interface{}); ok {
+		for name, raw := range headers {
+			value, err := renderTemplateValue(raw, wfVars)
+			if err != nil {
+				return fmt.Errorf("invalid header %s: %w", name, err)
+			}
+			req.Header.Set(name, stringify(value))
+		}
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(respBody) > maxHTTPResponseBytes {
+		return fmt.Errorf("response exceeds %d bytes", maxHTTPResponseBytes)
+	}
+
+	if !statusExpected(resp.StatusCode, metadata["expectedStatus"]) {
+		return &StatusError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("unexpected status %s - %s", resp.Status, truncate(string(respBody), 200)),
+		}
+	}
+
+	var decoded interface{}
+	if len(bytes.TrimSpace(respBody)) > 0 {
+		if err := json.Unmarshal(respBody, &decoded); err != nil {
+			// Non JSON responses can still be stored, but not mapped
+			decoded = string(respBody)
+		}
+	}
+
+	outputs := make(map[string]interface{})
+	if mapping, ok := metadata["responseMapping"].(map[string]interface{}); ok {
+		for variable, rawSelector := range mapping {
+			selector, ok := rawSelector.(string)
+			if !ok {
+				return fmt.Errorf("invalid selector for %s in responseMapping", variable)
+			}
+			value, err := selectJSON(decoded, selector)
+			if err != nil {
+				return fmt.Errorf("failed to map %s from response: %w", variable, err)
+			}
+			outputs[variable] = value
+		}
+	}
+	if variable, ok := metadata["responseVariable"].(string); ok && variable != "" {
+		outputs[variable] = decoded
+	}
+
+	// Store the mapped values in the variables
+	for k, v := range outputs {
+		wfVars[k] = v
+	}
+
+	step.Output = map[string]interface{}{
+		"method":     method,
+		"url":        reqURL.String(),
+		"statusCode": resp.StatusCode,
+		"outputs":    outputs,
+	}
+
+	return nil
+}
+
+// Check the status code against the expected status codes, which default to any 2xx status
+func statusExpected(status int, expected interface{}) bool {
+	codes, ok := toList(expected)
+	if !ok || len(codes) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, code := range codes {
+		if f, ok := toFloat(code); ok && int(f) == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Render the request body. String bodies are interpolated as they are,
+// other values have their strings interpolated and are encoded as JSON
+func renderHTTPBody(raw interface{}, wfVars map[string]interface{}) ([]byte, error) {
+	if s, ok := raw.(string); ok {
+		rendered, err := RenderTemplate(s, wfVars)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(rendered), nil
+	}
+
+	value, err := renderTemplateValue(raw, wfVars)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// Select a value from a decoded JSON document with a JSONPath-style selector,
+// such as $.current_weather.temperature or $.items[0].name
+func selectJSON(document interface{}, selector string) (interface{}, error) {
+	selector = strings.TrimSpace(selector)
+	switch {
+	case selector == "$" || selector == "":
+		return document, nil
+	case strings.HasPrefix(selector, "$"):
+	case strings.HasPrefix(selector, "["):
+		selector = "$" + selector
+	default:
+		selector = "$." + selector
+	}
+
+	return EvaluateExpression(selector, map[string]interface{}{"$": document})
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "... (" + strconv.Itoa(len(s)-max) + " more bytes)"
+}
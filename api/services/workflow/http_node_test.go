@@ -0,0 +1,148 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestExecutor_ProcessHTTPNode(t *testing.T) {
+	var received struct {
+		method string
+		path   string
+		query  string
+		auth   string
+		body   map[string]interface{}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the templated request posts
+		if r.Method == http.MethodPost {
+			received.method = r.Method
+			received.path = r.URL.Path
+			received.query = r.URL.Query().Get("city")
+			received.auth = r.Header.Get("Authorization")
+			data, _ := io.ReadAll(r.Body)
+			json.Unmarshal(data, &received.body)
+		}
+
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found"}`))
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ticket":{"id":42,"tags":["weather","alert"]}}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		metadata        map[string]interface{}
+		expectError     bool
+		expectedOutputs map[string]interface{}
+	}{
+		{
+			name: "templated request with response mapping",
+			metadata: map[string]interface{}{
+				"method":  "post",
+				"url":     server.URL + "/tickets/{{team}}",
+				"query":   map[string]interface{}{"city": "{{city}}"},
+				"headers": map[string]interface{}{"Authorization": "Bearer {{token}}"},
+				"body": map[string]interface{}{
+					"summary":     "Temperature in {{city}} is {{temperature}}",
+					"temperature": "{{temperature}}",
+				},
+				"expectedStatus": []interface{}{201.0},
+				"responseMapping": map[string]interface{}{
+					"ticketId":  "$.ticket.id",
+					"firstTag":  "ticket.tags[0]",
+					"ticketTag": "$.ticket.tags[1]",
+				},
+			},
+			expectedOutputs: map[string]interface{}{"ticketId": 42.0, "firstTag": "weather", "ticketTag": "alert"},
+		},
+		{
+			name: "unexpected status",
+			metadata: map[string]interface{}{
+				"url": server.URL + "/missing",
+			},
+			expectError: true,
+		},
+		{
+			name: "status not in expected list",
+			metadata: map[string]interface{}{
+				"url":            server.URL + "/tickets",
+				"expectedStatus": []interface{}{200.0},
+			},
+			expectError: true,
+		},
+		{
+			name: "missing variable in url",
+			metadata: map[string]interface{}{
+				"url": server.URL + "/{{unknown}}",
+			},
+			expectError: true,
+		},
+		{
+			name: "selector not in response",
+			metadata: map[string]interface{}{
+				"url":             server.URL + "/tickets",
+				"responseMapping": map[string]interface{}{"owner": "$.ticket.owner.name"},
+			},
+			expectError: true,
+		},
+		{
+			name:        "missing url",
+			metadata:    map[string]interface{}{},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := NewExecutor()
+			node := &Node{ID: "http", Type: "http", Data: NodeData{Metadata: tt.metadata}}
+			wfVars := map[string]interface{}{"city": "Sydney", "temperature": 30.5, "team": "ops", "token": "secret"}
+			step := &ExecutionStep{}
+
+			err := executor.processHTTPNode(context.Background(), node, wfVars, step)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(step.Output["outputs"], tt.expectedOutputs) {
+				t.Errorf("Expected outputs %v, got %v", tt.expectedOutputs, step.Output["outputs"])
+			}
+			for k, v := range tt.expectedOutputs {
+				if wfVars[k] != v {
+					t.Errorf("Expected variable %s to be %v, got %v", k, v, wfVars[k])
+				}
+			}
+		})
+	}
+
+	// The request sent for the first test case
+	if received.method != http.MethodPost || received.path != "/tickets/ops" {
+		t.Errorf("Unexpected request %s %s", received.method, received.path)
+	}
+	if received.query != "Sydney" || received.auth != "Bearer secret" {
+		t.Errorf("Unexpected query %q or authorization %q", received.query, received.auth)
+	}
+	expectedBody := map[string]interface{}{"summary": "Temperature in Sydney is 30.5", "temperature": 30.5}
+	if !reflect.DeepEqual(received.body, expectedBody) {
+		t.Errorf("Expected body %v, got %v", expectedBody, received.body)
+	}
+}
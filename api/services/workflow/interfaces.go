@@ -1,14 +1,81 @@
 package workflow
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // RepositoryInterface defines the interface for workflow repository operations
 type RepositoryInterface interface {
 	GetWorkflow(ctx context.Context, id string) (*Workflow, error)
 	SaveWorkflow(ctx context.Context, workflow *Workflow) error
+	CreateWorkflow(ctx context.Context, workflow *Workflow) error
+	UpdateWorkflow(ctx context.Context, workflow *Workflow) error
+	DeleteWorkflow(ctx context.Context, id string) error
+	ListWorkflows(ctx context.Context, opts ListWorkflowsOptions) ([]WorkflowSummary, int, error)
+
+	ListWorkflowVersions(ctx context.Context, workflowID string) ([]WorkflowVersion, error)
+	GetWorkflowVersion(ctx context.Context, workflowID string, version int) (*WorkflowVersion, error)
+	RollbackWorkflow(ctx context.Context, workflowID string, version int) (*Workflow, error)
+
+	SaveExecution(ctx context.Context, execution *Execution) error
+	AppendExecutionStep(ctx context.Context, execution *Execution, workerID string) error
+	GetExecution(ctx context.Context, id string) (*Execution, error)
+	ListExecutions(ctx context.Context, workflowID string, limit, offset int) ([]Execution, error)
+
+	EnqueueExecution(ctx context.Context, execution *Execution) error
+	StartExecution(ctx context.Context, execution *Execution, workerID string, lease time.Duration) error
+	ClaimExecution(ctx context.Context, workerID string, lease time.Duration) (*Execution, int, error)
+	RenewExecutionLease(ctx context.Context, id, workerID string, lease time.Duration) error
+	ReleaseExecution(ctx context.Context, id, workerID string) error
+	CompleteExecution(ctx context.Context, execution *Execution, workerID string) error
+	ResumeExecution(ctx context.Context, execution *Execution) error
+	ListDueExecutions(ctx context.Context, now time.Time) ([]Execution, error)
+
+	CreateSchedule(ctx context.Context, schedule *Schedule) error
+	GetSchedule(ctx context.Context, id string) (*Schedule, error)
+	ListSchedules(ctx context.Context, workflowID string) ([]Schedule, error)
+	SetSchedulePaused(ctx context.Context, id string, paused bool, nextRunAt time.Time) error
+	DeleteSchedule(ctx context.Context, id string) error
+	FireDueSchedules(ctx context.Context, now time.Time, fire ScheduleFireFunc) error
+
+	SaveWebhook(ctx context.Context, webhook *Webhook) error
+	GetWebhook(ctx context.Context, workflowID string) (*Webhook, error)
+	GetWebhookByToken(ctx context.Context, token string) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, workflowID string) error
+}
+
+// WorkflowStore loads the workflows subworkflow nodes run, and queues the runs they start
+// asynchronously. RepositoryInterface implements it
+type WorkflowStore interface {
+	GetWorkflow(ctx context.Context, id string) (*Workflow, error)
+	EnqueueExecution(ctx context.Context, execution *Execution) error
 }
 
 // ExecutorInterface defines the interface for workflow execution
 type ExecutorInterface interface {
 	Execute(ctx context.Context, workflow *Workflow, inputs map[string]interface{}) *ExecutionResponse
+	ExecuteWithProgress(ctx context.Context, workflow *Workflow, inputs map[string]interface{}, onStep func(ExecutionStep)) *ExecutionResponse
+	Resume(ctx context.Context, workflow *Workflow, state *RunState, onStep func(ExecutionStep)) *ExecutionResponse
+	Validate(graph WorkflowGraph) *ValidationResult
+}
+
+// NodeHandler defines the interface for executing a single node type.
+// Handlers read from and write to the shared workflow variables, and record
+// their results on the execution step.
+type NodeHandler interface {
+	Handle(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error
+}
+
+// NodeHandlerFunc allows an ordinary function to be used as a NodeHandler
+type NodeHandlerFunc func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error
+
+// Handle calls f(ctx, node, wfVars, step)
+func (f NodeHandlerFunc) Handle(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	return f(ctx, node, wfVars, step)
+}
+
+// Mailer delivers the emails sent by email nodes
+type Mailer interface {
+	Send(ctx context.Context, message *EmailMessage) (*DeliveryReceipt, error)
 }
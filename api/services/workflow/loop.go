@@ -0,0 +1,67 @@
+package workflow
+
+import "fmt"
+
+// Loop back-edges that do not set maxIterations may be followed this many times
+const defaultLoopIterations = 10
+
+// Runs that execute more steps than this fail, unless the executor sets another budget
+const defaultMaxSteps = 1000
+
+// WithMaxSteps sets the step budget of each run. A run fails once it has executed this
+// many steps, across all of its branches, so loops cannot run away. Zero means no budget.
+func WithMaxSteps(maxSteps int) ExecutorOption {
+	return func(e *Executor) {
+		e.maxSteps = maxSteps
+	}
+}
+
+// Count a step against the run's budget
+func (run *execution) spend() error {
+	if run.maxSteps > 0 && run.executed.Add(1) > int64(run.maxSteps) {
+		return fmt.Errorf("Step budget exceeded: the run executed more than %d steps", run.maxSteps)
+	}
+	return nil
+}
+
+// Follow a loop back-edge: count the iteration, failing once the loop has gone round too
+// many times, and forget the nodes of the loop body so they can run again. The body is
+// every node visited since the edge's target. Edges that are not loop edges are ignored.
+func (b *branch) loopBack(run *execution, edge Edge) error {
+	if edge.Loop == nil {
+		return nil
+	}
+
+	limit := edge.Loop.MaxIterations
+	if limit <= 0 {
+		limit = defaultLoopIterations
+	}
+	b.iterations[edge.ID]++
+	if b.iterations[edge.ID] > limit {
+		err := fmt.Errorf("Loop %s exceeded its limit of %d iterations", edge.ID, limit)
+		run.record(b, systemErrorStep(err.Error()))
+		return err
+	}
+
+	for i := len(b.path) - 1; i >= 0; i-- {
+		if b.path[i] != edge.Target {
+			continue
+		}
+		body := make(map[string]bool)
+		for _, id := range b.path[i:] {
+			delete(b.visited, id)
+			body[id] = true
+		}
+		b.path = b.path[:i]
+
+		// Loops nested in the body start counting again on each iteration of this one
+		for _, nested := range run.wf.Definition.Edges {
+			if nested.Loop != nil && nested.ID != edge.ID && body[nested.Source] {
+				delete(b.iterations, nested.ID)
+			}
+		}
+		break
+	}
+
+	return nil
+}
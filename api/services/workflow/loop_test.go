@@ -0,0 +1,178 @@
+package workflow
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A handler that increments the variable named in its metadata, and resets the
+// variable named by reset, if any
+var countHandler = NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	name := node.Data.Metadata["variable"].(string)
+	count, _ := wfVars[name].(float64)
+	wfVars[name] = count + 1
+	if reset, ok := node.Data.Metadata["reset"].(string); ok {
+		wfVars[reset] = 0.0
+	}
+	return nil
+})
+
+func countNode(id, variable string) Node {
+	return Node{ID: id, Type: "count", Data: NodeData{Metadata: map[string]interface{}{"variable": variable}}}
+}
+
+func checkNode(id, expression string) Node {
+	return Node{ID: id, Type: "condition", Data: NodeData{Metadata: map[string]interface{}{"conditionExpression": expression}}}
+}
+
+// Build a polling loop: check the status, and go round again until it is done
+func pollingWorkflow(doneAfter string, loop *EdgeLoop) *Workflow {
+	return &Workflow{ID: "polling", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			countNode("poll", "attempts"),
+			checkNode("done", "attempts >= "+doneAfter),
+			{ID: "end", Type: "end"},
+		},
+		Edges: []Edge{
+			{ID: "e-start", Source: "start", Target: "poll"},
+			{ID: "e-check", Source: "poll", Target: "done"},
+			{ID: "e-done", Source: "done", SourceHandle: "true", Target: "end"},
+			{ID: "e-retry", Source: "done", SourceHandle: "false", Target: "poll", Loop: loop},
+		},
+	}}
+}
+
+func stepTrace(steps []ExecutionStep) []string {
+	var trace []string
+	for _, step := range steps {
+		trace = append(trace, step.NodeID+"#"+strconv.Itoa(step.Iteration))
+	}
+	return trace
+}
+
+func TestExecutor_LoopBackEdge(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("count", countHandler)
+
+	result := executor.Execute(context.Background(), pollingWorkflow("3", &EdgeLoop{MaxIterations: 5}), map[string]interface{}{})
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %+v", result.Status, result.Steps)
+	}
+
+	expected := []string{"start#0", "poll#0", "done#0", "poll#1", "done#1", "poll#2", "done#2", "end#0"}
+	if trace := stepTrace(result.Steps); !reflect.DeepEqual(trace, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, trace)
+	}
+	if result.Variables["attempts"] != 3.0 {
+		t.Errorf("Expected 3 attempts, got %v", result.Variables["attempts"])
+	}
+}
+
+func TestExecutor_LoopLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow *Workflow
+		options  []ExecutorOption
+		error    string
+		steps    int
+	}{
+		{
+			name:     "iteration cap",
+			workflow: pollingWorkflow("100", &EdgeLoop{MaxIterations: 2}),
+			error:    "Loop e-retry exceeded its limit of 2 iterations",
+			// start, then three rounds of poll and done, then the error
+			steps: 8,
+		},
+		{
+			name:     "default iteration cap",
+			workflow: pollingWorkflow("100", &EdgeLoop{}),
+			error:    "Loop e-retry exceeded its limit of 10 iterations",
+			steps:    24,
+		},
+		{
+			name:     "step budget",
+			workflow: pollingWorkflow("100", &EdgeLoop{MaxIterations: 100}),
+			options:  []ExecutorOption{WithMaxSteps(5)},
+			error:    "Step budget exceeded: the run executed more than 5 steps",
+			steps:    6,
+		},
+		{
+			name:     "cycle without a back-edge",
+			workflow: pollingWorkflow("100", nil),
+			error:    "Cycle detected: node poll visited twice",
+			steps:    4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := NewExecutor(tt.options...)
+			executor.RegisterNodeType("count", countHandler)
+
+			result := executor.Execute(context.Background(), tt.workflow, map[string]interface{}{})
+			if result.Status != "failed" || len(result.Steps) != tt.steps {
+				t.Fatalf("Expected a failed run with %d steps, got %s with %d: %v", tt.steps, result.Status, len(result.Steps), stepTrace(result.Steps))
+			}
+			last := result.Steps[len(result.Steps)-1]
+			if last.NodeID != "system" || !strings.Contains(last.Error, tt.error) {
+				t.Errorf("Expected error %q, got %q", tt.error, last.Error)
+			}
+		})
+	}
+}
+
+func TestExecutor_NestedLoops(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("count", countHandler)
+
+	outer := countNode("outer", "i")
+	outer.Data.Metadata["reset"] = "j"
+
+	// The inner loop may only go round once per iteration of the outer loop
+	wf := &Workflow{ID: "nested", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			outer,
+			countNode("inner", "j"),
+			checkNode("inner-done", "j >= 2"),
+			checkNode("outer-done", "i >= 2"),
+			{ID: "end", Type: "end"},
+		},
+		Edges: []Edge{
+			{ID: "e-start", Source: "start", Target: "outer"},
+			{ID: "e-outer", Source: "outer", Target: "inner"},
+			{ID: "e-inner", Source: "inner", Target: "inner-done"},
+			{ID: "e-inner-again", Source: "inner-done", SourceHandle: "false", Target: "inner", Loop: &EdgeLoop{MaxIterations: 1}},
+			{ID: "e-inner-done", Source: "inner-done", SourceHandle: "true", Target: "outer-done"},
+			{ID: "e-outer-again", Source: "outer-done", SourceHandle: "false", Target: "outer", Loop: &EdgeLoop{MaxIterations: 1}},
+			{ID: "e-outer-done", Source: "outer-done", SourceHandle: "true", Target: "end"},
+		},
+	}}
+
+	if result := executor.Validate(wf.Definition); !result.Valid {
+		t.Fatalf("Expected the nested loops to be valid, got %+v", result.Diagnostics)
+	}
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %v", result.Status, stepTrace(result.Steps))
+	}
+	if result.Variables["i"] != 2.0 || result.Variables["j"] != 2.0 {
+		t.Errorf("Expected both loops to finish, got %v", result.Variables)
+	}
+}
+
+func TestValidate_LoopEdge(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("count", countHandler)
+
+	wf := pollingWorkflow("3", &EdgeLoop{MaxIterations: -1})
+	result := executor.Validate(wf.Definition)
+	if result.Valid || len(result.Diagnostics) != 1 || result.Diagnostics[0].Code != "invalid_loop" || result.Diagnostics[0].EdgeID != "e-retry" {
+		t.Errorf("Expected an invalid loop diagnostic, got %+v", result.Diagnostics)
+	}
+}
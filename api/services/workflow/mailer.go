@@ -0,0 +1,320 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The from address used when neither the email node nor the mailer configures one
+const defaultFromAddress = "weather-alerts@example.com"
+
+// Delivery statuses reported by the mailers
+const (
+	DeliveryStatusSent   = "sent"
+	DeliveryStatusOutbox = "outbox"
+)
+
+// SMTP connection security modes
+const (
+	SMTPSecurityNone     = "none"
+	SMTPSecurityStartTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+)
+
+// EmailMessage is a plain text email. An empty From is filled in with the mailer's default
+type EmailMessage struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// DeliveryReceipt reports what happened to a sent email
+type DeliveryReceipt struct {
+	MessageID string
+	Status    string
+	SentAt    time.Time
+}
+
+// SMTPConfig configures the SMTP mailer
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	// Security is one of none, starttls or tls, it defaults to starttls
+	Security string
+	Timeout  time.Duration
+}
+
+// SMTPMailer delivers emails to an SMTP server
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+func NewSMTPMailer(config SMTPConfig) (*SMTPMailer, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("smtp host is required")
+	}
+	if config.Security == "" {
+		config.Security = SMTPSecurityStartTLS
+	}
+	if config.Security != SMTPSecurityNone && config.Security != SMTPSecurityStartTLS && config.Security != SMTPSecurityTLS {
+		return nil, fmt.Errorf("unknown smtp security mode: %s", config.Security)
+	}
+	if config.Port == 0 {
+		config.Port = 587
+		if config.Security == SMTPSecurityTLS {
+			config.Port = 465
+		}
+	}
+	if config.From == "" {
+		config.From = defaultFromAddress
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &SMTPMailer{config: config}, nil
+}
+
+// Send delivers the email, the receipt is only returned once the server has accepted it
+func (m *SMTPMailer) Send(ctx context.Context, message *EmailMessage) (*DeliveryReceipt, error) {
+	if message.From == "" {
+		message.From = m.config.From
+	}
+	data, messageID, err := buildEmail(message, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	from, _ := mail.ParseAddress(message.From)
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if m.config.Username != "" {
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return nil, fmt.Errorf("smtp authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return nil, fmt.Errorf("smtp server rejected sender: %w", err)
+	}
+	for _, to := range message.To {
+		// The envelope takes the bare address of recipients given with a name, which were
+		// checked when the email was built
+		addr, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(addr.Address); err != nil {
+			return nil, fmt.Errorf("smtp server rejected recipient %s: %w", addr.Address, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("smtp server rejected message: %w", err)
+	}
+	if err := client.Quit(); err != nil {
+		return nil, err
+	}
+
+	return &DeliveryReceipt{MessageID: messageID, Status: DeliveryStatusSent, SentAt: time.Now()}, nil
+}
+
+// Connect to the SMTP server, securing the connection as configured
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	tlsConfig := &tls.Config{ServerName: m.config.Host}
+	dialer := &net.Dialer{Timeout: m.config.Timeout}
+
+	var conn net.Conn
+	var err error
+	if m.config.Security == SMTPSecurityTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+
+	// Bound the whole conversation, not just the dial
+	deadline := time.Now().Add(m.config.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if m.config.Security == SMTPSecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("starttls failed: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// The number of emails an OutboxMailer without a directory keeps in memory
+const maxOutboxMessages = 100
+
+// OutboxMailer stores emails instead of delivering them, for development. Emails are
+// written to the directory as .eml files, or if there is no directory the most recent
+// maxOutboxMessages are kept in memory.
+type OutboxMailer struct {
+	dir string
+
+	mu       sync.Mutex
+	messages []EmailMessage
+}
+
+func NewOutboxMailer(dir string) *OutboxMailer {
+	return &OutboxMailer{dir: dir}
+}
+
+func (m *OutboxMailer) Send(ctx context.Context, message *EmailMessage) (*DeliveryReceipt, error) {
+	if message.From == "" {
+		message.From = defaultFromAddress
+	}
+	sentAt := time.Now()
+	data, messageID, err := buildEmail(message, sentAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.dir != "" {
+		if err := os.MkdirAll(m.dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create outbox: %w", err)
+		}
+		name := sentAt.Format("20060102T150405") + "-" + strings.Trim(strings.SplitN(messageID, "@", 2)[0], "<") + ".eml"
+		if err := os.WriteFile(filepath.Join(m.dir, name), data, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write email to outbox: %w", err)
+		}
+	} else {
+		m.mu.Lock()
+		if len(m.messages) >= maxOutboxMessages {
+			m.messages = append(m.messages[:0], m.messages[len(m.messages)-maxOutboxMessages+1:]...)
+		}
+		m.messages = append(m.messages, *message)
+		m.mu.Unlock()
+	}
+
+	return &DeliveryReceipt{MessageID: messageID, Status: DeliveryStatusOutbox, SentAt: sentAt}, nil
+}
+
+// Messages returns the emails kept in memory, oldest first. It is empty when the outbox
+// writes to a directory.
+func (m *OutboxMailer) Messages() []EmailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]EmailMessage(nil), m.messages...)
+}
+
+// NewMailerFromEnv creates the mailer configured by the environment. SMTP_HOST selects the
+// SMTP mailer (with SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM and SMTP_SECURITY),
+// otherwise emails are written to MAIL_OUTBOX_DIR, or the last few are kept in memory.
+// Either way nothing is delivered, which is logged as a warning.
+func NewMailerFromEnv() (Mailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir != "" {
+			slog.Warn("SMTP_HOST is not set, emails will not be delivered and are written to the outbox instead", "dir", dir)
+		} else {
+			slog.Warn("SMTP_HOST and MAIL_OUTBOX_DIR are not set, emails will not be delivered and only the last few are kept in memory", "kept", maxOutboxMessages)
+		}
+		return NewOutboxMailer(dir), nil
+	}
+
+	config := SMTPConfig{
+		Host:     host,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		Security: os.Getenv("SMTP_SECURITY"),
+	}
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT: %s", port)
+		}
+		config.Port = p
+	}
+
+	return NewSMTPMailer(config)
+}
+
+// Build the RFC 5322 message, returning it with its Message-ID
+func buildEmail(message *EmailMessage, date time.Time) ([]byte, string, error) {
+	if len(message.To) == 0 {
+		return nil, "", fmt.Errorf("email has no recipients")
+	}
+	from, err := mail.ParseAddress(message.From)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid from address %q: %w", message.From, err)
+	}
+	to := make([]string, len(message.To))
+	for i, recipient := range message.To {
+		addr, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid recipient %q: %w", recipient, err)
+		}
+		to[i] = addr.String()
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	messageID := fmt.Sprintf("<%s@%s>", uuid.NewString(), domain)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: %s\r\n", messageID)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+	buf.WriteString("\r\n")
+
+	return buf.Bytes(), messageID, nil
+}
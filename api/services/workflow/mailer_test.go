@@ -0,0 +1,277 @@
+package workflow
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMTPServer is a minimal in-process SMTP server that records what it receives
+type fakeSMTPServer struct {
+	listener net.Listener
+
+	mu sync.Mutex
+	// rejectRcpt makes the server reject every recipient
+	rejectRcpt bool
+	auth       string
+	from       string
+	to         []string
+	data       string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &fakeSMTPServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP fake")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		s.mu.Lock()
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH PLAIN "):
+			decoded, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			s.auth = string(decoded)
+			reply("235 Authenticated")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.from = line[len("MAIL FROM:"):]
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			if s.rejectRcpt {
+				reply("550 No such user")
+				break
+			}
+			s.to = append(s.to, line[len("RCPT TO:"):])
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 Send data")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					s.mu.Unlock()
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.data = data.String()
+			reply("250 Queued")
+		case command == "QUIT":
+			reply("221 Bye")
+			s.mu.Unlock()
+			return
+		default:
+			reply("250 OK")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	mailer, err := NewSMTPMailer(SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     server.port(),
+		Username: "alerts",
+		Password: "secret",
+		From:     "Weather Alerts <alerts@example.com>",
+		Security: SMTPSecurityNone,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	receipt, err := mailer.Send(context.Background(), &EmailMessage{
+		To:      []string{"john@example.com", "Jane Doe <jane@example.com>"},
+		Subject: "Weather Alert",
+		Body:    "Weather alert for Sydney!\nTemperature is 30.5°C!",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if receipt.Status != DeliveryStatusSent {
+		t.Errorf("Expected status sent, got %s", receipt.Status)
+	}
+	if !strings.HasSuffix(receipt.MessageID, "@example.com>") {
+		t.Errorf("Expected message id for the from domain, got %s", receipt.MessageID)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.auth != "\x00alerts\x00secret" {
+		t.Errorf("Expected plain auth credentials, got %q", server.auth)
+	}
+	if server.from != "<alerts@example.com>" || len(server.to) != 2 || server.to[0] != "<john@example.com>" || server.to[1] != "<jane@example.com>" {
+		t.Errorf("Unexpected envelope from %s to %v", server.from, server.to)
+	}
+	for _, expected := range []string{
+		"From: \"Weather Alerts\" <alerts@example.com>\r\n",
+		"To: <john@example.com>, \"Jane Doe\" <jane@example.com>\r\n",
+		"Subject: Weather Alert\r\n",
+		"Message-ID: " + receipt.MessageID + "\r\n",
+		"\r\n\r\nWeather alert for Sydney!\r\nTemperature is 30.5°C!\r\n",
+	} {
+		if !strings.Contains(server.data, expected) {
+			t.Errorf("Expected message to contain %q, got:\n%s", expected, server.data)
+		}
+	}
+}
+
+func TestSMTPMailer_Errors(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	server.rejectRcpt = true
+
+	mailer, _ := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: server.port(), Security: SMTPSecurityNone})
+	if _, err := mailer.Send(context.Background(), &EmailMessage{To: []string{"nobody@example.com"}}); err == nil || !strings.Contains(err.Error(), "rejected recipient") {
+		t.Errorf("Expected rejected recipient error, got %v", err)
+	}
+
+	// The fake server does not offer STARTTLS, so the mailer must refuse to send in the clear
+	mailer, _ = NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: server.port()})
+	if _, err := mailer.Send(context.Background(), &EmailMessage{To: []string{"john@example.com"}}); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Expected STARTTLS error, got %v", err)
+	}
+
+	if _, err := mailer.Send(context.Background(), &EmailMessage{To: []string{"not an address"}}); err == nil {
+		t.Error("Expected invalid recipient error")
+	}
+
+	if _, err := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Security: "ssl"}); err == nil {
+		t.Error("Expected unknown security mode error")
+	}
+}
+
+func TestOutboxMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewOutboxMailer(dir)
+
+	receipt, err := mailer.Send(context.Background(), &EmailMessage{
+		To:      []string{"john@example.com"},
+		Subject: "Wetter über 30°C",
+		Body:    "Hot!",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if receipt.Status != DeliveryStatusOutbox {
+		t.Errorf("Expected status outbox, got %s", receipt.Status)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one email in the outbox, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "Subject: =?utf-8?q?Wetter_=C3=BCber_30=C2=B0C?=") {
+		t.Errorf("Expected encoded subject, got:\n%s", data)
+	}
+
+	if !strings.Contains(string(data), "From: <"+defaultFromAddress+">") {
+		t.Errorf("Expected the default from address, got:\n%s", data)
+	}
+
+	// Emails written to the directory are not also kept in memory
+	if messages := mailer.Messages(); len(messages) != 0 {
+		t.Errorf("Expected no messages in memory, got %d", len(messages))
+	}
+}
+
+func TestOutboxMailer_KeepsRecentMessages(t *testing.T) {
+	mailer := NewOutboxMailer("")
+
+	for i := 0; i < maxOutboxMessages+5; i++ {
+		if _, err := mailer.Send(context.Background(), &EmailMessage{
+			To:      []string{"john@example.com"},
+			Subject: fmt.Sprintf("Alert %d", i),
+		}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	messages := mailer.Messages()
+	if len(messages) != maxOutboxMessages {
+		t.Fatalf("Expected %d messages, got %d", maxOutboxMessages, len(messages))
+	}
+	if messages[0].Subject != "Alert 5" || messages[len(messages)-1].Subject != fmt.Sprintf("Alert %d", maxOutboxMessages+4) {
+		t.Errorf("Expected the most recent messages, got %s to %s", messages[0].Subject, messages[len(messages)-1].Subject)
+	}
+}
+
+func TestExecutor_EmailNodeUsesMailer(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	mailer, _ := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: server.port(), Security: SMTPSecurityNone})
+	executor := NewExecutor(WithMailer(mailer))
+
+	node := &Node{ID: "email", Type: "email", Data: NodeData{Metadata: map[string]interface{}{
+		"emailTemplate": map[string]interface{}{
+			"from":    "ops@example.org",
+			"subject": "Alert for {{city}}",
+			"body":    "Temperature is {{temperature}}",
+		},
+	}}}
+	vars := map[string]interface{}{"email": "john@example.com", "city": "Sydney", "temperature": 30.5, "conditionMet": true}
+
+	step := executor.executeNode(context.Background(), node, vars)
+	if step.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %s", step.Status, step.Error)
+	}
+	if step.Output["deliveryStatus"] != DeliveryStatusSent {
+		t.Errorf("Expected delivery status sent, got %v", step.Output["deliveryStatus"])
+	}
+	if id, _ := step.Output["messageId"].(string); !strings.HasSuffix(id, "@example.org>") {
+		t.Errorf("Expected the real message id, got %v", step.Output["messageId"])
+	}
+
+	// Delivery failures fail the step
+	server.mu.Lock()
+	server.rejectRcpt = true
+	server.mu.Unlock()
+	step = executor.executeNode(context.Background(), node, vars)
+	if step.Status != "failed" || !strings.Contains(step.Error, "failed to send email") {
+		t.Errorf("Expected send failure, got %s: %s", step.Status, step.Error)
+	}
+}
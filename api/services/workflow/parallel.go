@@ -0,0 +1,448 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Join modes, a join either waits for every forked branch that reaches it,
+// or continues as soon as the first branch arrives and cancels the rest
+const (
+	JoinModeAll = "all"
+	JoinModeAny = "any"
+)
+
+// Conflict policies for variables set to different values by several branches
+const (
+	ConflictLastWins  = "last_wins"
+	ConflictFirstWins = "first_wins"
+	ConflictFail      = "fail"
+)
+
+// execution holds the state shared by every branch of a single workflow run
+type execution struct {
+	wf      *Workflow
+	nodeMap map[string]*Node
+	// onStep is called as each step is recorded, it may be nil
+	onStep func(ExecutionStep)
+	// maxSteps is the step budget of the run, and executed counts the steps run so far
+	// by every branch
+	maxSteps int
+	executed atomic.Int64
+	// timeout is the longest the run may take, and deadline when it runs out. Both are
+	// zero if the run is not limited
+	timeout  time.Duration
+	deadline time.Time
+	// state is set when the run stops at a waiting node
+	state *RunState
+	// recovering is set when the run resumes from a checkpoint after an interruption,
+	// until the next checkpoint. Nodes run meanwhile may have run before
+	recovering atomic.Bool
+}
+
+func newExecution(wf *Workflow) *execution {
+	nodes := wf.Definition.Nodes
+	nodeMap := make(map[string]*Node)
+
+	// Create a map of nodes by ID for quick lookup
+	// Ideal for O(1) lookup time, especially for large workflows
+	for i := range nodes {
+		nodeMap[nodes[i].ID] = &nodes[i]
+	}
+
+	return &execution{wf: wf, nodeMap: nodeMap}
+}
+
+// Record a step on the branch, and report it to the observer. Steps of branches the run
+// no longer waits for are dropped
+func (run *execution) record(b *branch, step ExecutionStep) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running = nil
+	if b.isDetached() {
+		return
+	}
+	b.steps = append(b.steps, step)
+	if run.onStep != nil {
+		run.onStep(step)
+	}
+}
+
+// branch is a single path of execution through the workflow graph, with its own
+// copy of the workflow variables and its own trail of steps
+type branch struct {
+	name    string
+	vars    map[string]interface{}
+	steps   []ExecutionStep
+	visited map[string]bool
+	// path holds the nodes in visited in the order they were visited, so following a
+	// loop back-edge can forget the nodes of the loop body
+	path []string
+	// visits counts how many times each node has run, for the iteration of its steps
+	visits map[string]int
+	// iterations counts how many times each loop back-edge has been followed
+	iterations map[string]int
+	// forked branches stop when they reach a join node
+	forked bool
+	// loop is the foreach node whose body the branch is iterating, if any
+	loop string
+	// root is set on the main branch of the run
+	root bool
+	// parent is the branch this one was started from, if any
+	parent *branch
+
+	// mu guards steps and running, which the fork that started the branch reads when
+	// it stops waiting for the branch while it is still running. detached is set once
+	// it has, the branch's steps are no longer recorded from then on
+	mu       sync.Mutex
+	running  *Node
+	detached atomic.Bool
+}
+
+func newBranch(name string, vars map[string]interface{}) *branch {
+	return &branch{
+		name:       name,
+		vars:       vars,
+		steps:      []ExecutionStep{},
+		visited:    make(map[string]bool),
+		visits:     make(map[string]int),
+		iterations: make(map[string]int),
+	}
+}
+
+// Start a branch of this one, which knows where this branch has been
+func (b *branch) child(name string, vars map[string]interface{}) *branch {
+	child := newBranch(name, vars)
+	for k, v := range b.visited {
+		child.visited[k] = v
+	}
+	child.path = append([]string(nil), b.path...)
+	for k, v := range b.visits {
+		child.visits[k] = v
+	}
+	for k, v := range b.iterations {
+		child.iterations[k] = v
+	}
+	child.loop = b.loop
+	child.parent = b
+	return child
+}
+
+// Note the node the branch is running, until its step is recorded
+func (b *branch) start(node *Node) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running = node
+}
+
+// Add the steps of the branches started from this one
+func (b *branch) appendSteps(steps []ExecutionStep) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.isDetached() {
+		b.steps = append(b.steps, steps...)
+	}
+}
+
+// Whether the run stopped waiting for the branch, or a branch it was started from
+func (b *branch) isDetached() bool {
+	for ; b != nil; b = b.parent {
+		if b.detached.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop waiting for the branch, returning the steps it recorded so far and the node it is
+// still running, if any
+func (b *branch) detach() ([]ExecutionStep, *Node) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.detached.Store(true)
+	return append([]ExecutionStep(nil), b.steps...), b.running
+}
+
+// Mark the node as visited, failing if the branch has already been there
+func (b *branch) visit(run *execution, node *Node) error {
+	if b.visited[node.ID] {
+		err := fmt.Errorf("Cycle detected: node %s visited twice", node.ID)
+		run.record(b, systemErrorStep(err.Error()))
+		return err
+	}
+	b.visited[node.ID] = true
+	b.path = append(b.path, node.ID)
+	return nil
+}
+
+// branchResult is reported by a forked branch once it stops
+type branchResult struct {
+	index int
+	join  *Node
+	err   error
+}
+
+// Run each edge as a concurrent branch. Branches run until they end, fail or reach a join
+// node. The variables of the branches that reached the join are merged into the parent
+// branch, which continues from the join. Returns a nil join if every branch ended.
+func (e *Executor) fork(ctx context.Context, run *execution, parent *branch, edges []Edge) (*Node, *ExecutionStep, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	snapshot := copyVars(parent.vars)
+	children := make([]*branch, len(edges))
+	results := make([]branchResult, len(edges))
+	done := make(chan branchResult, len(edges))
+
+	for i, edge := range edges {
+		children[i] = parent.child(branchName(parent.name, edge.ID), copyVars(snapshot))
+		children[i].forked = true
+		// Until the branch gets going, it is about to run the target of its edge
+		children[i].start(run.nodeMap[edge.Target])
+
+		go func(i int, child *branch, edge Edge) {
+			if err := child.loopBack(run, edge); err != nil {
+				done <- branchResult{index: i, err: err}
+				return
+			}
+			join, err := e.walk(ctx, run, child, run.nodeMap[edge.Target])
+			done <- branchResult{index: i, join: join, err: err}
+		}(i, children[i], edge)
+	}
+
+	// Collect the results as the branches stop. A failure cancels the other branches, as
+	// does the first branch to reach a join that only waits for any branch
+	var failure error
+	winner := -1
+	finished := make(map[int]bool)
+	cancelled := make(map[int]bool)
+
+	for range edges {
+		result := <-done
+		results[result.index] = result
+		finished[result.index] = true
+
+		switch {
+		case failure != nil:
+			if result.err != nil {
+				cancelled[result.index] = true
+			}
+		case result.err != nil:
+			failure = result.err
+			cancel()
+		case result.join != nil && joinMode(result.join) == JoinModeAny:
+			winner = result.index
+			cancel()
+		}
+		if winner >= 0 {
+			break
+		}
+	}
+
+	// Record the steps of every branch in edge order, so the trace is deterministic. The
+	// join does not wait for the branches that lost it, they are cancelled and left to stop
+	for i, child := range children {
+		if finished[i] {
+			if cancelled[i] {
+				markCancelled(child.steps)
+			}
+			parent.appendSteps(child.steps)
+			continue
+		}
+
+		steps, running := child.detach()
+		markCancelled(steps)
+		if running != nil {
+			steps = append(steps, ExecutionStep{
+				NodeID:      running.ID,
+				Type:        running.Type,
+				Label:       running.Data.Label,
+				Description: running.Data.Description,
+				Status:      "cancelled",
+				Error:       fmt.Sprintf("Cancelled, branch %s reached join %s first", children[winner].name, results[winner].join.ID),
+				StartedAt:   time.Now(),
+				Branch:      child.name,
+			})
+		}
+		parent.appendSteps(steps)
+	}
+
+	if failure != nil {
+		return nil, nil, failure
+	}
+
+	// Find the join the branches reached, they must all reach the same one
+	var join *Node
+	var arrived []int
+	for i, result := range results {
+		if result.join == nil || cancelled[i] {
+			continue
+		}
+		if join != nil && join.ID != result.join.ID {
+			err := fmt.Errorf("parallel branches reached different join nodes: %s and %s", join.ID, result.join.ID)
+			run.record(parent, systemErrorStep(err.Error()))
+			return nil, nil, err
+		}
+		join = result.join
+		arrived = append(arrived, i)
+	}
+
+	if join == nil {
+		return nil, nil, nil
+	}
+
+	if err := parent.visit(run, join); err != nil {
+		return nil, nil, err
+	}
+
+	mode := joinMode(join)
+	if mode == JoinModeAny {
+		arrived = []int{winner}
+	}
+
+	branchVars := make([]map[string]interface{}, 0, len(arrived))
+	branchNames := make([]string, 0, len(arrived))
+	for _, i := range arrived {
+		branchVars = append(branchVars, children[i].vars)
+		branchNames = append(branchNames, children[i].name)
+	}
+
+	policy, _ := join.Data.Metadata["conflictPolicy"].(string)
+	if policy == "" {
+		policy = ConflictLastWins
+	}
+
+	step := ExecutionStep{
+		NodeID:      join.ID,
+		Type:        join.Type,
+		Label:       join.Data.Label,
+		Description: join.Data.Description,
+		Status:      "completed",
+		Branch:      parent.name,
+		StartedAt:   time.Now(),
+	}
+
+	changes, conflicts, err := mergeBranchVars(snapshot, branchVars, policy)
+	step.Output = map[string]interface{}{
+		"mode":      mode,
+		"branches":  branchNames,
+		"conflicts": conflicts,
+		"message":   fmt.Sprintf("Joined %d of %d branches", len(arrived), len(edges)),
+	}
+	if err != nil {
+		step.Status = "failed"
+		step.Error = err.Error()
+		run.record(parent, step)
+		return nil, nil, err
+	}
+
+	for k, v := range changes {
+		parent.vars[k] = v
+	}
+	run.checkpoint(parent, join, &step)
+	run.record(parent, step)
+
+	return join, &step, nil
+}
+
+// Merge the variables changed by each branch, relative to the snapshot taken when the
+// branches were forked. Branches are merged in order, and variables set to different
+// values by several branches are resolved with the conflict policy.
+func mergeBranchVars(snapshot map[string]interface{}, branches []map[string]interface{}, policy string) (map[string]interface{}, []string, error) {
+	if policy != ConflictLastWins && policy != ConflictFirstWins && policy != ConflictFail {
+		return nil, nil, fmt.Errorf("unknown conflict policy: %s", policy)
+	}
+
+	changes := make(map[string]interface{})
+	conflicted := make(map[string]bool)
+
+	for _, vars := range branches {
+		for k, v := range vars {
+			if old, ok := snapshot[k]; ok && reflect.DeepEqual(old, v) {
+				continue
+			}
+
+			if prev, seen := changes[k]; seen && !reflect.DeepEqual(prev, v) {
+				conflicted[k] = true
+				if policy == ConflictFirstWins {
+					continue
+				}
+			}
+			changes[k] = v
+		}
+	}
+
+	conflicts := make([]string, 0, len(conflicted))
+	for k := range conflicted {
+		conflicts = append(conflicts, k)
+	}
+	sort.Strings(conflicts)
+
+	if policy == ConflictFail && len(conflicts) > 0 {
+		return nil, conflicts, fmt.Errorf("branches set conflicting values for: %s", strings.Join(conflicts, ", "))
+	}
+
+	return changes, conflicts, nil
+}
+
+func joinMode(join *Node) string {
+	if mode, ok := join.Data.Metadata["mode"].(string); ok && mode == JoinModeAny {
+		return JoinModeAny
+	}
+	return JoinModeAll
+}
+
+// Steps interrupted because another branch won the join are marked as cancelled
+func markCancelled(steps []ExecutionStep) {
+	for i := range steps {
+		if steps[i].Status == "failed" {
+			steps[i].Status = "cancelled"
+		}
+	}
+}
+
+func branchName(parent, edgeID string) string {
+	if parent == "" {
+		return edgeID
+	}
+	return parent + "/" + edgeID
+}
+
+// Copy the variables, along with the maps and lists nested in them, so branches started
+// with the copy can change them without the change showing in each other's variables
+func copyVars(vars map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		copied[k] = copyValue(v)
+	}
+	return copied
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyVars(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	case map[string]string:
+		copied := make(map[string]string, len(v))
+		for k, item := range v {
+			copied[k] = item
+		}
+		return copied
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return value
+	}
+}
@@ -0,0 +1,297 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Build a workflow that forks from start into one branch per node, then joins
+func forkJoinWorkflow(joinMetadata map[string]interface{}, branchTypes ...string) *Workflow {
+	nodes := []Node{
+		{ID: "start", Type: "start"},
+		{ID: "join", Type: "join", Data: NodeData{Label: "Join", Metadata: joinMetadata}},
+		{ID: "end", Type: "end"},
+	}
+	edges := []Edge{{ID: "e-join", Source: "join", Target: "end"}}
+
+	for i, nodeType := range branchTypes {
+		id := fmt.Sprintf("b%d", i)
+		nodes = append(nodes, Node{ID: id, Type: nodeType})
+		edges = append(edges,
+			Edge{ID: "e-" + id, Source: "start", Target: id},
+			Edge{ID: "e-" + id + "-join", Source: id, Target: "join"},
+		)
+	}
+
+	return &Workflow{ID: "parallel", Definition: WorkflowGraph{Nodes: nodes, Edges: edges}}
+}
+
+// A handler that sleeps, then sets a variable
+func setVarHandler(delay time.Duration, key string, value interface{}) NodeHandler {
+	return NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wfVars[key] = value
+		return nil
+	})
+}
+
+func TestExecutor_ForkJoinAll(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("weather", setVarHandler(50*time.Millisecond, "temperature", 30.0))
+	executor.RegisterNodeType("news", setVarHandler(50*time.Millisecond, "headline", "Heatwave"))
+	executor.RegisterNodeType("check", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		if wfVars["temperature"] != 30.0 || wfVars["headline"] != "Heatwave" {
+			return fmt.Errorf("branch variables were not merged: %v", wfVars)
+		}
+		return nil
+	}))
+
+	wf := forkJoinWorkflow(nil, "weather", "news")
+	wf.Definition.Nodes = append(wf.Definition.Nodes, Node{ID: "check", Type: "check"})
+	wf.Definition.Edges[0] = Edge{ID: "e-join", Source: "join", Target: "check"}
+	wf.Definition.Edges = append(wf.Definition.Edges, Edge{ID: "e-check", Source: "check", Target: "end"})
+
+	started := time.Now()
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	elapsed := time.Since(started)
+
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %+v", result.Status, result.Steps)
+	}
+	// The branches sleep for 50ms each, so they must have run concurrently
+	if elapsed >= 100*time.Millisecond {
+		t.Errorf("Expected branches to run concurrently, took %s", elapsed)
+	}
+
+	var order []string
+	for _, step := range result.Steps {
+		order = append(order, step.NodeID+"@"+step.Branch)
+	}
+	expected := []string{"start@", "b0@e-b0", "b1@e-b1", "join@", "check@", "end@"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, order)
+	}
+}
+
+func TestExecutor_ForkJoinAny(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("fast", setVarHandler(0, "source", "fast"))
+	executor.RegisterNodeType("slow", setVarHandler(time.Second, "source", "slow"))
+
+	wf := forkJoinWorkflow(map[string]interface{}{"mode": "any"}, "slow", "fast")
+
+	started := time.Now()
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %+v", result.Status, result.Steps)
+	}
+	if time.Since(started) >= time.Second {
+		t.Error("Expected the slow branch to be cancelled")
+	}
+
+	for _, step := range result.Steps {
+		if step.NodeID == "b0" && step.Status != "cancelled" {
+			t.Errorf("Expected the slow branch step to be cancelled, got %s", step.Status)
+		}
+		if step.NodeID == "join" && !reflect.DeepEqual(step.Output["branches"], []string{"e-b1"}) {
+			t.Errorf("Expected only the fast branch to be joined, got %v", step.Output["branches"])
+		}
+	}
+}
+
+func TestExecutor_ForkJoinAnyStopsLosingBranch(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("fast", setVarHandler(0, "source", "fast"))
+	// The slow node does not notice it is cancelled, the branch stops after it
+	executor.RegisterNodeType("slow", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}))
+	var after atomic.Int32
+	executor.RegisterNodeType("after", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		after.Add(1)
+		return nil
+	}))
+
+	wf := forkJoinWorkflow(map[string]interface{}{"mode": "any"}, "slow", "fast")
+	wf.Definition.Nodes = append(wf.Definition.Nodes, Node{ID: "after", Type: "after"})
+	for i, edge := range wf.Definition.Edges {
+		if edge.ID == "e-b0-join" {
+			wf.Definition.Edges[i].Target = "after"
+		}
+	}
+	wf.Definition.Edges = append(wf.Definition.Edges, Edge{ID: "e-after-join", Source: "after", Target: "join"})
+
+	started := time.Now()
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %+v", result.Status, result.Steps)
+	}
+	// The join does not wait for the slow node to finish
+	if elapsed := time.Since(started); elapsed >= 100*time.Millisecond {
+		t.Errorf("Expected the run to continue once the fast branch won, took %s", elapsed)
+	}
+
+	var order []string
+	for _, step := range result.Steps {
+		order = append(order, step.NodeID+":"+step.Status)
+	}
+	expected := []string{"start:completed", "b0:cancelled", "b1:completed", "join:completed", "end:completed"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, order)
+	}
+
+	// The losing branch stops once its slow node returns, before the next node
+	time.Sleep(200 * time.Millisecond)
+	if after.Load() != 0 {
+		t.Errorf("Expected the node after the slow one never to run, ran %d times", after.Load())
+	}
+}
+
+func TestExecutor_ForkJoinConflicts(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         string
+		expectedStatus string
+	}{
+		{name: "last wins by default", policy: "", expectedStatus: "completed"},
+		{name: "first wins", policy: ConflictFirstWins, expectedStatus: "completed"},
+		{name: "fail on conflict", policy: ConflictFail, expectedStatus: "failed"},
+		{name: "unknown policy", policy: "random", expectedStatus: "failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := NewExecutor()
+			executor.RegisterNodeType("a", setVarHandler(0, "winner", "a"))
+			executor.RegisterNodeType("b", setVarHandler(0, "winner", "b"))
+
+			wf := forkJoinWorkflow(map[string]interface{}{"conflictPolicy": tt.policy}, "a", "b")
+			result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+
+			if result.Status != tt.expectedStatus {
+				t.Errorf("Expected status %s, got %s", tt.expectedStatus, result.Status)
+			}
+		})
+	}
+}
+
+func TestExecutor_ForkBranchFailure(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("ok", setVarHandler(0, "ok", true))
+
+	// The unknown node type fails its branch, which fails the run
+	wf := forkJoinWorkflow(nil, "ok", "missing")
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+
+	if result.Status != "failed" {
+		t.Fatalf("Expected status failed, got %s", result.Status)
+	}
+	for _, step := range result.Steps {
+		if step.NodeID == "join" || step.NodeID == "end" {
+			t.Errorf("Expected the run to stop before %s", step.NodeID)
+		}
+	}
+}
+
+func TestExecutor_ForkWithoutJoin(t *testing.T) {
+	wf := &Workflow{
+		ID: "fan-out",
+		Definition: WorkflowGraph{
+			Nodes: []Node{
+				{ID: "start", Type: "start"},
+				{ID: "end-a", Type: "end"},
+				{ID: "end-b", Type: "end"},
+			},
+			Edges: []Edge{
+				{ID: "e1", Source: "start", Target: "end-a"},
+				{ID: "e2", Source: "start", Target: "end-b"},
+			},
+		},
+	}
+
+	result := NewExecutor().Execute(context.Background(), wf, map[string]interface{}{})
+
+	if result.Status != "completed" {
+		t.Errorf("Expected status completed, got %s", result.Status)
+	}
+	if len(result.Steps) != 3 {
+		t.Errorf("Expected both branches to run, got %d steps", len(result.Steps))
+	}
+}
+
+func TestExecutor_ForkCopiesNestedVars(t *testing.T) {
+	executor := NewExecutor()
+	// Each branch changes the nested user, and checks it does not see the other's change
+	for i, city := range []string{"Sydney", "Melbourne"} {
+		other := []string{"Melbourne", "Sydney"}[i]
+		executor.RegisterNodeType(city, NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+			user := wfVars["user"].(map[string]interface{})
+			tags := user["tags"].([]interface{})
+			user["city"] = city
+			tags[0] = city
+			time.Sleep(20 * time.Millisecond)
+			if user["city"] == other || tags[0] == other {
+				return fmt.Errorf("branch saw the other branch's change: %v", user)
+			}
+			return nil
+		}))
+	}
+
+	wf := forkJoinWorkflow(map[string]interface{}{"conflictPolicy": ConflictFirstWins}, "Sydney", "Melbourne")
+	user := map[string]interface{}{"city": "Perth", "tags": []interface{}{"new"}}
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{"user": user})
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %+v", result.Status, result.Steps)
+	}
+
+	// The branches' changes are merged like any other, and the inputs are left as they were
+	expected := map[string]interface{}{"city": "Sydney", "tags": []interface{}{"Sydney"}}
+	if !reflect.DeepEqual(result.Variables["user"], expected) {
+		t.Errorf("Expected the first branch's user %v, got %v", expected, result.Variables["user"])
+	}
+	if !reflect.DeepEqual(result.Steps[3].Output["conflicts"], []string{"user"}) {
+		t.Errorf("Expected the user to conflict, got %+v", result.Steps[3].Output)
+	}
+	if user["city"] != "Perth" {
+		t.Errorf("Expected the inputs to be unchanged, got %v", user)
+	}
+}
+
+func TestMergeBranchVars(t *testing.T) {
+	snapshot := map[string]interface{}{"city": "Sydney", "count": 1}
+	branches := []map[string]interface{}{
+		{"city": "Sydney", "count": 2, "a": true},
+		{"city": "Sydney", "count": 3, "b": true},
+	}
+
+	changes, conflicts, err := mergeBranchVars(snapshot, branches, ConflictLastWins)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"count": 3, "a": true, "b": true}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+	if !reflect.DeepEqual(conflicts, []string{"count"}) {
+		t.Errorf("Expected count to conflict, got %v", conflicts)
+	}
+
+	changes, _, _ = mergeBranchVars(snapshot, branches, ConflictFirstWins)
+	if changes["count"] != 2 {
+		t.Errorf("Expected the first branch to win, got %v", changes["count"])
+	}
+
+	if _, _, err := mergeBranchVars(snapshot, branches, ConflictFail); err == nil {
+		t.Error("Expected conflict error")
+	}
+}
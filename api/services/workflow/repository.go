@@ -3,8 +3,15 @@ package workflow
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"workflow-code-test/api/pkg/db/pgtx"
 )
 
 type Repository struct {
@@ -16,10 +23,10 @@ func NewRepository(pool *pgxpool.Pool) *Repository {
 }
 
 func (r *Repository) GetWorkflow(ctx context.Context, id string) (*Workflow, error) {
-	query := `SELECT id, name, definition, created_at, updated_at FROM workflows WHERE id = $1`
+	query := `SELECT id, name, definition, version, created_at, updated_at FROM workflows WHERE id = $1`
 	var wf Workflow
 	var def []byte
-	if err := r.pool.QueryRow(ctx, query, id).Scan(&wf.ID, &wf.Name, &def, &wf.CreatedAt, &wf.UpdatedAt); err != nil {
+	if err := r.pool.QueryRow(ctx, query, id).Scan(&wf.ID, &wf.Name, &def, &wf.Version, &wf.CreatedAt, &wf.UpdatedAt); err != nil {
 		return nil, err
 	}
 	if err := json.Unmarshal(def, &wf.Definition); err != nil {
@@ -28,13 +35,780 @@ func (r *Repository) GetWorkflow(ctx context.Context, id string) (*Workflow, err
 	return &wf, nil
 }
 
+// CreateWorkflow inserts a new workflow as revision 1, setting its timestamps
+func (r *Repository) CreateWorkflow(ctx context.Context, wf *Workflow) error {
+	def, err := json.Marshal(wf.Definition)
+	if err != nil {
+		return err
+	}
+
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		return insertWorkflow(ctx, tx, wf, def)
+	})
+}
+
+// UpdateWorkflow stores a new revision of an existing workflow and makes it current,
+// returning pgx.ErrNoRows if it does not exist. Saving an unchanged workflow does not
+// create a new revision.
+func (r *Repository) UpdateWorkflow(ctx context.Context, wf *Workflow) error {
+	def, err := json.Marshal(wf.Definition)
+	if err != nil {
+		return err
+	}
+
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		return updateWorkflow(ctx, tx, wf, def)
+	})
+}
+
+// SaveWorkflow creates the workflow if it does not exist, otherwise it stores a new revision
 func (r *Repository) SaveWorkflow(ctx context.Context, wf *Workflow) error {
 	def, err := json.Marshal(wf.Definition)
 	if err != nil {
 		return err
 	}
-	query := `INSERT INTO workflows (id, name, definition) VALUES ($1, $2, $3)
-		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, definition = EXCLUDED.definition, updated_at = NOW()`
-	_, err = r.pool.Exec(ctx, query, wf.ID, wf.Name, def)
+
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		err := updateWorkflow(ctx, tx, wf, def)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return insertWorkflow(ctx, tx, wf, def)
+		}
+		return err
+	})
+}
+
+func insertWorkflow(ctx context.Context, tx pgx.Tx, wf *Workflow, def []byte) error {
+	query := `INSERT INTO workflows (id, name, definition, version) VALUES ($1, $2, $3, 1)
+		RETURNING version, created_at, updated_at`
+	if err := tx.QueryRow(ctx, query, wf.ID, wf.Name, def).Scan(&wf.Version, &wf.CreatedAt, &wf.UpdatedAt); err != nil {
+		return err
+	}
+	return insertWorkflowVersion(ctx, tx, wf, def)
+}
+
+func updateWorkflow(ctx context.Context, tx pgx.Tx, wf *Workflow, def []byte) error {
+	query := `UPDATE workflows SET name = $2, definition = $3, version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND (name <> $2 OR definition <> $3::jsonb)
+		RETURNING version, created_at, updated_at`
+	err := tx.QueryRow(ctx, query, wf.ID, wf.Name, def).Scan(&wf.Version, &wf.CreatedAt, &wf.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Either the workflow does not exist, or nothing changed
+		query := `SELECT version, created_at, updated_at FROM workflows WHERE id = $1`
+		return tx.QueryRow(ctx, query, wf.ID).Scan(&wf.Version, &wf.CreatedAt, &wf.UpdatedAt)
+	}
+	if err != nil {
+		return err
+	}
+	return insertWorkflowVersion(ctx, tx, wf, def)
+}
+
+func insertWorkflowVersion(ctx context.Context, tx pgx.Tx, wf *Workflow, def []byte) error {
+	query := `INSERT INTO workflow_versions (workflow_id, version, name, definition) VALUES ($1, $2, $3, $4)`
+	_, err := tx.Exec(ctx, query, wf.ID, wf.Version, wf.Name, def)
 	return err
 }
+
+// ListWorkflowVersions returns the revisions of a workflow, newest first.
+// The definitions are not loaded, use GetWorkflowVersion for a full revision
+func (r *Repository) ListWorkflowVersions(ctx context.Context, workflowID string) ([]WorkflowVersion, error) {
+	query := `SELECT workflow_id, version, name, created_at FROM workflow_versions
+		WHERE workflow_id = $1 ORDER BY version DESC`
+	rows, err := r.pool.Query(ctx, query, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []WorkflowVersion{}
+	for rows.Next() {
+		var v WorkflowVersion
+		if err := rows.Scan(&v.WorkflowID, &v.Version, &v.Name, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetWorkflowVersion returns a single revision of a workflow
+func (r *Repository) GetWorkflowVersion(ctx context.Context, workflowID string, version int) (*WorkflowVersion, error) {
+	query := `SELECT workflow_id, version, name, definition, created_at FROM workflow_versions
+		WHERE workflow_id = $1 AND version = $2`
+	var v WorkflowVersion
+	var def []byte
+	if err := r.pool.QueryRow(ctx, query, workflowID, version).Scan(&v.WorkflowID, &v.Version, &v.Name, &def, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(def, &v.Definition); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// RollbackWorkflow promotes an older revision to current, by storing a copy of
+// it as a new revision. Returns pgx.ErrNoRows if the revision does not exist
+func (r *Repository) RollbackWorkflow(ctx context.Context, workflowID string, version int) (*Workflow, error) {
+	wf := &Workflow{ID: workflowID}
+
+	err := pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		var def []byte
+		query := `SELECT name, definition FROM workflow_versions WHERE workflow_id = $1 AND version = $2`
+		if err := tx.QueryRow(ctx, query, workflowID, version).Scan(&wf.Name, &def); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(def, &wf.Definition); err != nil {
+			return err
+		}
+		return updateWorkflow(ctx, tx, wf, def)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return wf, nil
+}
+
+// DeleteWorkflow deletes a workflow along with its revisions and executions,
+// returning pgx.ErrNoRows if it does not exist
+func (r *Repository) DeleteWorkflow(ctx context.Context, id string) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM workflows WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Columns the workflow list can be sorted by, mapped to their SQL column
+var workflowSortColumns = map[string]string{
+	"updated_at": "updated_at",
+	"created_at": "created_at",
+	"name":       "name",
+}
+
+// ListWorkflows returns a page of workflow summaries along with the total number
+// of workflows matching the search
+func (r *Repository) ListWorkflows(ctx context.Context, opts ListWorkflowsOptions) ([]WorkflowSummary, int, error) {
+	column, ok := workflowSortColumns[opts.Sort]
+	if !ok {
+		column = "updated_at"
+	}
+	direction := "DESC"
+	if opts.Ascending {
+		direction = "ASC"
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM workflows WHERE $1 = '' OR name ILIKE '%' || $1 || '%'`
+	if err := r.pool.QueryRow(ctx, countQuery, opts.Search).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`SELECT id, name, created_at, updated_at FROM workflows
+		WHERE $1 = '' OR name ILIKE '%%' || $1 || '%%'
+		ORDER BY %s %s, id LIMIT $2 OFFSET $3`, column, direction)
+	rows, err := r.pool.Query(ctx, query, opts.Search, opts.Limit, opts.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	workflows := []WorkflowSummary{}
+	for rows.Next() {
+		var wf WorkflowSummary
+		if err := rows.Scan(&wf.ID, &wf.Name, &wf.CreatedAt, &wf.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+		workflows = append(workflows, wf)
+	}
+
+	return workflows, total, rows.Err()
+}
+
+// SaveExecution stores an execution and its steps, replacing any steps that were
+// previously stored for the same execution
+func (r *Repository) SaveExecution(ctx context.Context, exec *Execution) error {
+	def, err := json.Marshal(exec.Definition)
+	if err != nil {
+		return err
+	}
+	inputs, err := json.Marshal(exec.Inputs)
+	if err != nil {
+		return err
+	}
+
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		return saveExecution(ctx, tx, exec, def, inputs)
+	})
+}
+
+func saveExecution(ctx context.Context, tx pgx.Tx, exec *Execution, def, inputs []byte) error {
+	// Waiting runs keep the state they are resumed from, and are resumed by the
+	// scheduler once their wait expires
+	var state []byte
+	var resumeAt *time.Time
+	if exec.State != nil {
+		var err error
+		if state, err = json.Marshal(exec.State); err != nil {
+			return err
+		}
+		if exec.Status == "waiting" {
+			resumeAt = exec.State.WaitUntil
+		}
+	}
+
+	// Runs started by a subworkflow node refer to the run that started them
+	var parentID *string
+	if exec.ParentID != "" {
+		parentID = &exec.ParentID
+	}
+
+	query := `INSERT INTO workflow_executions (id, workflow_id, workflow_version, definition, inputs, status, started_at, finished_at, state, resume_at,
+			parent_id, depth)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, started_at = EXCLUDED.started_at, finished_at = EXCLUDED.finished_at,
+			state = EXCLUDED.state, resume_at = EXCLUDED.resume_at`
+	if _, err := tx.Exec(ctx, query, exec.ID, exec.WorkflowID, exec.WorkflowVersion, def, inputs, exec.Status, exec.StartedAt, exec.FinishedAt,
+		state, resumeAt, parentID, exec.Depth); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM execution_steps WHERE execution_id = $1`, exec.ID); err != nil {
+		return err
+	}
+
+	for i, step := range exec.Steps {
+		if err := insertExecutionStep(ctx, tx, exec.ID, i, step); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func insertExecutionStep(ctx context.Context, tx pgx.Tx, executionID string, position int, step ExecutionStep) error {
+	output, err := json.Marshal(step.Output)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO execution_steps
+		(execution_id, position, node_id, node_type, label, description, status, branch, iteration, source_handle, output, error, started_at, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+	_, err = tx.Exec(ctx, query, executionID, position, step.NodeID, step.Type, step.Label, step.Description,
+		step.Status, step.Branch, step.Iteration, step.SourceHandle, output, step.Error, step.StartedAt, step.DurationMs)
+	return err
+}
+
+// AppendExecutionStep stores the last step of a run in progress along with its status and
+// state, leaving the steps stored before it as they are. Runs save their steps with it as
+// they go, and are saved in full with SaveExecution or CompleteExecution when they stop.
+// Like CompleteExecution, it returns pgx.ErrNoRows (and saves nothing) if the worker's lease
+// has been lost to another worker
+func (r *Repository) AppendExecutionStep(ctx context.Context, exec *Execution, workerID string) error {
+	if len(exec.Steps) == 0 {
+		return fmt.Errorf("execution %s has no steps to append", exec.ID)
+	}
+	var state []byte
+	if exec.State != nil {
+		var err error
+		if state, err = json.Marshal(exec.State); err != nil {
+			return err
+		}
+	}
+
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		// Locking the queue row keeps another worker from claiming the run until the step is saved
+		var leased int
+		err := tx.QueryRow(ctx, `SELECT 1 FROM execution_queue WHERE execution_id = $1 AND lease_owner = $2 FOR UPDATE`,
+			exec.ID, workerID).Scan(&leased)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE workflow_executions SET status = $2, state = $3 WHERE id = $1`, exec.ID, exec.Status, state); err != nil {
+			return err
+		}
+		position := len(exec.Steps) - 1
+		return insertExecutionStep(ctx, tx, exec.ID, position, exec.Steps[position])
+	})
+}
+
+// GetExecution returns an execution along with its steps
+func (r *Repository) GetExecution(ctx context.Context, id string) (*Execution, error) {
+	query := `SELECT id, workflow_id, workflow_version, definition, inputs, status, started_at, finished_at, state,
+			COALESCE(parent_id::text, ''), depth
+		FROM workflow_executions WHERE id = $1`
+	var exec Execution
+	var def, inputs, state []byte
+	if err := r.pool.QueryRow(ctx, query, id).Scan(&exec.ID, &exec.WorkflowID, &exec.WorkflowVersion, &def, &inputs,
+		&exec.Status, &exec.StartedAt, &exec.FinishedAt, &state, &exec.ParentID, &exec.Depth); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(def, &exec.Definition); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(inputs, &exec.Inputs); err != nil {
+		return nil, err
+	}
+	if len(state) > 0 {
+		if err := json.Unmarshal(state, &exec.State); err != nil {
+			return nil, err
+		}
+	}
+
+	stepQuery := `SELECT node_id, node_type, label, description, status, branch, iteration, source_handle, output, error, started_at, duration_ms
+		FROM execution_steps WHERE execution_id = $1 ORDER BY position`
+	rows, err := r.pool.Query(ctx, stepQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exec.Steps = []ExecutionStep{}
+	for rows.Next() {
+		var step ExecutionStep
+		var output []byte
+		if err := rows.Scan(&step.NodeID, &step.Type, &step.Label, &step.Description, &step.Status, &step.Branch, &step.Iteration,
+			&step.SourceHandle, &output, &step.Error, &step.StartedAt, &step.DurationMs); err != nil {
+			return nil, err
+		}
+		if len(output) > 0 {
+			if err := json.Unmarshal(output, &step.Output); err != nil {
+				return nil, err
+			}
+		}
+		exec.Steps = append(exec.Steps, step)
+	}
+
+	return &exec, rows.Err()
+}
+
+// ListExecutions returns the executions of a workflow, most recent first. The
+// definition and steps are not loaded, use GetExecution for the full record
+func (r *Repository) ListExecutions(ctx context.Context, workflowID string, limit, offset int) ([]Execution, error) {
+	query := `SELECT id, workflow_id, workflow_version, inputs, status, started_at, finished_at, COALESCE(parent_id::text, '')
+		FROM workflow_executions WHERE workflow_id = $1
+		ORDER BY started_at DESC LIMIT $2 OFFSET $3`
+	rows, err := r.pool.Query(ctx, query, workflowID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := []Execution{}
+	for rows.Next() {
+		var exec Execution
+		var inputs []byte
+		if err := rows.Scan(&exec.ID, &exec.WorkflowID, &exec.WorkflowVersion, &inputs, &exec.Status, &exec.StartedAt, &exec.FinishedAt, &exec.ParentID); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(inputs, &exec.Inputs); err != nil {
+			return nil, err
+		}
+		executions = append(executions, exec)
+	}
+
+	return executions, rows.Err()
+}
+
+// EnqueueExecution saves a queued execution and adds it to the run queue, in one transaction
+func (r *Repository) EnqueueExecution(ctx context.Context, exec *Execution) error {
+	def, err := json.Marshal(exec.Definition)
+	if err != nil {
+		return err
+	}
+	inputs, err := json.Marshal(exec.Inputs)
+	if err != nil {
+		return err
+	}
+
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		if err := saveExecution(ctx, tx, exec, def, inputs); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO execution_queue (execution_id) VALUES ($1)`, exec.ID)
+		return err
+	})
+}
+
+// StartExecution saves an execution and adds it to the run queue already leased to the
+// worker, which runs it straight away. If the worker dies, the lease expires and the run is
+// claimed by another worker like any other
+func (r *Repository) StartExecution(ctx context.Context, exec *Execution, workerID string, lease time.Duration) error {
+	def, err := json.Marshal(exec.Definition)
+	if err != nil {
+		return err
+	}
+	inputs, err := json.Marshal(exec.Inputs)
+	if err != nil {
+		return err
+	}
+
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		if err := saveExecution(ctx, tx, exec, def, inputs); err != nil {
+			return err
+		}
+		query := `INSERT INTO execution_queue (execution_id, attempts, lease_owner, lease_expires_at)
+			VALUES ($1, 1, $2, NOW() + $3::float8 * INTERVAL '1 second')`
+		_, err := tx.Exec(ctx, query, exec.ID, workerID, lease.Seconds())
+		return err
+	})
+}
+
+// ClaimExecution leases the oldest queued execution to the worker, returning it with the
+// number of times it has been claimed. Executions whose lease has expired, because their
+// worker died, are claimed again. SKIP LOCKED lets several replicas claim concurrently
+// without waiting on each other. Returns pgx.ErrNoRows if there is nothing to run.
+func (r *Repository) ClaimExecution(ctx context.Context, workerID string, lease time.Duration) (*Execution, int, error) {
+	query := `UPDATE execution_queue q
+		SET lease_owner = $1, lease_expires_at = NOW() + $2::float8 * INTERVAL '1 second', attempts = q.attempts + 1
+		WHERE q.execution_id = (
+			SELECT execution_id FROM execution_queue
+			WHERE lease_expires_at IS NULL OR lease_expires_at < NOW()
+			ORDER BY enqueued_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING q.execution_id, q.attempts`
+	var id string
+	var attempts int
+	if err := r.pool.QueryRow(ctx, query, workerID, lease.Seconds()).Scan(&id, &attempts); err != nil {
+		return nil, 0, err
+	}
+
+	exec, err := r.GetExecution(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return exec, attempts, nil
+}
+
+// RenewExecutionLease extends the worker's lease on an execution, returning
+// pgx.ErrNoRows if the lease has been lost to another worker
+func (r *Repository) RenewExecutionLease(ctx context.Context, id, workerID string, lease time.Duration) error {
+	query := `UPDATE execution_queue SET lease_expires_at = NOW() + $3::float8 * INTERVAL '1 second'
+		WHERE execution_id = $1 AND lease_owner = $2`
+	tag, err := r.pool.Exec(ctx, query, id, workerID, lease.Seconds())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ReleaseExecution gives up the worker's lease, so the execution can be claimed again straight
+// away. The claim does not count as an attempt, only claims whose lease expired do
+func (r *Repository) ReleaseExecution(ctx context.Context, id, workerID string) error {
+	query := `UPDATE execution_queue SET lease_owner = NULL, lease_expires_at = NULL, attempts = GREATEST(attempts - 1, 0)
+		WHERE execution_id = $1 AND lease_owner = $2`
+	tag, err := r.pool.Exec(ctx, query, id, workerID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// CompleteExecution saves the finished execution and removes it from the run queue, returning
+// pgx.ErrNoRows (and saving nothing) if the worker's lease has been lost to another worker
+func (r *Repository) CompleteExecution(ctx context.Context, exec *Execution, workerID string) error {
+	def, err := json.Marshal(exec.Definition)
+	if err != nil {
+		return err
+	}
+	inputs, err := json.Marshal(exec.Inputs)
+	if err != nil {
+		return err
+	}
+
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `DELETE FROM execution_queue WHERE execution_id = $1 AND lease_owner = $2`, exec.ID, workerID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		return saveExecution(ctx, tx, exec, def, inputs)
+	})
+}
+
+// ResumeExecution queues a waiting execution to continue from its state, which holds the
+// handle and output its waiting node is resumed with. Returns pgx.ErrNoRows (and queues
+// nothing) if the execution is no longer waiting, because it has already been resumed.
+func (r *Repository) ResumeExecution(ctx context.Context, exec *Execution) error {
+	state, err := json.Marshal(exec.State)
+	if err != nil {
+		return err
+	}
+
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		query := `UPDATE workflow_executions SET status = 'queued', state = $2, resume_at = NULL
+			WHERE id = $1 AND status = 'waiting'`
+		tag, err := tx.Exec(ctx, query, exec.ID, state)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		exec.Status = "queued"
+		_, err = tx.Exec(ctx, `INSERT INTO execution_queue (execution_id) VALUES ($1)`, exec.ID)
+		return err
+	})
+}
+
+// ListDueExecutions returns the waiting executions whose wait has expired at now, oldest
+// first. The steps are not loaded
+func (r *Repository) ListDueExecutions(ctx context.Context, now time.Time) ([]Execution, error) {
+	query := `SELECT id, workflow_id, workflow_version, status, started_at, state
+		FROM workflow_executions WHERE status = 'waiting' AND resume_at <= $1
+		ORDER BY resume_at LIMIT 100`
+	rows, err := r.pool.Query(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := []Execution{}
+	for rows.Next() {
+		var exec Execution
+		var state []byte
+		if err := rows.Scan(&exec.ID, &exec.WorkflowID, &exec.WorkflowVersion, &exec.Status, &exec.StartedAt, &state); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(state, &exec.State); err != nil {
+			return nil, err
+		}
+		executions = append(executions, exec)
+	}
+
+	return executions, rows.Err()
+}
+
+const scheduleColumns = `id, workflow_id, cron_expression, timezone, form_data, condition, missed_fire_policy,
+	paused, next_run_at, last_run_at, created_at, updated_at`
+
+func scanSchedule(row pgx.Row) (*Schedule, error) {
+	var s Schedule
+	var formData, condition []byte
+	if err := row.Scan(&s.ID, &s.WorkflowID, &s.CronExpression, &s.Timezone, &formData, &condition, &s.MissedFirePolicy,
+		&s.Paused, &s.NextRunAt, &s.LastRunAt, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if len(formData) > 0 {
+		if err := json.Unmarshal(formData, &s.FormData); err != nil {
+			return nil, err
+		}
+	}
+	if len(condition) > 0 {
+		if err := json.Unmarshal(condition, &s.Condition); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+func (r *Repository) CreateSchedule(ctx context.Context, s *Schedule) error {
+	formData, err := json.Marshal(s.FormData)
+	if err != nil {
+		return err
+	}
+	condition, err := json.Marshal(s.Condition)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO schedules (id, workflow_id, cron_expression, timezone, form_data, condition, missed_fire_policy, paused, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING created_at, updated_at`
+	return r.pool.QueryRow(ctx, query, s.ID, s.WorkflowID, s.CronExpression, s.Timezone, formData, condition,
+		s.MissedFirePolicy, s.Paused, s.NextRunAt).Scan(&s.CreatedAt, &s.UpdatedAt)
+}
+
+func (r *Repository) GetSchedule(ctx context.Context, id string) (*Schedule, error) {
+	return scanSchedule(r.pool.QueryRow(ctx, `SELECT `+scheduleColumns+` FROM schedules WHERE id = $1`, id))
+}
+
+// ListSchedules returns the schedules of a workflow, oldest first
+func (r *Repository) ListSchedules(ctx context.Context, workflowID string) ([]Schedule, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+scheduleColumns+` FROM schedules WHERE workflow_id = $1 ORDER BY created_at`, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *s)
+	}
+	return schedules, rows.Err()
+}
+
+// SetSchedulePaused pauses or resumes a schedule, returning pgx.ErrNoRows if it does not exist
+func (r *Repository) SetSchedulePaused(ctx context.Context, id string, paused bool, nextRunAt time.Time) error {
+	query := `UPDATE schedules SET paused = $2, next_run_at = $3, updated_at = NOW() WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, query, id, paused, nextRunAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteSchedule deletes a schedule, returning pgx.ErrNoRows if it does not exist
+func (r *Repository) DeleteSchedule(ctx context.Context, id string) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM schedules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// FireDueSchedules locks the schedules that are due at now and calls fire for each of them.
+// The runs fire returns are queued, and the schedule moved on to its next run time, in the
+// same transaction. Schedules locked by another replica are skipped, so each fire time is
+// only fired once. Each schedule is fired under a savepoint, so one that fails to fire is
+// logged and retried after scheduleRetryDelay without holding up the others.
+func (r *Repository) FireDueSchedules(ctx context.Context, now time.Time, fire ScheduleFireFunc) error {
+	return pgtx.WithTransaction(ctx, r.pool, func(tx pgx.Tx) error {
+		query := `SELECT ` + scheduleColumns + ` FROM schedules
+			WHERE NOT paused AND next_run_at <= $1
+			ORDER BY next_run_at
+			LIMIT 100
+			FOR UPDATE SKIP LOCKED`
+		rows, err := tx.Query(ctx, query, now)
+		if err != nil {
+			return err
+		}
+		var due []*Schedule
+		for rows.Next() {
+			s, err := scanSchedule(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			due = append(due, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, s := range due {
+			err := fireSchedule(ctx, tx, s, fire)
+			if err == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				return err
+			}
+			slog.Error("Failed to fire schedule", "scheduleId", s.ID, "workflowId", s.WorkflowID, "error", err)
+			retry := `UPDATE schedules SET next_run_at = $2, updated_at = NOW() WHERE id = $1`
+			if _, err := tx.Exec(ctx, retry, s.ID, now.Add(scheduleRetryDelay)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Queue the runs of a due schedule and move it on to its next run time, under a savepoint
+// that is rolled back if any of it fails
+func fireSchedule(ctx context.Context, tx pgx.Tx, s *Schedule, fire ScheduleFireFunc) error {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer savepoint.Rollback(ctx)
+
+	var wf Workflow
+	var def []byte
+	err = savepoint.QueryRow(ctx, `SELECT id, name, definition, version FROM workflows WHERE id = $1`, s.WorkflowID).
+		Scan(&wf.ID, &wf.Name, &def, &wf.Version)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(def, &wf.Definition); err != nil {
+		return err
+	}
+
+	executions, next := fire(s, &wf)
+	for _, exec := range executions {
+		inputs, err := json.Marshal(exec.Inputs)
+		if err != nil {
+			return err
+		}
+		if err := saveExecution(ctx, savepoint, exec, def, inputs); err != nil {
+			return err
+		}
+		if _, err := savepoint.Exec(ctx, `INSERT INTO execution_queue (execution_id) VALUES ($1)`, exec.ID); err != nil {
+			return err
+		}
+	}
+
+	update := `UPDATE schedules SET next_run_at = $2, updated_at = NOW() WHERE id = $1`
+	if len(executions) > 0 {
+		update = `UPDATE schedules SET next_run_at = $2, last_run_at = NOW(), updated_at = NOW() WHERE id = $1`
+	}
+	if _, err := savepoint.Exec(ctx, update, s.ID, next); err != nil {
+		return err
+	}
+
+	return savepoint.Commit(ctx)
+}
+
+// SaveWebhook creates the webhook of a workflow, or replaces its token and secret
+func (r *Repository) SaveWebhook(ctx context.Context, webhook *Webhook) error {
+	query := `INSERT INTO webhooks (workflow_id, token, secret)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (workflow_id) DO UPDATE SET token = EXCLUDED.token, secret = EXCLUDED.secret, created_at = NOW()
+		RETURNING created_at`
+	return r.pool.QueryRow(ctx, query, webhook.WorkflowID, webhook.Token, webhook.Secret).Scan(&webhook.CreatedAt)
+}
+
+func (r *Repository) GetWebhook(ctx context.Context, workflowID string) (*Webhook, error) {
+	return r.getWebhook(ctx, `workflow_id = $1`, workflowID)
+}
+
+func (r *Repository) GetWebhookByToken(ctx context.Context, token string) (*Webhook, error) {
+	return r.getWebhook(ctx, `token = $1`, token)
+}
+
+func (r *Repository) getWebhook(ctx context.Context, where string, arg string) (*Webhook, error) {
+	var webhook Webhook
+	query := `SELECT workflow_id, token, secret, created_at FROM webhooks WHERE ` + where
+	err := r.pool.QueryRow(ctx, query, arg).Scan(&webhook.WorkflowID, &webhook.Token, &webhook.Secret, &webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// DeleteWebhook deletes the webhook of a workflow, returning pgx.ErrNoRows if it has none
+func (r *Repository) DeleteWebhook(ctx context.Context, workflowID string) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM webhooks WHERE workflow_id = $1`, workflowID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Defaults for retry policies that do not set them
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryDelay      = 500 * time.Millisecond
+	defaultRetryMultiplier = 2.0
+	defaultRetryMaxDelay   = 30 * time.Second
+)
+
+// StatusError is returned by handlers when a service responds with an unexpected HTTP
+// status, so retry policies can decide from the status code whether to try again
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// retryPolicy is read from the "retry" metadata of a node, any node type may have one
+type retryPolicy struct {
+	maxAttempts  int
+	initialDelay time.Duration
+	multiplier   float64
+	maxDelay     time.Duration
+	// jitter is the fraction of each delay that is randomised, between 0 and 1
+	jitter float64
+	// retryableStatus are the status codes of StatusErrors worth retrying, by default
+	// 408, 429 and any 5xx status
+	retryableStatus []int
+	// retryableErrors are substrings of the other errors worth retrying, by default any
+	// error is retried
+	retryableErrors []string
+}
+
+// Read the retry policy of a node, nil if it has none
+func parseRetryPolicy(node *Node) (*retryPolicy, error) {
+	raw, ok := node.Data.Metadata["retry"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	metadata, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("retry must be an object")
+	}
+
+	policy := &retryPolicy{
+		maxAttempts:  defaultRetryAttempts,
+		initialDelay: defaultRetryDelay,
+		multiplier:   defaultRetryMultiplier,
+		maxDelay:     defaultRetryMaxDelay,
+	}
+
+	if raw, ok := metadata["maxAttempts"]; ok {
+		value, ok := toFloat(raw)
+		if !ok || value < 1 || value != float64(int(value)) {
+			return nil, fmt.Errorf("retry maxAttempts must be a positive whole number")
+		}
+		policy.maxAttempts = int(value)
+	}
+
+	for key, target := range map[string]*time.Duration{
+		"initialDelay": &policy.initialDelay,
+		"maxDelay":     &policy.maxDelay,
+	} {
+		if raw, ok := metadata[key]; ok {
+			value, err := parseDurationValue(raw)
+			if err != nil {
+				return nil, fmt.Errorf("retry %s %w", key, err)
+			}
+			*target = value
+		}
+	}
+
+	if raw, ok := metadata["backoffMultiplier"]; ok {
+		value, ok := toFloat(raw)
+		if !ok || value < 1 {
+			return nil, fmt.Errorf("retry backoffMultiplier must be a number of at least 1")
+		}
+		policy.multiplier = value
+	}
+	if raw, ok := metadata["jitter"]; ok {
+		value, ok := toFloat(raw)
+		if !ok || value < 0 || value > 1 {
+			return nil, fmt.Errorf("retry jitter must be a number between 0 and 1")
+		}
+		policy.jitter = value
+	}
+
+	if raw, ok := metadata["retryableStatus"]; ok {
+		codes, ok := toList(raw)
+		if !ok {
+			return nil, fmt.Errorf("retry retryableStatus must be a list of status codes")
+		}
+		for _, code := range codes {
+			value, ok := toFloat(code)
+			if !ok || value < 100 || value > 599 || value != float64(int(value)) {
+				return nil, fmt.Errorf("retry retryableStatus has invalid status code %v", code)
+			}
+			policy.retryableStatus = append(policy.retryableStatus, int(value))
+		}
+	}
+	if raw, ok := metadata["retryableErrors"]; ok {
+		patterns, ok := toList(raw)
+		if !ok {
+			return nil, fmt.Errorf("retry retryableErrors must be a list of strings")
+		}
+		for _, pattern := range patterns {
+			value, ok := pattern.(string)
+			if !ok || value == "" {
+				return nil, fmt.Errorf("retry retryableErrors must be a list of strings")
+			}
+			policy.retryableErrors = append(policy.retryableErrors, value)
+		}
+	}
+
+	return policy, nil
+}
+
+// Parse a duration from metadata, either a string such as "500ms" or "2m", or a number
+// of milliseconds
+func parseDurationValue(raw interface{}) (time.Duration, error) {
+	var d time.Duration
+	switch value := raw.(type) {
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("must be a duration such as \"500ms\" or \"2s\"")
+		}
+		d = parsed
+	default:
+		ms, ok := toFloat(value)
+		if !ok {
+			return 0, fmt.Errorf("must be a duration such as \"500ms\" or \"2s\"")
+		}
+		d = time.Duration(ms * float64(time.Millisecond))
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return d, nil
+}
+
+// Whether the error is worth another attempt. Errors from the run being cancelled never are
+func (p *retryPolicy) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.StatusCode
+		if len(p.retryableStatus) == 0 {
+			return code == 408 || code == 429 || code >= 500
+		}
+		for _, retryable := range p.retryableStatus {
+			if code == retryable {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(p.retryableErrors) == 0 {
+		return true
+	}
+	for _, pattern := range p.retryableErrors {
+		if strings.Contains(err.Error(), pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// The delay before the given attempt, which grows by the multiplier after each attempt up
+// to the maximum delay, and is shortened by a random amount up to the jitter fraction
+func (p *retryPolicy) delay(attempt int) time.Duration {
+	d := float64(p.initialDelay) * math.Pow(p.multiplier, float64(attempt-2))
+	if d > float64(p.maxDelay) {
+		d = float64(p.maxDelay)
+	}
+	d -= d * p.jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// Run the node's handler, trying again after a failure as its retry policy allows. Each
+// attempt has the node's timeout and runs on a copy of the variables, so a failed attempt
+// leaves nothing behind, and is recorded in the "attempts" output of the step.
+func (e *Executor) handle(ctx context.Context, handler NodeHandler, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	policy, err := parseRetryPolicy(node)
+	if err != nil {
+		return err
+	}
+	timeout, err := nodeTimeout(node)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return runWithTimeout(ctx, timeout, func(ctx context.Context) error {
+			return handler.Handle(ctx, node, wfVars, step)
+		})
+	}
+
+	attempts := make([]interface{}, 0, policy.maxAttempts)
+	suspended := false
+	for attempt := 1; ; attempt++ {
+		vars := copyVars(wfVars)
+		step.Output = nil
+		started := time.Now()
+
+		err = runWithTimeout(ctx, timeout, func(ctx context.Context) error {
+			return handler.Handle(ctx, node, vars, step)
+		})
+		record := map[string]interface{}{
+			"attempt":    attempt,
+			"status":     "completed",
+			"durationMs": time.Since(started).Milliseconds(),
+		}
+		// Nodes that are waiting have not failed, and are not tried again
+		var suspend *SuspendError
+		suspended = errors.As(err, &suspend)
+		if suspended {
+			record["status"] = "waiting"
+		} else if err != nil {
+			record["status"] = "failed"
+			if errors.Is(err, errTimedOut) {
+				record["status"] = "timed_out"
+			}
+			record["error"] = err.Error()
+		}
+		attempts = append(attempts, record)
+
+		if err == nil || suspended || attempt >= policy.maxAttempts || !policy.retryable(ctx, err) {
+			if err == nil || suspended {
+				for k := range wfVars {
+					delete(wfVars, k)
+				}
+				for k, v := range vars {
+					wfVars[k] = v
+				}
+			}
+			break
+		}
+
+		// Wait before the next attempt, giving up if the run is cancelled meanwhile
+		delay := policy.delay(attempt + 1)
+		record["delayMs"] = delay.Milliseconds()
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if step.Output == nil {
+		step.Output = make(map[string]interface{})
+	}
+	step.Output["attempts"] = attempts
+	if err != nil && !suspended && len(attempts) > 1 {
+		return fmt.Errorf("%w (after %d attempts)", err, len(attempts))
+	}
+	return err
+}
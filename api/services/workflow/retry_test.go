@@ -0,0 +1,232 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A workflow that fetches the weather for the city from the endpoint, with the retry policy
+func retryingWeatherWorkflow(endpoint string, retry map[string]interface{}) *Workflow {
+	return &Workflow{ID: "retrying", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			{ID: "weather", Type: "integration", Data: NodeData{Metadata: map[string]interface{}{
+				"apiEndpoint": endpoint,
+				"options":     []interface{}{map[string]interface{}{"city": "Sydney", "lat": -33.8688, "lon": 151.2093}},
+				"retry":       retry,
+			}}},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []Edge{
+			{ID: "e1", Source: "start", Target: "weather"},
+			{ID: "e2", Source: "weather", Target: "end"},
+		},
+	}}
+}
+
+func TestExecutor_RetryTransientFailures(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"current_weather": {"temperature": 28.5}}`)
+	}))
+	defer server.Close()
+
+	wf := retryingWeatherWorkflow(server.URL, map[string]interface{}{
+		"maxAttempts":       4,
+		"initialDelay":      "5ms",
+		"backoffMultiplier": 2,
+		"jitter":            0.5,
+	})
+	result := NewExecutor().Execute(context.Background(), wf, map[string]interface{}{"city": "Sydney"})
+	if result.Status != "completed" {
+		t.Fatalf("Expected status completed, got %s: %+v", result.Status, result.Steps)
+	}
+	if result.Variables["temperature"] != 28.5 {
+		t.Errorf("Expected the temperature from the third attempt, got %v", result.Variables["temperature"])
+	}
+
+	step := result.Steps[1]
+	attempts, _ := step.Output["attempts"].([]interface{})
+	if len(attempts) != 3 || step.Output["temperature"] != 28.5 {
+		t.Fatalf("Expected three attempts and the weather output, got %v", step.Output)
+	}
+	first := attempts[0].(map[string]interface{})
+	if first["status"] != "failed" || !strings.Contains(first["error"].(string), "503") {
+		t.Errorf("Expected the first attempt to fail with the status, got %v", first)
+	}
+	if delay := first["delayMs"].(int64); delay > 5 {
+		t.Errorf("Expected a delay of at most 5ms before the second attempt, got %d", delay)
+	}
+	if last := attempts[2].(map[string]interface{}); last["status"] != "completed" {
+		t.Errorf("Expected the last attempt to complete, got %v", last)
+	}
+}
+
+func TestExecutor_RetryGivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		retry    map[string]interface{}
+		attempts int32
+		error    string
+	}{
+		{
+			name:     "attempts exhausted",
+			status:   http.StatusBadGateway,
+			retry:    map[string]interface{}{"maxAttempts": 3, "initialDelay": 1},
+			attempts: 3,
+			error:    "down\n (after 3 attempts)",
+		},
+		{
+			name:     "client errors are not retried",
+			status:   http.StatusNotFound,
+			retry:    map[string]interface{}{"maxAttempts": 3, "initialDelay": 1},
+			attempts: 1,
+			error:    "404 Not Found - down",
+		},
+		{
+			name:     "only the listed status codes are retried",
+			status:   http.StatusInternalServerError,
+			retry:    map[string]interface{}{"maxAttempts": 3, "initialDelay": 1, "retryableStatus": []interface{}{503}},
+			attempts: 1,
+			error:    "500 Internal Server Error - down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				http.Error(w, "down", tt.status)
+			}))
+			defer server.Close()
+
+			result := NewExecutor().Execute(context.Background(), retryingWeatherWorkflow(server.URL, tt.retry), map[string]interface{}{"city": "Sydney"})
+			if result.Status != "failed" || requests.Load() != tt.attempts {
+				t.Fatalf("Expected a failed run after %d requests, got %s after %d", tt.attempts, result.Status, requests.Load())
+			}
+			step := result.Steps[1]
+			if !strings.Contains(step.Error, tt.error) {
+				t.Errorf("Expected error %q, got %q", tt.error, step.Error)
+			}
+			if attempts, _ := step.Output["attempts"].([]interface{}); len(attempts) != int(tt.attempts) {
+				t.Errorf("Expected %d attempts recorded, got %v", tt.attempts, step.Output)
+			}
+		})
+	}
+}
+
+func TestExecutor_RetryAnyNode(t *testing.T) {
+	// The handler sets a variable before failing, which must not leak from failed attempts
+	calls := 0
+	executor := NewExecutor()
+	executor.RegisterNodeType("flaky", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		calls++
+		wfVars[fmt.Sprintf("attempt%d", calls)] = true
+		if calls == 1 {
+			return fmt.Errorf("connection reset by peer")
+		}
+		if calls == 2 {
+			return fmt.Errorf("invalid credentials")
+		}
+		return nil
+	}))
+
+	wf := &Workflow{ID: "flaky", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			{ID: "flaky", Type: "flaky", Data: NodeData{Metadata: map[string]interface{}{
+				"retry": map[string]interface{}{"maxAttempts": 5, "initialDelay": "1ms", "retryableErrors": []interface{}{"connection reset"}},
+			}}},
+		},
+		Edges: []Edge{{ID: "e1", Source: "start", Target: "flaky"}},
+	}}
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "failed" || calls != 2 {
+		t.Fatalf("Expected the run to fail on the second attempt, got %s after %d calls", result.Status, calls)
+	}
+	if result.Variables["attempt1"] != nil || result.Variables["attempt2"] != nil {
+		t.Errorf("Expected failed attempts to leave no variables behind, got %v", result.Variables)
+	}
+
+	// Without a list of retryable errors, any error is retried
+	delete(wf.Definition.Nodes[1].Data.Metadata["retry"].(map[string]interface{}), "retryableErrors")
+	calls = 0
+	result = executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "completed" || calls != 3 {
+		t.Fatalf("Expected the run to complete on the third attempt, got %s after %d calls", result.Status, calls)
+	}
+	if result.Variables["attempt3"] != true || result.Variables["attempt1"] != nil {
+		t.Errorf("Expected only the variables of the successful attempt, got %v", result.Variables)
+	}
+}
+
+func TestExecutor_RetryStopsWhenCancelled(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("fail", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		return fmt.Errorf("unavailable")
+	}))
+	wf := &Workflow{ID: "cancelled", Definition: WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			{ID: "fail", Type: "fail", Data: NodeData{Metadata: map[string]interface{}{
+				"retry": map[string]interface{}{"maxAttempts": 10, "initialDelay": "1h"},
+			}}},
+		},
+		Edges: []Edge{{ID: "e1", Source: "start", Target: "fail"}},
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	result := executor.Execute(ctx, wf, map[string]interface{}{})
+	if result.Status != "failed" || time.Since(started) > time.Second {
+		t.Fatalf("Expected the run to fail once cancelled, got %s after %s", result.Status, time.Since(started))
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy, err := parseRetryPolicy(&Node{Data: NodeData{Metadata: map[string]interface{}{
+		"retry": map[string]interface{}{"initialDelay": "100ms", "backoffMultiplier": 3, "maxDelay": "1s"},
+	}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second}
+	for i, want := range expected {
+		if got := policy.delay(i + 2); got != want {
+			t.Errorf("Expected delay %s before attempt %d, got %s", want, i+2, got)
+		}
+	}
+}
+
+func TestValidate_RetryPolicy(t *testing.T) {
+	for _, retry := range []interface{}{
+		"always",
+		map[string]interface{}{"maxAttempts": 0},
+		map[string]interface{}{"initialDelay": "soon"},
+		map[string]interface{}{"jitter": 2},
+		map[string]interface{}{"retryableStatus": []interface{}{"5xx"}},
+	} {
+		wf := testWorkflow()
+		wf.Definition.Nodes[0].Data.Metadata = map[string]interface{}{"retry": retry}
+		result := Validate(wf.Definition)
+		if result.Valid || result.Diagnostics[0].Code != "invalid_metadata" {
+			t.Errorf("Expected an invalid metadata diagnostic for %v, got %+v", retry, result.Diagnostics)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// RunnerConfig configures the workers that execute asynchronous runs
+type RunnerConfig struct {
+	// Workers is the number of runs executed concurrently by this process
+	Workers int
+	// PollInterval is how often idle workers check the queue for runs queued by other replicas
+	PollInterval time.Duration
+	// Lease is how long a worker may hold a run without a heartbeat before
+	// it is presumed dead and the run is claimed by another worker
+	Lease time.Duration
+	// MaxAttempts is how many times a run is claimed before it is abandoned as failed. Runs
+	// handed back by a runner that is stopping do not count it as an attempt
+	MaxAttempts int
+}
+
+// DefaultRunnerConfig returns sensible defaults
+func DefaultRunnerConfig() RunnerConfig {
+	return RunnerConfig{
+		Workers:      4,
+		PollInterval: time.Second,
+		Lease:        30 * time.Second,
+		MaxAttempts:  3,
+	}
+}
+
+// Runner executes queued workflow runs on a pool of workers, recording their progress in
+// the execution history as each step finishes. The queue is held by the repository, so any
+// replica can run work queued by another, and runs survive a crash of the process.
+type Runner struct {
+	repo     RepositoryInterface
+	executor ExecutorInterface
+	config   RunnerConfig
+	workerID string
+
+	// wake signals an idle worker that a run was queued by this process
+	wake   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewRunner(repo RepositoryInterface, executor ExecutorInterface, config RunnerConfig) *Runner {
+	defaults := DefaultRunnerConfig()
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.Lease <= 0 {
+		config.Lease = defaults.Lease
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+
+	hostname, _ := os.Hostname()
+	return &Runner{
+		repo:     repo,
+		executor: executor,
+		config:   config,
+		workerID: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8]),
+		wake:     make(chan struct{}, config.Workers),
+	}
+}
+
+// Start starts the workers, which take runs off the queue until ctx is done or the runner
+// is stopped
+func (r *Runner) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+	for i := 0; i < r.config.Workers; i++ {
+		r.wg.Add(1)
+		go r.work(ctx)
+	}
+}
+
+// Enqueue saves the run with the queued status and adds it to the queue
+func (r *Runner) Enqueue(ctx context.Context, execution *Execution) error {
+	if err := r.repo.EnqueueExecution(ctx, execution); err != nil {
+		return err
+	}
+	r.notify()
+	return nil
+}
+
+// Resume queues a waiting run to continue from its state, returning pgx.ErrNoRows if it
+// is no longer waiting
+func (r *Runner) Resume(ctx context.Context, execution *Execution) error {
+	if err := r.repo.ResumeExecution(ctx, execution); err != nil {
+		return err
+	}
+	r.notify()
+	return nil
+}
+
+// Execute runs the execution straight away and returns its result, recording its progress
+// and checkpoints like a queued run's. The run is leased to this runner while it runs, so a
+// run interrupted by a crash of the process is resumed by another worker from its last
+// checkpoint, as is one whose caller goes away before it finishes.
+func (r *Runner) Execute(ctx context.Context, execution *Execution) *ExecutionResponse {
+	execution.Status = "running"
+	execution.Steps = []ExecutionStep{}
+	if err := r.repo.StartExecution(ctx, execution, r.workerID, r.config.Lease); err != nil {
+		// A failure to record the run should not stop it, it runs unrecorded
+		slog.Error("Failed to start execution", "executionId", execution.ID, "workflowId", execution.WorkflowID, "error", err)
+		wf := &Workflow{ID: execution.WorkflowID, Version: execution.WorkflowVersion, Definition: execution.Definition}
+		return r.executor.Execute(ctx, wf, copyVars(execution.Inputs))
+	}
+
+	result := r.run(ctx, execution, 1)
+	result.ID = execution.ID
+	return result
+}
+
+// Wake an idle worker to claim newly queued runs
+func (r *Runner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop waits for the workers to finish. Runs in progress are cancelled and handed back
+// to the queue, so another replica (or this one, once restarted) runs them again.
+func (r *Runner) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+}
+
+func (r *Runner) work(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep claiming until the queue is empty, then wait to be woken
+		for ctx.Err() == nil {
+			execution, attempts, err := r.repo.ClaimExecution(ctx, r.workerID, r.config.Lease)
+			if errors.Is(err, pgx.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("Failed to claim execution", "error", err)
+				}
+				break
+			}
+			r.run(ctx, execution, attempts)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Execute a claimed run, saving it as it progresses so it can be polled, and return its result
+func (r *Runner) run(ctx context.Context, execution *Execution, attempts int) *ExecutionResponse {
+	logger := slog.With("executionId", execution.ID, "workflowId", execution.WorkflowID, "attempt", attempts)
+
+	// Work on a copy of the context that is cancelled if the lease is lost
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+
+	// Saves after the runner is stopped still need to reach the database
+	saveCtx := context.WithoutCancel(ctx)
+
+	if attempts > r.config.MaxAttempts {
+		logger.Error("Abandoning execution after too many attempts")
+		result := &ExecutionResponse{
+			Status: "failed",
+			Steps: []ExecutionStep{
+				systemErrorStep(fmt.Sprintf("Run abandoned after %d attempts", r.config.MaxAttempts)),
+			},
+		}
+		r.finish(saveCtx, logger, execution, result)
+		return result
+	}
+
+	// A run claimed again after its worker died, or was stopped, resumes from its last
+	// checkpoint, and a run resumed from a waiting node from the node. Either continues
+	// from the steps recorded when it stopped. Runs without a state start over
+	resume := execution.State
+	execution.Status = "running"
+	execution.FinishedAt = nil
+	if resume != nil {
+		execution.Steps = execution.Steps[:min(resume.Steps, len(execution.Steps))]
+	} else {
+		execution.StartedAt = time.Now()
+		execution.Steps = []ExecutionStep{}
+	}
+	previous := execution.Steps
+	if err := r.repo.SaveExecution(runCtx, execution); err != nil {
+		logger.Error("Failed to mark execution as running", "error", err)
+	}
+
+	// Renew the lease while the run is in progress
+	var lostLease bool
+	var mu sync.Mutex
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(r.config.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				err := r.repo.RenewExecutionLease(runCtx, execution.ID, r.workerID, r.config.Lease)
+				if errors.Is(err, pgx.ErrNoRows) {
+					logger.Warn("Lost the lease on execution, another worker has claimed it")
+					mu.Lock()
+					lostLease = true
+					mu.Unlock()
+					cancelRun()
+					return
+				}
+				if err != nil && runCtx.Err() == nil {
+					logger.Error("Failed to renew execution lease", "error", err)
+				}
+			}
+		}
+	}()
+
+	// Steps from parallel branches are reported concurrently
+	onStep := func(step ExecutionStep) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		execution.Steps = append(execution.Steps, step)
+		// Steps of the main path carry the state to resume the run from after them,
+		// which is saved with the step
+		if step.checkpoint != nil {
+			step.checkpoint.Steps = len(execution.Steps)
+			execution.State = step.checkpoint
+		}
+		if lostLease {
+			return
+		}
+		err := r.repo.AppendExecutionStep(runCtx, execution, r.workerID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.Warn("Lost the lease on execution, another worker has claimed it")
+			lostLease = true
+			cancelRun()
+			return
+		}
+		if err != nil && runCtx.Err() == nil {
+			logger.Error("Failed to save execution progress", "error", err)
+		}
+	}
+
+	// Handlers can refer to the run, e.g. to link to it in an email
+	nodeCtx := withSubworkflowDepth(withExecutionID(runCtx, execution.ID), execution.Depth)
+
+	wf := &Workflow{ID: execution.WorkflowID, Version: execution.WorkflowVersion, Definition: execution.Definition}
+	var result *ExecutionResponse
+	if resume != nil {
+		result = r.executor.Resume(nodeCtx, wf, resume, onStep)
+		result.Steps = append(append([]ExecutionStep{}, previous...), result.Steps...)
+	} else {
+		result = r.executor.ExecuteWithProgress(nodeCtx, wf, copyVars(execution.Inputs), onStep)
+	}
+
+	cancelRun()
+	<-heartbeatDone
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch {
+	case lostLease:
+		// The worker that claimed the run records its result
+		return result
+	case ctx.Err() != nil:
+		// The runner is stopping, or the caller went away, hand the run back so it is not lost
+		if err := r.repo.ReleaseExecution(saveCtx, execution.ID, r.workerID); err != nil {
+			logger.Error("Failed to release execution", "error", err)
+		}
+		logger.Info("Released execution for another worker")
+		return result
+	}
+
+	r.finish(saveCtx, logger, execution, result)
+	return result
+}
+
+// Record the final state of a run and remove it from the queue. Runs stopped at a waiting
+// node are not finished, and keep the state they are resumed from
+func (r *Runner) finish(ctx context.Context, logger *slog.Logger, execution *Execution, result *ExecutionResponse) {
+	recordResult(execution, result)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := r.repo.CompleteExecution(ctx, execution, r.workerID); err != nil {
+		logger.Error("Failed to complete execution", "error", err)
+		return
+	}
+	logger.Debug("Execution finished", "status", execution.Status)
+}
+
+// Copy the result of a run to its execution record
+func recordResult(execution *Execution, result *ExecutionResponse) {
+	execution.Status = result.Status
+	execution.Steps = result.Steps
+	execution.State = result.State
+	execution.FinishedAt = nil
+	if result.State != nil {
+		result.State.Steps = len(result.Steps)
+		return
+	}
+	finishedAt := time.Now()
+	execution.FinishedAt = &finishedAt
+}
@@ -0,0 +1,277 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Poll the execution until the check passes, or fail the test after a second
+func waitForExecution(t *testing.T, router http.Handler, id string, check func(*Execution) bool) *Execution {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		rec := doRequest(router, "GET", "/api/v1/executions/"+id, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var exec Execution
+		if err := json.Unmarshal(rec.Body.Bytes(), &exec); err != nil {
+			t.Fatalf("Failed to decode execution: %v", err)
+		}
+		if check(&exec) {
+			return &exec
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for execution, last state: %+v", exec)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestService_AsyncExecution(t *testing.T) {
+	wf := testWorkflow()
+	wf.Definition.Nodes = append(wf.Definition.Nodes, Node{ID: "slow", Type: "slow"})
+	wf.Definition.Edges = []Edge{
+		{ID: "e1", Source: "start", Target: "slow"},
+		{ID: "e2", Source: "slow", Target: "end"},
+	}
+	repo := NewMockRepository(wf)
+
+	// The slow node blocks until it is released, so the run can be polled while in progress
+	release := make(chan struct{})
+	executor := NewExecutor()
+	executor.RegisterNodeType("slow", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}))
+
+	service := NewServiceWithDependencies(repo, executor)
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute?async=true", `{"formData": {"city": "Sydney"}}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var queued struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &queued); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if queued.ID == "" || queued.Status != "queued" {
+		t.Fatalf("Expected a queued run ID, got %+v", queued)
+	}
+	if location := rec.Header().Get("Location"); location != "/api/v1/executions/"+queued.ID {
+		t.Errorf("Expected location header for the run, got %q", location)
+	}
+
+	// The start node has finished, the slow node is still running
+	exec := waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "running" && len(exec.Steps) == 1
+	})
+	if exec.Steps[0].NodeID != "start" || exec.FinishedAt != nil {
+		t.Errorf("Expected partial progress, got %+v", exec)
+	}
+
+	close(release)
+
+	exec = waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "completed"
+	})
+	if len(exec.Steps) != 3 || exec.FinishedAt == nil {
+		t.Errorf("Expected the finished run, got %+v", exec)
+	}
+	if exec.Inputs["city"] != "Sydney" {
+		t.Errorf("Expected the inputs to be recorded, got %v", exec.Inputs)
+	}
+}
+
+func TestService_AsyncExecutionErrors(t *testing.T) {
+	wf := testWorkflow()
+	service := NewServiceWithDependencies(NewMockRepository(wf), &MockExecutor{response: &ExecutionResponse{Status: "completed"}})
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute?async=maybe", `{}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+
+	rec = doRequest(router, "POST", "/api/v1/workflows/does-not-exist/execute?async=true", `{}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+}
+
+// Queue a run of the workflow directly in the repository
+func queueRun(t *testing.T, repo *MockRepository, wf *Workflow) *Execution {
+	t.Helper()
+	exec := &Execution{ID: uuid.NewString(), WorkflowID: wf.ID, Definition: wf.Definition, Status: "queued", StartedAt: time.Now()}
+	if err := repo.EnqueueExecution(context.Background(), exec); err != nil {
+		t.Fatalf("Failed to queue run: %v", err)
+	}
+	return exec
+}
+
+// Wait until the run has the status, or fail the test after a second
+func waitForStatus(t *testing.T, repo *MockRepository, id, status string) *Execution {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		exec, err := repo.GetExecution(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Failed to get execution: %v", err)
+		}
+		if exec.Status == status {
+			return exec
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for status %s, last state: %+v", status, exec)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunner_ReclaimsExpiredLease(t *testing.T) {
+	wf := testWorkflow()
+	repo := NewMockRepository(wf)
+	exec := queueRun(t, repo, wf)
+
+	// A worker claims the run, then dies without renewing its lease
+	if _, _, err := repo.ClaimExecution(context.Background(), "dead-worker", 50*time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	runner := NewRunner(repo, NewExecutor(), RunnerConfig{Workers: 1, PollInterval: 10 * time.Millisecond})
+	runner.Start(context.Background())
+	defer runner.Stop()
+
+	finished := waitForStatus(t, repo, exec.ID, "completed")
+	if len(finished.Steps) != 2 || finished.FinishedAt == nil {
+		t.Errorf("Expected the run to be executed again, got %+v", finished)
+	}
+	if _, _, err := repo.ClaimExecution(context.Background(), "another-worker", time.Second); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected the completed run to leave the queue, got %v", err)
+	}
+}
+
+func TestRunner_AbandonsAfterMaxAttempts(t *testing.T) {
+	wf := testWorkflow()
+	repo := NewMockRepository(wf)
+	exec := queueRun(t, repo, wf)
+
+	if _, _, err := repo.ClaimExecution(context.Background(), "dead-worker", time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	runner := NewRunner(repo, NewExecutor(), RunnerConfig{Workers: 1, PollInterval: 10 * time.Millisecond, MaxAttempts: 1})
+	runner.Start(context.Background())
+	defer runner.Stop()
+
+	failed := waitForStatus(t, repo, exec.ID, "failed")
+	if len(failed.Steps) != 1 || failed.Steps[0].Error != "Run abandoned after 1 attempts" {
+		t.Errorf("Expected the run to be abandoned, got %+v", failed.Steps)
+	}
+}
+
+func TestRunner_StopReleasesRun(t *testing.T) {
+	wf := testWorkflow()
+	wf.Definition.Nodes = append(wf.Definition.Nodes, Node{ID: "block", Type: "block"})
+	wf.Definition.Edges = []Edge{
+		{ID: "e1", Source: "start", Target: "block"},
+		{ID: "e2", Source: "block", Target: "end"},
+	}
+	repo := NewMockRepository(wf)
+
+	started := make(chan struct{})
+	executor := NewExecutor()
+	executor.RegisterNodeType("block", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	runner := NewRunner(repo, executor, RunnerConfig{Workers: 1, PollInterval: 10 * time.Millisecond})
+	exec := queueRun(t, repo, wf)
+
+	// Nothing runs until the runner is started
+	time.Sleep(30 * time.Millisecond)
+	if queued, _ := repo.GetExecution(context.Background(), exec.ID); queued.Status != "queued" {
+		t.Fatalf("Expected the run to wait for the runner to start, got %s", queued.Status)
+	}
+	runner.Start(context.Background())
+	<-started
+	runner.Stop()
+
+	// The interrupted run is handed back to the queue rather than failed, and the claim it
+	// was handed back from does not count as an attempt
+	stopped, _ := repo.GetExecution(context.Background(), exec.ID)
+	if stopped.Status != "running" {
+		t.Errorf("Expected the run to be left for another worker, got %s", stopped.Status)
+	}
+	claimed, attempts, err := repo.ClaimExecution(context.Background(), "another-worker", time.Second)
+	if err != nil || claimed.ID != exec.ID || attempts != 1 {
+		t.Errorf("Expected the run to be claimed again, got %v, %d attempts, %v", claimed, attempts, err)
+	}
+}
+
+func TestRunner_StopsSavingAfterLosingLease(t *testing.T) {
+	wf := testWorkflow()
+	wf.Definition.Nodes = append(wf.Definition.Nodes, Node{ID: "steal", Type: "steal"}, Node{ID: "after", Type: "after"})
+	wf.Definition.Edges = []Edge{
+		{ID: "e1", Source: "start", Target: "steal"},
+		{ID: "e2", Source: "steal", Target: "after"},
+		{ID: "e3", Source: "after", Target: "end"},
+	}
+	repo := NewMockRepository(wf)
+
+	// Another worker claims the run before this one notices its lease has expired
+	stolen := make(chan struct{})
+	executor := NewExecutor()
+	executor.RegisterNodeType("steal", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		repo.mu.Lock()
+		repo.queue[0].owner = "another-worker"
+		repo.mu.Unlock()
+		close(stolen)
+		return nil
+	}))
+	var ranAfter atomic.Bool
+	executor.RegisterNodeType("after", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		ranAfter.Store(true)
+		return nil
+	}))
+
+	runner := NewRunner(repo, executor, RunnerConfig{Workers: 1, PollInterval: 10 * time.Millisecond, Lease: time.Minute})
+	exec := queueRun(t, repo, wf)
+	runner.Start(context.Background())
+	<-stolen
+	time.Sleep(30 * time.Millisecond)
+	runner.Stop()
+
+	// The run stops as soon as saving a step finds the lease lost, and nothing after that is
+	// saved over the new owner's run
+	if ranAfter.Load() {
+		t.Error("Expected the run to stop once its lease was lost")
+	}
+	stored, _ := repo.GetExecution(context.Background(), exec.ID)
+	if stored.Status != "running" || len(stored.Steps) != 1 || stored.Steps[0].NodeID != "start" {
+		t.Errorf("Expected only the step saved before the lease was lost, got %s with %+v", stored.Status, stored.Steps)
+	}
+}
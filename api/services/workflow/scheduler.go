@@ -0,0 +1,271 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+	// Timezones must resolve even where the system has no tz database, e.g. Alpine images
+	_ "time/tzdata"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/robfig/cron/v3"
+)
+
+// Missed fire policies, for fire times missed while no scheduler was running
+const (
+	// MissedFireSkip fires once for the most recent missed time, and skips the rest
+	MissedFireSkip = "skip"
+	// MissedFireCatchUp fires once for every missed time
+	MissedFireCatchUp = "catch_up"
+)
+
+// A schedule that has been missed for a long time catches up at most this many runs, the
+// earliest it missed
+const maxCatchUpRuns = 100
+
+// Standard five field cron expressions, plus descriptors such as @hourly and @every 15m
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// scheduleRetryDelay is how long a schedule that failed to fire waits before it is tried again
+const scheduleRetryDelay = time.Hour
+
+// ScheduleFireFunc decides the runs to queue for a due schedule, and when it is next due
+type ScheduleFireFunc func(schedule *Schedule, wf *Workflow) ([]*Execution, time.Time)
+
+// Parse the cron expression of a schedule in its timezone
+func parseSchedule(expression, timezone string) (cron.Schedule, *time.Location, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid timezone %q", timezone)
+	}
+	schedule, err := cronParser.Parse(expression)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron expression %q: %w", expression, err)
+	}
+	return schedule, loc, nil
+}
+
+// Validate a schedule request and fill in its defaults
+func newSchedule(workflowID string, req *ScheduleRequest, now time.Time) (*Schedule, error) {
+	if req.CronExpression == "" {
+		return nil, fmt.Errorf("cron is required")
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if req.MissedFirePolicy == "" {
+		req.MissedFirePolicy = MissedFireSkip
+	}
+	if req.MissedFirePolicy != MissedFireSkip && req.MissedFirePolicy != MissedFireCatchUp {
+		return nil, fmt.Errorf("missedFirePolicy must be %s or %s", MissedFireSkip, MissedFireCatchUp)
+	}
+
+	cronSchedule, loc, err := parseSchedule(req.CronExpression, req.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schedule{
+		ID:               uuid.NewString(),
+		WorkflowID:       workflowID,
+		CronExpression:   req.CronExpression,
+		Timezone:         req.Timezone,
+		FormData:         req.FormData,
+		Condition:        req.Condition,
+		MissedFirePolicy: req.MissedFirePolicy,
+		NextRunAt:        cronSchedule.Next(now.In(loc)).UTC(),
+	}, nil
+}
+
+// The fire times of a schedule that are due at now, and the time it is next due after now
+func dueFireTimes(schedule *Schedule, now time.Time) ([]time.Time, time.Time, error) {
+	cronSchedule, loc, err := parseSchedule(schedule.CronExpression, schedule.Timezone)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	next := cronSchedule.Next(now.In(loc)).UTC()
+
+	if schedule.NextRunAt.After(now) {
+		return nil, next, nil
+	}
+	if schedule.MissedFirePolicy != MissedFireCatchUp {
+		return []time.Time{latestFireTime(cronSchedule, loc, schedule.NextRunAt, now)}, next, nil
+	}
+
+	// Catch up the missed fire times in order, skipping those after the first maxCatchUpRuns
+	var due []time.Time
+	for t := schedule.NextRunAt; !t.IsZero() && !t.After(now) && len(due) < maxCatchUpRuns; t = cronSchedule.Next(t.In(loc)) {
+		due = append(due, t)
+	}
+
+	return due, next, nil
+}
+
+// The latest fire time of a schedule at or before now, and no earlier than from, which is
+// due. The search goes back from now over windows that double in length, so a schedule
+// missed for a long time is not walked one fire time at a time.
+func latestFireTime(cronSchedule cron.Schedule, loc *time.Location, from, now time.Time) time.Time {
+	// Intervals (@every) count from the previous fire time rather than the clock, so the
+	// latest is a whole number of intervals after from
+	if every, ok := cronSchedule.(cron.ConstantDelaySchedule); ok {
+		base := from.Truncate(time.Second)
+		if n := now.Sub(base) / every.Delay; n > 0 {
+			return base.Add(n * every.Delay)
+		}
+		return from
+	}
+
+	for window := time.Minute; ; window *= 2 {
+		latest := from
+		if start := now.Add(-window); start.After(from) {
+			// Next is strictly after start, which may be a fire time itself
+			latest = cronSchedule.Next(start.Add(-time.Nanosecond).In(loc))
+			if latest.IsZero() || latest.After(now) {
+				continue
+			}
+		}
+		for t := cronSchedule.Next(latest.In(loc)); !t.IsZero() && !t.After(now); t = cronSchedule.Next(t.In(loc)) {
+			latest = t
+		}
+		return latest
+	}
+}
+
+// Scheduler fires the runs of due schedules. Due schedules are locked while they are
+// fired, and their next run time is moved on in the same transaction as their runs are
+// queued, so a schedule only fires once even with several replicas running schedulers.
+type Scheduler struct {
+	repo     RepositoryInterface
+	runner   *Runner
+	interval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(repo RepositoryInterface, runner *Runner, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	return &Scheduler{repo: repo, runner: runner, interval: interval}
+}
+
+// Start starts the scheduler loop, which fires due schedules until ctx is done or the
+// scheduler is stopped
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go s.loop(ctx)
+}
+
+// Stop waits for the scheduler loop to finish
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if _, err := s.tick(ctx, now); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to fire schedules", "error", err)
+		}
+		if _, err := s.expire(ctx, now); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to resume expired runs", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Fire the schedules that are due at now, returning the number of runs queued
+func (s *Scheduler) tick(ctx context.Context, now time.Time) (int, error) {
+	queued := 0
+	err := s.repo.FireDueSchedules(ctx, now, func(schedule *Schedule, wf *Workflow) ([]*Execution, time.Time) {
+		due, next, err := dueFireTimes(schedule, now)
+		if err != nil {
+			// Schedules are validated when they are created, so this should not happen.
+			// Try again later rather than firing continuously
+			slog.Error("Failed to evaluate schedule", "scheduleId", schedule.ID, "error", err)
+			return nil, now.Add(scheduleRetryDelay)
+		}
+
+		inputs := executionInputs(&ExecutionRequest{FormData: schedule.FormData, Condition: schedule.Condition})
+		executions := make([]*Execution, 0, len(due))
+		for range due {
+			executions = append(executions, &Execution{
+				ID:              uuid.NewString(),
+				WorkflowID:      wf.ID,
+				WorkflowVersion: wf.Version,
+				Definition:      wf.Definition,
+				Inputs:          copyVars(inputs),
+				Status:          "queued",
+				StartedAt:       now,
+				Steps:           []ExecutionStep{},
+			})
+		}
+		queued += len(executions)
+
+		slog.Debug("Firing schedule", "scheduleId", schedule.ID, "workflowId", wf.ID, "runs", len(executions), "nextRunAt", next)
+		return executions, next
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if queued > 0 && s.runner != nil {
+		s.runner.notify()
+	}
+	return queued, nil
+}
+
+// Resume the waiting runs whose wait has expired at now through the timeout handle of
+// their waiting node, returning the number of runs queued
+func (s *Scheduler) expire(ctx context.Context, now time.Time) (int, error) {
+	due, err := s.repo.ListDueExecutions(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for i := range due {
+		execution := &due[i]
+		execution.State.Handle = execution.State.TimeoutHandle
+		execution.State.Output = execution.State.TimeoutOutput
+
+		// Runs decided since they were listed are left alone
+		err := s.repo.ResumeExecution(ctx, execution)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return queued, err
+		}
+		slog.Debug("Resuming expired run", "executionId", execution.ID, "nodeId", execution.State.NodeID)
+		queued++
+	}
+
+	if queued > 0 && s.runner != nil {
+		s.runner.notify()
+	}
+	return queued, nil
+}
@@ -0,0 +1,235 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewSchedule(t *testing.T) {
+	now := time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC)
+
+	schedule, err := newSchedule("wf", &ScheduleRequest{CronExpression: "0 9 * * *", Timezone: "Australia/Sydney"}, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// 9am in Sydney is 10pm UTC the day before during daylight saving
+	if expected := time.Date(2024, 3, 30, 22, 0, 0, 0, time.UTC); !schedule.NextRunAt.Equal(expected) {
+		t.Errorf("Expected next run at %v, got %v", expected, schedule.NextRunAt)
+	}
+	if schedule.MissedFirePolicy != MissedFireSkip {
+		t.Errorf("Expected the skip policy by default, got %s", schedule.MissedFirePolicy)
+	}
+
+	schedule, err = newSchedule("wf", &ScheduleRequest{CronExpression: "@every 15m"}, now)
+	if err != nil || schedule.Timezone != "UTC" || !schedule.NextRunAt.Equal(now.Add(15*time.Minute)) {
+		t.Errorf("Expected an interval schedule in UTC, got %+v, %v", schedule, err)
+	}
+
+	for _, req := range []ScheduleRequest{
+		{},
+		{CronExpression: "not a cron"},
+		{CronExpression: "* * * * *", Timezone: "Mars/Olympus_Mons"},
+		{CronExpression: "* * * * *", MissedFirePolicy: "sometimes"},
+	} {
+		if _, err := newSchedule("wf", &req, now); err == nil {
+			t.Errorf("Expected error for %+v", req)
+		}
+	}
+}
+
+func TestDueFireTimes(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+	schedule := &Schedule{
+		CronExpression: "0 * * * *",
+		Timezone:       "UTC",
+		// The scheduler was down for three hourly fire times
+		NextRunAt: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	schedule.MissedFirePolicy = MissedFireSkip
+	due, next, err := dueFireTimes(schedule, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(due) != 1 || due[0].Hour() != 12 {
+		t.Errorf("Expected only the most recent fire time, got %v", due)
+	}
+	if expected := time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Errorf("Expected next run at %v, got %v", expected, next)
+	}
+
+	schedule.MissedFirePolicy = MissedFireCatchUp
+	due, _, _ = dueFireTimes(schedule, now)
+	if len(due) != 3 || due[0].Hour() != 10 || due[2].Hour() != 12 {
+		t.Errorf("Expected every missed fire time, got %v", due)
+	}
+
+	schedule.NextRunAt = now.Add(time.Minute)
+	if due, _, _ = dueFireTimes(schedule, now); len(due) != 0 {
+		t.Errorf("Expected nothing due, got %v", due)
+	}
+	// A schedule missed for a year skips to its latest fire time, and catches up no more
+	// than maxCatchUpRuns of the ones it missed
+	schedule.CronExpression = "* * * * *"
+	schedule.NextRunAt = now.AddDate(-1, 0, 0)
+	schedule.MissedFirePolicy = MissedFireSkip
+	if due, _, _ = dueFireTimes(schedule, now); len(due) != 1 || !due[0].Equal(now) {
+		t.Errorf("Expected only the fire time at now, got %v", due)
+	}
+	schedule.MissedFirePolicy = MissedFireCatchUp
+	due, next, _ = dueFireTimes(schedule, now)
+	if len(due) != maxCatchUpRuns || !due[0].Equal(schedule.NextRunAt) {
+		t.Errorf("Expected the first %d missed fire times, got %d from %v", maxCatchUpRuns, len(due), due[0])
+	}
+	if expected := now.Add(time.Minute); !next.Equal(expected) {
+		t.Errorf("Expected next run at %v, got %v", expected, next)
+	}
+
+	// Intervals count from the time they were last due
+	schedule.CronExpression = "@every 7m"
+	schedule.MissedFirePolicy = MissedFireSkip
+	if due, _, _ = dueFireTimes(schedule, now); len(due) != 1 || now.Sub(due[0]) >= 7*time.Minute || due[0].Sub(schedule.NextRunAt)%(7*time.Minute) != 0 {
+		t.Errorf("Expected the last interval before now, got %v", due)
+	}
+}
+
+func TestScheduler_Tick(t *testing.T) {
+	wf := testWorkflow()
+	repo := NewMockRepository(wf)
+	now := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	due := &Schedule{ID: "due", WorkflowID: wf.ID, CronExpression: "0 * * * *", Timezone: "UTC",
+		MissedFirePolicy: MissedFireCatchUp, NextRunAt: now.Add(-90 * time.Minute),
+		FormData: map[string]interface{}{"city": "Sydney"}}
+	paused := &Schedule{ID: "paused", WorkflowID: wf.ID, CronExpression: "0 * * * *", Timezone: "UTC",
+		MissedFirePolicy: MissedFireSkip, NextRunAt: now.Add(-time.Hour), Paused: true}
+	// The broken schedule's workflow cannot be loaded, it does not stop the others firing
+	broken := &Schedule{ID: "broken", WorkflowID: "missing", CronExpression: "0 * * * *", Timezone: "UTC",
+		MissedFirePolicy: MissedFireSkip, NextRunAt: now.Add(-2 * time.Hour)}
+	for _, schedule := range []*Schedule{due, paused, broken} {
+		if err := repo.CreateSchedule(context.Background(), schedule); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	scheduler := &Scheduler{repo: repo}
+	queued, err := scheduler.tick(context.Background(), now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if queued != 2 {
+		t.Errorf("Expected two caught up runs, got %d", queued)
+	}
+
+	executions, _ := repo.ListExecutions(context.Background(), wf.ID, 10, 0)
+	for _, exec := range executions {
+		if exec.Status != "queued" || exec.Inputs["city"] != "Sydney" {
+			t.Errorf("Expected a queued run with the schedule inputs, got %+v", exec)
+		}
+	}
+
+	fired, _ := repo.GetSchedule(context.Background(), "due")
+	if !fired.NextRunAt.Equal(now.Add(30*time.Minute)) || fired.LastRunAt == nil {
+		t.Errorf("Expected the schedule to move on, got %+v", fired)
+	}
+
+	retried, _ := repo.GetSchedule(context.Background(), "broken")
+	if !retried.NextRunAt.Equal(now.Add(scheduleRetryDelay)) || retried.LastRunAt != nil {
+		t.Errorf("Expected the broken schedule to be tried again later, got %+v", retried)
+	}
+
+	// The schedule has moved on, so it does not fire again
+	if queued, _ = scheduler.tick(context.Background(), now); queued != 0 {
+		t.Errorf("Expected no runs on the second tick, got %d", queued)
+	}
+}
+
+func TestService_Schedules(t *testing.T) {
+	wf := testWorkflow()
+	repo := NewMockRepository(wf)
+	service := NewServiceWithDependencies(repo, NewExecutor())
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/schedules", `{"cron": "*/5 * * * *", "timezone": "Europe/Berlin", "formData": {"city": "Berlin"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created Schedule
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode schedule: %v", err)
+	}
+	if location := rec.Header().Get("Location"); location != "/api/v1/schedules/"+created.ID {
+		t.Errorf("Expected location header for the schedule, got %q", location)
+	}
+	if created.Timezone != "Europe/Berlin" || created.MissedFirePolicy != MissedFireSkip || created.NextRunAt.IsZero() {
+		t.Errorf("Unexpected schedule: %+v", created)
+	}
+
+	rec = doRequest(router, "GET", "/api/v1/workflows/"+wf.ID+"/schedules", "")
+	var list struct {
+		Schedules []Schedule `json:"schedules"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Schedules) != 1 {
+		t.Errorf("Expected one schedule, got %s", rec.Body.String())
+	}
+
+	// Leave the schedule overdue while paused, resuming must not fire the missed runs
+	rec = doRequest(router, "POST", "/api/v1/schedules/"+created.ID+"/pause", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	repo.SetSchedulePaused(context.Background(), created.ID, true, time.Now().Add(-time.Hour))
+
+	rec = doRequest(router, "POST", "/api/v1/schedules/"+created.ID+"/resume", "")
+	var resumed Schedule
+	json.Unmarshal(rec.Body.Bytes(), &resumed)
+	if rec.Code != http.StatusOK || resumed.Paused || !resumed.NextRunAt.After(time.Now()) {
+		t.Errorf("Expected the schedule to resume from now, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(router, "DELETE", "/api/v1/schedules/"+created.ID, "")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rec.Code)
+	}
+	rec = doRequest(router, "GET", "/api/v1/schedules/"+created.ID, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestService_ScheduleErrors(t *testing.T) {
+	wf := testWorkflow()
+	service := NewServiceWithDependencies(NewMockRepository(wf), NewExecutor())
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"unknown workflow", "POST", "/api/v1/workflows/does-not-exist/schedules", `{"cron": "@hourly"}`, http.StatusNotFound},
+		{"invalid json", "POST", "/api/v1/workflows/" + wf.ID + "/schedules", `{`, http.StatusBadRequest},
+		{"invalid cron", "POST", "/api/v1/workflows/" + wf.ID + "/schedules", `{"cron": "every day"}`, http.StatusBadRequest},
+		{"invalid timezone", "POST", "/api/v1/workflows/" + wf.ID + "/schedules", `{"cron": "@daily", "timezone": "Nowhere"}`, http.StatusBadRequest},
+		{"unknown schedule", "POST", "/api/v1/schedules/does-not-exist/pause", "", http.StatusNotFound},
+		{"delete unknown schedule", "DELETE", "/api/v1/schedules/does-not-exist", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, tt.method, tt.path, tt.body)
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The types the fields of an input schema may have
+var schemaTypes = map[string]bool{
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"boolean": true,
+	"array":   true,
+	"object":  true,
+}
+
+// InputSchema declares the inputs a form node takes, in the shape of a JSON Schema object,
+// e.g. {"required": ["email"], "properties": {"email": {"type": "string", "pattern": "^\\S+@\\S+$"}}}.
+// Runs whose inputs do not match the schemas of the form nodes every run goes through are
+// rejected before they start, other forms check their schema when they run.
+type InputSchema struct {
+	Type       string                  `json:"type,omitempty"`
+	Properties map[string]*FieldSchema `json:"properties"`
+	Required   []string                `json:"required,omitempty"`
+}
+
+// FieldSchema declares the type and constraints of a single input
+type FieldSchema struct {
+	Type string `json:"type"`
+	// Enum lists the values the input may have, if set
+	Enum []interface{} `json:"enum,omitempty"`
+	// Pattern is a regular expression string inputs must match
+	Pattern   string   `json:"pattern,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	// Default is used when the input is missing
+	Default interface{} `json:"default,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// FieldError reports an input that does not match the input schema
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// InputValidationResult is the response to a run whose inputs do not match the input schema
+type InputValidationResult struct {
+	Valid  bool         `json:"valid"`
+	Errors []FieldError `json:"errors"`
+}
+
+// Read the input schema of a form node, nil if it has none
+func parseInputSchema(node *Node) (*InputSchema, error) {
+	raw, ok := node.Data.Metadata["inputSchema"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("inputSchema must be an object")
+	}
+	var schema InputSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("inputSchema must be an object with properties")
+	}
+	if schema.Type != "" && schema.Type != "object" {
+		return nil, fmt.Errorf("inputSchema must have the type \"object\"")
+	}
+
+	for name, field := range schema.Properties {
+		if field == nil || !schemaTypes[field.Type] {
+			return nil, fmt.Errorf("inputSchema property %s must have a type of string, number, integer, boolean, array or object", name)
+		}
+		if field.Pattern != "" {
+			if field.Type != "string" {
+				return nil, fmt.Errorf("inputSchema property %s has a pattern but is not a string", name)
+			}
+			if field.pattern, err = regexp.Compile(field.Pattern); err != nil {
+				return nil, fmt.Errorf("inputSchema property %s has an invalid pattern: %v", name, err)
+			}
+		}
+		if field.Minimum != nil && field.Maximum != nil && *field.Minimum > *field.Maximum {
+			return nil, fmt.Errorf("inputSchema property %s has a minimum above its maximum", name)
+		}
+		if field.MinLength != nil && field.MaxLength != nil && *field.MinLength > *field.MaxLength {
+			return nil, fmt.Errorf("inputSchema property %s has a minLength above its maxLength", name)
+		}
+		for _, value := range field.Enum {
+			if _, problem := field.convert(value); problem != "" {
+				return nil, fmt.Errorf("inputSchema property %s has an enum value %v that %s", name, value, problem)
+			}
+		}
+		// Defaults are filled in for missing inputs as they are, so they must already match
+		if field.Default != nil {
+			converted, problem := field.convert(field.Default)
+			if problem != "" {
+				return nil, fmt.Errorf("inputSchema property %s has a default %v that %s", name, field.Default, problem)
+			}
+			field.Default = converted
+		}
+	}
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			return nil, fmt.Errorf("inputSchema requires %s, which is not one of its properties", name)
+		}
+	}
+
+	return &schema, nil
+}
+
+// The input schema of a workflow, made up of the schemas of the form nodes that run
+// whichever path a run takes. Forms on branches that may not run, such as those after a
+// condition, check their inputs when they run. Nil if none of them have a schema. Invalid
+// schemas are left out, they are reported when the graph is validated
+func workflowInputSchema(graph WorkflowGraph) *InputSchema {
+	v := &validator{graph: graph, nodes: make(map[string]*Node)}
+	var start *Node
+	for i := range graph.Nodes {
+		node := &graph.Nodes[i]
+		if _, ok := v.nodes[node.ID]; !ok {
+			v.nodes[node.ID] = node
+		}
+		if node.Type == "start" {
+			start = node
+		}
+	}
+	if start == nil {
+		return nil
+	}
+	always := v.nodesOnEveryPath(start.ID, v.reachableFrom(start.ID))
+
+	var merged *InputSchema
+	for i := range graph.Nodes {
+		node := &graph.Nodes[i]
+		if node.Type != "form" || !always[node.ID] {
+			continue
+		}
+		schema, err := parseInputSchema(node)
+		if err != nil || schema == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &InputSchema{Properties: map[string]*FieldSchema{}}
+		}
+		for name, field := range schema.Properties {
+			merged.Properties[name] = field
+		}
+		merged.Required = append(merged.Required, schema.Required...)
+	}
+	return merged
+}
+
+// Check the inputs against the schema, returning a copy of them with the values converted
+// to the types of their fields and the defaults of missing ones filled in, along with the
+// fields that do not match
+func (schema *InputSchema) check(inputs map[string]interface{}) (map[string]interface{}, []FieldError) {
+	checked := copyVars(inputs)
+	var errs []FieldError
+
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := schema.Properties[name]
+		value, ok := checked[name]
+		if !ok || value == nil || value == "" {
+			if field.Default != nil {
+				checked[name] = field.Default
+			} else if required[name] {
+				errs = append(errs, FieldError{Field: name, Message: "is required"})
+			}
+			continue
+		}
+
+		converted, problem := field.convert(value)
+		if problem != "" {
+			errs = append(errs, FieldError{Field: name, Message: problem})
+			continue
+		}
+		checked[name] = converted
+	}
+
+	return checked, errs
+}
+
+// Convert the value to the type of the field and check it against the field's constraints,
+// returning a description of the problem if it does not match. Strings are accepted for
+// numbers and booleans, as inputs from forms and webhooks often are
+func (field *FieldSchema) convert(value interface{}) (interface{}, string) {
+	switch field.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, "must be a string"
+		}
+		length := utf8.RuneCountInString(s)
+		if field.MinLength != nil && length < *field.MinLength {
+			return nil, fmt.Sprintf("must be at least %d characters", *field.MinLength)
+		}
+		if field.MaxLength != nil && length > *field.MaxLength {
+			return nil, fmt.Sprintf("must be at most %d characters", *field.MaxLength)
+		}
+		if field.pattern != nil && !field.pattern.MatchString(s) {
+			return nil, fmt.Sprintf("must match the pattern %s", field.Pattern)
+		}
+
+	case "number", "integer":
+		n, ok := toFloat(value)
+		if s, isString := value.(string); isString {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			n, ok = parsed, err == nil
+		}
+		if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, "must be a number"
+		}
+		if field.Type == "integer" && n != math.Trunc(n) {
+			return nil, "must be a whole number"
+		}
+		if field.Minimum != nil && n < *field.Minimum {
+			return nil, fmt.Sprintf("must be at least %v", *field.Minimum)
+		}
+		if field.Maximum != nil && n > *field.Maximum {
+			return nil, fmt.Sprintf("must be at most %v", *field.Maximum)
+		}
+		// Numbers are float64 whatever they were given as, as they are when decoded from JSON
+		value = n
+
+	case "boolean":
+		if s, ok := value.(string); ok {
+			parsed, err := strconv.ParseBool(strings.TrimSpace(s))
+			if err != nil {
+				return nil, "must be true or false"
+			}
+			value = parsed
+		}
+		if _, ok := value.(bool); !ok {
+			return nil, "must be true or false"
+		}
+
+	case "array":
+		list, ok := toList(value)
+		if !ok {
+			return nil, "must be a list"
+		}
+		value = list
+
+	case "object":
+		if _, ok := value.(map[string]interface{}); !ok {
+			return nil, "must be an object"
+		}
+	}
+
+	if len(field.Enum) > 0 && !field.allows(value) {
+		options := make([]string, len(field.Enum))
+		for i, option := range field.Enum {
+			options[i] = stringify(option)
+		}
+		return nil, fmt.Sprintf("must be one of %s", strings.Join(options, ", "))
+	}
+	return value, ""
+}
+
+// Whether the converted value is one of the field's enum values
+func (field *FieldSchema) allows(value interface{}) bool {
+	for _, option := range field.Enum {
+		if n, ok := toFloat(value); ok {
+			if m, ok := toFloat(option); ok && n == m {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(value, option) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A form taking a name, email and city, and the threshold of the weather condition
+func schemaWorkflow() *Workflow {
+	wf := sequenceWorkflow(
+		Node{ID: "start", Type: "start"},
+		Node{ID: "form", Type: "form", Data: NodeData{Metadata: map[string]interface{}{
+			"inputFields": []interface{}{"name", "email", "city", "threshold"},
+			"inputSchema": map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"name", "email", "city"},
+				"properties": map[string]interface{}{
+					"name":      map[string]interface{}{"type": "string", "maxLength": 20},
+					"email":     map[string]interface{}{"type": "string", "pattern": `^[^@\s]+@[^@\s]+\.[^@\s]+$`},
+					"city":      map[string]interface{}{"type": "string", "enum": []interface{}{"Sydney", "Melbourne", "Brisbane"}},
+					"threshold": map[string]interface{}{"type": "number", "minimum": -50, "maximum": 60, "default": 25},
+					"notify":    map[string]interface{}{"type": "boolean", "default": "false"},
+				},
+			},
+		}}},
+		Node{ID: "end", Type: "end"},
+	)
+	wf.ID = "550e8400-e29b-41d4-a716-446655440000"
+	return wf
+}
+
+func TestInputSchema_Check(t *testing.T) {
+	schema := workflowInputSchema(schemaWorkflow().Definition)
+	if schema == nil {
+		t.Fatalf("Expected the form's schema")
+	}
+
+	checked, errs := schema.check(map[string]interface{}{
+		"name": "Alice", "email": "alice@example.com", "city": "Sydney", "notify": "true", "operator": "greater_than",
+	})
+	if len(errs) != 0 {
+		t.Fatalf("Expected the inputs to match, got %+v", errs)
+	}
+	expected := map[string]interface{}{
+		"name": "Alice", "email": "alice@example.com", "city": "Sydney", "notify": true, "operator": "greater_than", "threshold": 25.0,
+	}
+	if !reflect.DeepEqual(checked, expected) {
+		t.Errorf("Expected converted inputs with defaults %v, got %v", expected, checked)
+	}
+
+	// Numbers are float64 whatever they are given as
+	for _, threshold := range []interface{}{30, int64(30), 30.0, "30"} {
+		checked, errs := schema.check(map[string]interface{}{"name": "Alice", "email": "alice@example.com", "city": "Sydney", "threshold": threshold})
+		if len(errs) != 0 || checked["threshold"] != 30.0 {
+			t.Errorf("Expected threshold %#v to be 30.0, got %#v: %+v", threshold, checked["threshold"], errs)
+		}
+		// Defaults are converted like the inputs
+		if checked["notify"] != false {
+			t.Errorf("Expected the notify default to be false, got %#v", checked["notify"])
+		}
+	}
+
+	_, errs = schema.check(map[string]interface{}{
+		"name": strings.Repeat("a", 21), "email": "alice", "city": "Perth", "threshold": 100, "notify": "maybe",
+	})
+	expectedErrs := []FieldError{
+		{Field: "city", Message: "must be one of Sydney, Melbourne, Brisbane"},
+		{Field: "email", Message: `must match the pattern ^[^@\s]+@[^@\s]+\.[^@\s]+$`},
+		{Field: "name", Message: "must be at most 20 characters"},
+		{Field: "notify", Message: "must be true or false"},
+		{Field: "threshold", Message: "must be at most 60"},
+	}
+	if !reflect.DeepEqual(errs, expectedErrs) {
+		t.Errorf("Expected field errors %+v, got %+v", expectedErrs, errs)
+	}
+
+	_, errs = schema.check(map[string]interface{}{"email": "", "threshold": "warm"})
+	expectedErrs = []FieldError{
+		{Field: "city", Message: "is required"},
+		{Field: "email", Message: "is required"},
+		{Field: "name", Message: "is required"},
+		{Field: "threshold", Message: "must be a number"},
+	}
+	if !reflect.DeepEqual(errs, expectedErrs) {
+		t.Errorf("Expected field errors %+v, got %+v", expectedErrs, errs)
+	}
+}
+
+func TestInputSchema_OnlyFormsOnEveryPath(t *testing.T) {
+	wf := schemaWorkflow()
+	// A second form asks for a manager, but only for hot days
+	wf.Definition.Nodes = append(wf.Definition.Nodes,
+		Node{ID: "condition", Type: "condition"},
+		Node{ID: "escalate", Type: "form", Data: NodeData{Metadata: map[string]interface{}{
+			"inputFields": []interface{}{"manager"},
+			"inputSchema": map[string]interface{}{
+				"required":   []interface{}{"manager"},
+				"properties": map[string]interface{}{"manager": map[string]interface{}{"type": "string"}},
+			},
+		}}},
+	)
+	wf.Definition.Edges = []Edge{
+		{ID: "e1", Source: "start", Target: "form"},
+		{ID: "e2", Source: "form", Target: "condition"},
+		{ID: "e3", Source: "condition", SourceHandle: "true", Target: "escalate"},
+		{ID: "e4", Source: "condition", SourceHandle: "false", Target: "end"},
+		{ID: "e5", Source: "escalate", Target: "end"},
+	}
+	if result := Validate(wf.Definition); !result.Valid {
+		t.Fatalf("Expected the workflow to be valid, got %+v", result.Diagnostics)
+	}
+
+	schema := workflowInputSchema(wf.Definition)
+	if schema == nil || schema.Properties["manager"] != nil || schema.Properties["email"] == nil {
+		t.Fatalf("Expected only the first form's schema, got %+v", schema)
+	}
+	if _, errs := schema.check(map[string]interface{}{"name": "Alice", "email": "alice@example.com", "city": "Sydney"}); len(errs) != 0 {
+		t.Errorf("Expected the inputs to match without a manager, got %+v", errs)
+	}
+
+	// Once every path goes through the second form, its inputs are checked up front too
+	wf.Definition.Edges[3].Target = "escalate"
+	if schema := workflowInputSchema(wf.Definition); schema == nil || schema.Properties["manager"] == nil {
+		t.Errorf("Expected both forms' schemas, got %+v", schema)
+	}
+}
+
+func TestExecutor_FormChecksInputSchema(t *testing.T) {
+	executor := NewExecutor()
+	wf := schemaWorkflow()
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{"name": "Alice", "email": "alice@example.com", "city": "Sydney", "threshold": "30"})
+	if result.Status != "completed" || result.Variables["threshold"] != 30.0 || result.Steps[1].Output["threshold"] != 30.0 {
+		t.Errorf("Expected the form to convert the threshold, got %s: %+v", result.Status, result.Steps)
+	}
+
+	result = executor.Execute(context.Background(), wf, map[string]interface{}{"name": "Alice", "email": "alice", "city": "Sydney"})
+	if result.Status != "failed" || result.Steps[1].Error != `invalid input fields: email must match the pattern ^[^@\s]+@[^@\s]+\.[^@\s]+$` {
+		t.Errorf("Expected the form to fail, got %s: %+v", result.Status, result.Steps)
+	}
+}
+
+func TestService_ExecuteChecksInputSchema(t *testing.T) {
+	wf := schemaWorkflow()
+	service := NewServiceWithDependencies(NewMockRepository(wf), NewExecutor())
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute",
+		`{"formData":{"name":"Alice","email":"alice","city":"Perth"},"condition":{"operator":"greater_than","threshold":"hot"}}`)
+	if rec.Code != 422 {
+		t.Fatalf("Expected the inputs to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var rejected InputValidationResult
+	json.Unmarshal(rec.Body.Bytes(), &rejected)
+	var fields []string
+	for _, fieldErr := range rejected.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	if rejected.Valid || !reflect.DeepEqual(fields, []string{"city", "email", "threshold"}) {
+		t.Errorf("Expected errors for the city, email and threshold, got %+v", rejected)
+	}
+
+	// The condition's threshold is an input like the form data
+	rec = doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute",
+		`{"formData":{"name":"Alice","email":"alice@example.com","city":"Sydney"},"condition":{"operator":"greater_than","threshold":"30"}}`)
+	var result ExecutionResponse
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if rec.Code != 200 || result.Status != "completed" || result.Steps[1].Output["threshold"] != 30.0 {
+		t.Errorf("Expected the run to complete, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Scheduled runs are checked when they are scheduled
+	rec = doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/schedules",
+		`{"cronExpression":"0 9 * * *","formData":{"name":"Alice","email":"alice@example.com"}}`)
+	if rec.Code != 422 || !strings.Contains(rec.Body.String(), `"field":"city"`) {
+		t.Errorf("Expected the schedule to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestValidate_InputSchema(t *testing.T) {
+	for _, schema := range []interface{}{
+		"name",
+		map[string]interface{}{"type": "array"},
+		map[string]interface{}{"properties": map[string]interface{}{"name": map[string]interface{}{"type": "text"}}},
+		map[string]interface{}{"properties": map[string]interface{}{"email": map[string]interface{}{"type": "string", "pattern": "("}}},
+		map[string]interface{}{"properties": map[string]interface{}{"threshold": map[string]interface{}{"type": "number", "minimum": 10, "maximum": 0}}},
+		map[string]interface{}{"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string", "enum": []interface{}{"Sydney", 1}}}},
+		map[string]interface{}{"required": []interface{}{"name"}, "properties": map[string]interface{}{}},
+		map[string]interface{}{"properties": map[string]interface{}{"count": map[string]interface{}{"type": "integer", "default": "abc"}}},
+		map[string]interface{}{"properties": map[string]interface{}{"threshold": map[string]interface{}{"type": "number", "maximum": 60, "default": 100}}},
+		map[string]interface{}{"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string", "enum": []interface{}{"Sydney"}, "default": "Perth"}}},
+	} {
+		wf := schemaWorkflow()
+		wf.Definition.Nodes[1].Data.Metadata["inputSchema"] = schema
+		result := Validate(wf.Definition)
+		if result.Valid || len(result.Diagnostics) != 1 || result.Diagnostics[0].Code != "invalid_metadata" {
+			t.Errorf("Expected %v to be invalid metadata, got %+v", schema, result.Diagnostics)
+		}
+	}
+
+	if result := Validate(schemaWorkflow().Definition); !result.Valid {
+		t.Errorf("Expected the schema to be valid, got %+v", result.Diagnostics)
+	}
+	// Forms setting the same input must agree on its type
+	wf := schemaWorkflow()
+	wf.Definition.Nodes = append(wf.Definition.Nodes[:2], Node{ID: "confirm", Type: "form", Data: NodeData{Metadata: map[string]interface{}{
+		"inputFields": []interface{}{"threshold"},
+		"inputSchema": map[string]interface{}{
+			"properties": map[string]interface{}{"threshold": map[string]interface{}{"type": "string"}},
+		},
+	}}}, wf.Definition.Nodes[2])
+	wf.Definition.Edges = []Edge{
+		{ID: "e1", Source: "start", Target: "form"},
+		{ID: "e2", Source: "form", Target: "confirm"},
+		{ID: "e3", Source: "confirm", Target: "end"},
+	}
+	result := Validate(wf.Definition)
+	if result.Valid || len(result.Diagnostics) != 1 || result.Diagnostics[0].Code != "conflicting_input_schema" || result.Diagnostics[0].NodeID != "confirm" {
+		t.Errorf("Expected conflicting input types, got %+v", result.Diagnostics)
+	}
+}
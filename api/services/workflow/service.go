@@ -1,6 +1,7 @@
 package workflow
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -8,28 +9,44 @@ import (
 )
 
 type Service struct {
-	repo     RepositoryInterface
-	executor ExecutorInterface
+	repo      RepositoryInterface
+	executor  ExecutorInterface
+	runner    *Runner
+	scheduler *Scheduler
 }
 
-func NewService(pool *pgxpool.Pool) (*Service, error) {
+func NewService(pool *pgxpool.Pool, options ...ExecutorOption) (*Service, error) {
 	repo := NewRepository(pool)
-	executor := NewExecutor()
+	// Subworkflow nodes load their workflows from the repository, unless the options say otherwise
+	executor := NewExecutor(append([]ExecutorOption{WithWorkflowStore(repo)}, options...)...)
 
-	return &Service{
-		repo:     repo,
-		executor: executor,
-	}, nil
+	return NewServiceWithDependencies(repo, executor), nil
 }
 
 // NewServiceWithDependencies for mocking
 func NewServiceWithDependencies(repo RepositoryInterface, executor ExecutorInterface) *Service {
+	runner := NewRunner(repo, executor, DefaultRunnerConfig())
 	return &Service{
-		repo:     repo,
-		executor: executor,
+		repo:      repo,
+		executor:  executor,
+		runner:    runner,
+		scheduler: NewScheduler(repo, runner, 0),
 	}
 }
 
+// Start starts the runner's workers and the scheduler, which run until ctx is done or the
+// service is closed
+func (s *Service) Start(ctx context.Context) {
+	s.runner.Start(ctx)
+	s.scheduler.Start(ctx)
+}
+
+// Close stops the scheduler and the runner, handing the asynchronous runs in progress back to the queue
+func (s *Service) Close() {
+	s.scheduler.Stop()
+	s.runner.Stop()
+}
+
 // jsonMiddleware sets the Content-Type header to application/json
 func jsonMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -43,6 +60,44 @@ func (s *Service) LoadRoutes(parentRouter *mux.Router, isProduction bool) {
 	router.StrictSlash(false)
 	router.Use(jsonMiddleware)
 
+	router.HandleFunc("", s.HandleListWorkflows).Methods("GET")
+	router.HandleFunc("", s.HandleCreateWorkflow).Methods("POST")
+	router.HandleFunc("/validate", s.HandleValidateWorkflow).Methods("POST")
 	router.HandleFunc("/{id}", s.HandleGetWorkflow).Methods("GET")
+	router.HandleFunc("/{id}", s.HandleUpdateWorkflow).Methods("PUT")
+	router.HandleFunc("/{id}", s.HandleDeleteWorkflow).Methods("DELETE")
 	router.HandleFunc("/{id}/execute", s.HandleExecuteWorkflow).Methods("POST")
+	router.HandleFunc("/{id}/executions", s.HandleListExecutions).Methods("GET")
+	router.HandleFunc("/{id}/versions", s.HandleListWorkflowVersions).Methods("GET")
+	router.HandleFunc("/{id}/versions/{version:[0-9]+}", s.HandleGetWorkflowVersion).Methods("GET")
+	router.HandleFunc("/{id}/versions/{version:[0-9]+}/rollback", s.HandleRollbackWorkflow).Methods("POST")
+	router.HandleFunc("/{id}/diff", s.HandleDiffWorkflowVersions).Methods("GET")
+	router.HandleFunc("/{id}/schedules", s.HandleListSchedules).Methods("GET")
+	router.HandleFunc("/{id}/schedules", s.HandleCreateSchedule).Methods("POST")
+	router.HandleFunc("/{id}/webhook", s.HandleGetWebhook).Methods("GET")
+	router.HandleFunc("/{id}/webhook", s.HandleCreateWebhook).Methods("POST")
+	router.HandleFunc("/{id}/webhook", s.HandleDeleteWebhook).Methods("DELETE")
+
+	executionRouter := parentRouter.PathPrefix("/executions").Subrouter()
+	executionRouter.StrictSlash(false)
+	executionRouter.Use(jsonMiddleware)
+
+	executionRouter.HandleFunc("/{runId}", s.HandleGetExecution).Methods("GET")
+	executionRouter.HandleFunc("/{runId}/approve", s.HandleApproveExecution).Methods("POST")
+	executionRouter.HandleFunc("/{runId}/reject", s.HandleRejectExecution).Methods("POST")
+
+	scheduleRouter := parentRouter.PathPrefix("/schedules").Subrouter()
+	scheduleRouter.StrictSlash(false)
+	scheduleRouter.Use(jsonMiddleware)
+
+	scheduleRouter.HandleFunc("/{scheduleId}", s.HandleGetSchedule).Methods("GET")
+	scheduleRouter.HandleFunc("/{scheduleId}", s.HandleDeleteSchedule).Methods("DELETE")
+	scheduleRouter.HandleFunc("/{scheduleId}/pause", s.HandlePauseSchedule).Methods("POST")
+	scheduleRouter.HandleFunc("/{scheduleId}/resume", s.HandleResumeSchedule).Methods("POST")
+
+	// Webhooks are called by external systems, and respond with whatever the trigger configures
+	hookRouter := parentRouter.PathPrefix("/hooks").Subrouter()
+	hookRouter.StrictSlash(false)
+
+	hookRouter.HandleFunc("/{token}", s.HandleTriggerWebhook).Methods("POST")
 }
@@ -0,0 +1,191 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxSubworkflowDepth is how deeply subworkflow nodes may nest, so a workflow that runs
+// itself, directly or through others, fails instead of recursing forever
+const maxSubworkflowDepth = 5
+
+// Modes of subworkflow nodes. Synchronous subworkflows run within the node, which waits for
+// them and maps their outputs back. Asynchronous ones are queued as runs of their own, and
+// the node continues straight away.
+const (
+	SubworkflowSync  = "sync"
+	SubworkflowAsync = "async"
+)
+
+// WithWorkflowStore sets where subworkflow nodes load the workflows they run from, and
+// queue the runs they start asynchronously. Without one subworkflow nodes fail.
+func WithWorkflowStore(store WorkflowStore) ExecutorOption {
+	return func(e *Executor) {
+		e.workflows = store
+	}
+}
+
+// subworkflowConfig is read from the metadata of a subworkflow node
+type subworkflowConfig struct {
+	workflowID string
+	mode       string
+	// inputs are the inputs of the subworkflow, values that may use {{placeholders}} for
+	// the variables of the parent
+	inputs map[string]interface{}
+	// outputs maps variables of the parent to the variables of the subworkflow they are
+	// set from once it completes
+	outputs map[string]string
+}
+
+func parseSubworkflowConfig(node *Node) (*subworkflowConfig, error) {
+	metadata := node.Data.Metadata
+	config := &subworkflowConfig{mode: SubworkflowSync, outputs: map[string]string{}}
+
+	workflowID, ok := metadata["workflowId"].(string)
+	if !ok || workflowID == "" {
+		return nil, fmt.Errorf("workflowId must be a non-empty string")
+	}
+	config.workflowID = workflowID
+
+	if raw, ok := metadata["mode"]; ok {
+		mode, _ := raw.(string)
+		if mode != SubworkflowSync && mode != SubworkflowAsync {
+			return nil, fmt.Errorf("mode must be %q or %q", SubworkflowSync, SubworkflowAsync)
+		}
+		config.mode = mode
+	}
+
+	if raw, ok := metadata["inputs"]; ok && raw != nil {
+		inputs, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("inputs must be an object")
+		}
+		config.inputs = inputs
+	}
+
+	if raw, ok := metadata["outputs"]; ok && raw != nil {
+		outputs, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("outputs must be an object of variable names")
+		}
+		for parent, child := range outputs {
+			name, ok := child.(string)
+			if !ok || name == "" {
+				return nil, fmt.Errorf("outputs must be an object of variable names")
+			}
+			config.outputs[parent] = name
+		}
+		if len(config.outputs) > 0 && config.mode == SubworkflowAsync {
+			return nil, fmt.Errorf("outputs cannot be mapped back from asynchronous subworkflows")
+		}
+	}
+
+	return config, nil
+}
+
+type subworkflowDepthKey struct{}
+
+// Attach how deeply the run is nested within subworkflow nodes to the context its handlers
+// run with
+func withSubworkflowDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, subworkflowDepthKey{}, depth)
+}
+
+// How deeply the run the handler is running in is nested, 0 for runs that were not started
+// by a subworkflow node
+func subworkflowDepth(ctx context.Context) int {
+	depth, _ := ctx.Value(subworkflowDepthKey{}).(int)
+	return depth
+}
+
+// Process the subworkflow node, this runs another stored workflow with inputs mapped from
+// the variables of the run. Synchronous subworkflows are recorded in the node's output with
+// their steps, and their outputs are mapped back to the variables of the run. Asynchronous
+// ones are queued, and only their execution ID is recorded.
+func (e *Executor) processSubworkflowNode(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+	config, err := parseSubworkflowConfig(node)
+	if err != nil {
+		return err
+	}
+	if e.workflows == nil {
+		return fmt.Errorf("subworkflows are not available, the executor has no workflow store")
+	}
+
+	depth := subworkflowDepth(ctx) + 1
+	if depth > maxSubworkflowDepth {
+		return fmt.Errorf("subworkflow %s exceeds the maximum nesting depth of %d", config.workflowID, maxSubworkflowDepth)
+	}
+
+	wf, err := e.workflows.GetWorkflow(ctx, config.workflowID)
+	if err != nil {
+		return fmt.Errorf("failed to load subworkflow %s: %w", config.workflowID, err)
+	}
+
+	inputs := map[string]interface{}{}
+	if config.inputs != nil {
+		rendered, err := renderTemplateValue(config.inputs, wfVars)
+		if err != nil {
+			return fmt.Errorf("invalid subworkflow inputs: %w", err)
+		}
+		inputs = rendered.(map[string]interface{})
+	}
+
+	step.Output = map[string]interface{}{
+		"workflowId":      wf.ID,
+		"workflowVersion": wf.Version,
+		"mode":            config.mode,
+	}
+
+	if config.mode == SubworkflowAsync {
+		execution := &Execution{
+			ID:              uuid.NewString(),
+			WorkflowID:      wf.ID,
+			WorkflowVersion: wf.Version,
+			Definition:      wf.Definition,
+			Inputs:          inputs,
+			Status:          "queued",
+			StartedAt:       time.Now(),
+			Steps:           []ExecutionStep{},
+			ParentID:        executionIDFrom(ctx),
+			Depth:           depth,
+		}
+		if err := e.workflows.EnqueueExecution(ctx, execution); err != nil {
+			return fmt.Errorf("failed to queue subworkflow %s: %w", wf.ID, err)
+		}
+		step.Output["executionId"] = execution.ID
+		return nil
+	}
+
+	// The subworkflow is not a recorded run of its own, so it cannot be resumed or decided
+	subCtx := withSubworkflowDepth(withExecutionID(ctx, ""), depth)
+	result := e.Execute(subCtx, wf, inputs)
+	step.Output["status"] = result.Status
+	step.Output["steps"] = result.Steps
+
+	switch result.Status {
+	case "completed":
+	case "waiting":
+		return fmt.Errorf("subworkflow %s cannot wait, run it asynchronously instead", wf.ID)
+	default:
+		// Report the step that failed the subworkflow, rather than its failure path
+		for _, failed := range result.Steps {
+			if failed.Error != "" {
+				return fmt.Errorf("subworkflow %s %s at node %s: %s", wf.ID, result.Status, failed.NodeID, failed.Error)
+			}
+		}
+		return fmt.Errorf("subworkflow %s %s", wf.ID, result.Status)
+	}
+
+	outputs := map[string]interface{}{}
+	for parent, child := range config.outputs {
+		if value, ok := result.Variables[child]; ok {
+			wfVars[parent] = value
+			outputs[parent] = value
+		}
+	}
+	step.Output["outputs"] = outputs
+	return nil
+}
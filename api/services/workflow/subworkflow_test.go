@@ -0,0 +1,156 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const (
+	greetWorkflowID  = "11111111-1111-1111-1111-111111111111"
+	parentWorkflowID = "22222222-2222-2222-2222-222222222222"
+)
+
+// A workflow that greets the name it is given
+func greetWorkflow() *Workflow {
+	wf := sequenceWorkflow(Node{ID: "start", Type: "start"}, Node{ID: "greet", Type: "greet"}, Node{ID: "end", Type: "end"})
+	wf.ID = greetWorkflowID
+	return wf
+}
+
+// A workflow that runs another through a subworkflow node
+func parentWorkflow(metadata map[string]interface{}) *Workflow {
+	wf := sequenceWorkflow(
+		Node{ID: "start", Type: "start"},
+		Node{ID: "sub", Type: "subworkflow", Data: NodeData{Metadata: metadata}},
+		Node{ID: "end", Type: "end"},
+	)
+	wf.ID = parentWorkflowID
+	return wf
+}
+
+func subworkflowExecutor(store WorkflowStore) *Executor {
+	executor := NewExecutor(WithWorkflowStore(store))
+	executor.RegisterNodeType("greet", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		name, ok := wfVars["name"].(string)
+		if !ok {
+			return fmt.Errorf("no name to greet")
+		}
+		wfVars["greeting"] = "Hello " + name
+		return nil
+	}))
+	return executor
+}
+
+func TestExecutor_Subworkflow(t *testing.T) {
+	wf := parentWorkflow(map[string]interface{}{
+		"workflowId": greetWorkflowID,
+		"inputs":     map[string]interface{}{"name": "{{user}}"},
+		"outputs":    map[string]interface{}{"message": "greeting"},
+	})
+	executor := subworkflowExecutor(NewMockRepository(greetWorkflow()))
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{"user": "Ada"})
+	if result.Status != "completed" || len(result.Steps) != 3 {
+		t.Fatalf("Expected the run to complete, got %s: %+v", result.Status, result.Steps)
+	}
+	if result.Variables["message"] != "Hello Ada" || result.Variables["greeting"] != nil {
+		t.Errorf("Expected only the mapped output in the parent, got %v", result.Variables)
+	}
+	output := result.Steps[1].Output
+	steps, _ := output["steps"].([]ExecutionStep)
+	if output["status"] != "completed" || len(steps) != 3 || steps[1].NodeID != "greet" {
+		t.Errorf("Expected the subworkflow's steps in the output, got %+v", output)
+	}
+
+	// Failures of the subworkflow fail the node
+	result = executor.Execute(context.Background(), wf, map[string]interface{}{"user": 42})
+	if result.Status != "failed" || !strings.Contains(result.Steps[1].Error, "at node greet: no name to greet") {
+		t.Errorf("Expected the subworkflow failure to fail the node, got %s: %+v", result.Status, result.Steps)
+	}
+
+	// Unknown workflows cannot be run
+	wf = parentWorkflow(map[string]interface{}{"workflowId": "unknown"})
+	result = executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "failed" || !strings.Contains(result.Steps[1].Error, "failed to load subworkflow unknown") {
+		t.Errorf("Expected the node to fail, got %s: %+v", result.Status, result.Steps)
+	}
+}
+
+func TestExecutor_SubworkflowDepth(t *testing.T) {
+	// The workflow runs itself
+	wf := parentWorkflow(map[string]interface{}{"workflowId": parentWorkflowID})
+	executor := subworkflowExecutor(NewMockRepository(wf))
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "failed" || !strings.Contains(result.Steps[1].Error, "exceeds the maximum nesting depth of 5") {
+		t.Fatalf("Expected the recursion to be stopped, got %s: %+v", result.Status, result.Steps)
+	}
+
+	// Each level records the one below it
+	levels := 0
+	for steps := result.Steps; len(steps) > 1; levels++ {
+		steps, _ = steps[1].Output["steps"].([]ExecutionStep)
+	}
+	if levels != maxSubworkflowDepth+1 {
+		t.Errorf("Expected %d levels of subworkflows, got %d", maxSubworkflowDepth+1, levels)
+	}
+}
+
+func TestService_AsyncSubworkflow(t *testing.T) {
+	wf := parentWorkflow(map[string]interface{}{
+		"workflowId": greetWorkflowID,
+		"mode":       SubworkflowAsync,
+		"inputs":     map[string]interface{}{"name": "{{user}}"},
+	})
+	repo := NewMockRepository(wf, greetWorkflow())
+	service := NewServiceWithDependencies(repo, subworkflowExecutor(repo))
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute?async=true", `{"formData":{"user":"Ada"}}`)
+	var queued struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &queued)
+	parent := waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "completed"
+	})
+	childID, _ := parent.Steps[1].Output["executionId"].(string)
+	if childID == "" {
+		t.Fatalf("Expected the subworkflow to be queued, got %+v", parent.Steps[1])
+	}
+
+	child := waitForExecution(t, router, childID, func(exec *Execution) bool {
+		return exec.Status == "completed"
+	})
+	if child.WorkflowID != greetWorkflowID || child.ParentID != queued.ID || child.Depth != 1 || child.Inputs["name"] != "Ada" {
+		t.Errorf("Expected a run of the subworkflow started by the parent, got %+v", child)
+	}
+}
+
+func TestValidate_Subworkflow(t *testing.T) {
+	for _, metadata := range []map[string]interface{}{
+		{},
+		{"workflowId": greetWorkflowID, "mode": "later"},
+		{"workflowId": greetWorkflowID, "inputs": "name"},
+		{"workflowId": greetWorkflowID, "outputs": map[string]interface{}{"message": 42}},
+		// Asynchronous subworkflows finish after the node, there is nothing to map back
+		{"workflowId": greetWorkflowID, "mode": SubworkflowAsync, "outputs": map[string]interface{}{"message": "greeting"}},
+	} {
+		result := Validate(parentWorkflow(metadata).Definition)
+		if result.Valid || len(result.Diagnostics) != 1 || result.Diagnostics[0].Code != "invalid_metadata" {
+			t.Errorf("Expected %v to be invalid metadata, got %+v", metadata, result.Diagnostics)
+		}
+	}
+
+	// Mapped outputs are variables of the parent
+	wf := parentWorkflow(map[string]interface{}{"workflowId": greetWorkflowID, "outputs": map[string]interface{}{"message": "greeting"}})
+	wf.Definition.Nodes[2].Data.Metadata = map[string]interface{}{"inputVariables": []interface{}{"message"}}
+	if result := Validate(wf.Definition); !result.Valid || len(result.Diagnostics) != 0 {
+		t.Errorf("Expected the workflow to be valid, got %+v", result.Diagnostics)
+	}
+}
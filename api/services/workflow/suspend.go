@@ -0,0 +1,137 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SuspendError is returned by handlers whose node waits for something outside the run, such
+// as a decision from a person. The run stops with the waiting status once the node's step
+// is recorded, and continues from the node when it is resumed.
+type SuspendError struct {
+	// Until is when the wait expires, zero if it never does
+	Until time.Time
+	// TimeoutHandle and TimeoutOutput are the handle and output the node is resumed with
+	// once the wait expires
+	TimeoutHandle string
+	TimeoutOutput map[string]interface{}
+	// Variable receives the output the node is resumed with, if set
+	Variable string
+	// Approvers may resume the node by presenting the token TokenHash is the hash of. Anyone
+	// may if there are none
+	Approvers []string
+	TokenHash string
+}
+
+func (e *SuspendError) Error() string {
+	if e.Until.IsZero() {
+		return "node is waiting"
+	}
+	return fmt.Sprintf("node is waiting until %s", e.Until.Format(time.RFC3339))
+}
+
+// errSuspended is returned by walk when the run stops at a waiting node
+var errSuspended = errors.New("run suspended")
+
+// Stop the run at the waiting node of the branch, keeping the state needed to resume it
+func (run *execution) suspend(b *branch, node *Node, step *ExecutionStep) error {
+	wait := step.suspend
+	state := run.snapshot(b, node)
+	state.Waiting = true
+	state.TimeoutHandle = wait.TimeoutHandle
+	state.TimeoutOutput = wait.TimeoutOutput
+	state.Variable = wait.Variable
+	state.Approvers = wait.Approvers
+	state.TokenHash = wait.TokenHash
+	if !wait.Until.IsZero() {
+		until := wait.Until.UTC()
+		state.WaitUntil = &until
+	}
+	run.state = state
+	return errSuspended
+}
+
+// Rebuild the main branch of a run from the state it was suspended with
+func (state *RunState) branch() *branch {
+	b := newBranch("", copyVars(state.Variables))
+	for _, id := range state.Path {
+		b.visited[id] = true
+	}
+	b.path = append(b.path, state.Path...)
+	for k, v := range state.Visits {
+		b.visits[k] = v
+	}
+	for k, v := range state.Iterations {
+		b.iterations[k] = v
+	}
+	return b
+}
+
+// Resume continues a run from the state it stopped with. A run that stopped at a waiting
+// node records the node's step again, completed with the output it was resumed with. A run
+// resumed from a checkpoint was interrupted, and the nodes after the checkpoint only run
+// again if they are safe to. Either way the run follows the edges leaving the node through
+// the state's handle, and only the steps run since resuming are returned.
+func (e *Executor) Resume(ctx context.Context, wf *Workflow, state *RunState, onStep func(ExecutionStep)) *ExecutionResponse {
+	start := findNodeByType(wf.Definition.Nodes, "start")
+	if start == nil {
+		return failedResponse("No start node found in workflow")
+	}
+
+	main := state.branch()
+	return e.execute(ctx, wf, start, main, onStep, func(ctx context.Context, run *execution) error {
+		run.executed.Store(state.Executed)
+
+		node := run.nodeMap[state.NodeID]
+		if node == nil {
+			err := fmt.Errorf("Cannot resume at node %s, it is not in the workflow", state.NodeID)
+			run.record(main, systemErrorStep(err.Error()))
+			return err
+		}
+
+		step := ExecutionStep{SourceHandle: state.Handle}
+		if state.Waiting {
+			step = ExecutionStep{
+				NodeID:       node.ID,
+				Type:         node.Type,
+				Label:        node.Data.Label,
+				Description:  node.Data.Description,
+				Status:       "completed",
+				Output:       state.Output,
+				StartedAt:    time.Now(),
+				SourceHandle: state.Handle,
+				Iteration:    main.visits[node.ID] - 1,
+			}
+			if state.Variable != "" {
+				main.vars[state.Variable] = state.Output
+			}
+			run.checkpoint(main, node, &step)
+			run.record(main, step)
+		} else {
+			run.recovering.Store(true)
+		}
+
+		next, err := e.next(ctx, run, main, node, &step)
+		if err != nil || next == nil {
+			return err
+		}
+		_, err = e.walk(ctx, run, main, next)
+		return err
+	})
+}
+
+type executionIDKey struct{}
+
+// Attach the ID of the run to the context its handlers run with, so waiting nodes can tell
+// people how to resume it
+func withExecutionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, executionIDKey{}, id)
+}
+
+// The ID of the run the handler is running in, empty if the run is not recorded
+func executionIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(executionIDKey{}).(string)
+	return id
+}
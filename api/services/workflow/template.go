@@ -0,0 +1,283 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Placeholders are written {{ expression | filter | filter(args) }}
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// A template filter transforms the value of a placeholder
+type templateFilter func(value interface{}, args []interface{}) (interface{}, error)
+
+var templateFilters = map[string]templateFilter{
+	"default": defaultFilter,
+	"upper":   stringFilter(strings.ToUpper),
+	"lower":   stringFilter(strings.ToLower),
+	"trim":    stringFilter(strings.TrimSpace),
+	"number":  numberFilter,
+	"date":    dateFilter,
+	"json":    jsonFilter,
+}
+
+// Named layouts accepted by the date filter, any other layout is used as a Go time layout
+var dateLayouts = map[string]string{
+	"date":     "2006-01-02",
+	"time":     "15:04",
+	"datetime": "2006-01-02 15:04",
+	"rfc3339":  time.RFC3339,
+}
+
+// RenderTemplate replaces the {{placeholders}} in a string with the values of the workflow
+// variables. A placeholder holds an expression, such as {{city}} or {{weather.wind.speed}},
+// optionally followed by filters:
+//
+//   - default(value): used when the variable is missing, null or empty
+//   - upper, lower, trim: change the text
+//   - number(decimals): formats a number with a fixed number of decimals
+//   - date(layout): formats a time, RFC3339 string or unix timestamp, e.g. date("date")
+//   - json: encodes the value as JSON
+//
+// e.g. "Temperature in {{city | upper}} is {{temperature | number(1)}}°C"
+func RenderTemplate(template string, wfVars map[string]interface{}) (string, error) {
+	var renderErr error
+	rendered := placeholderPattern.ReplaceAllStringFunc(template, func(match string) string {
+		value, err := renderPlaceholder(placeholderPattern.FindStringSubmatch(match)[1], wfVars)
+		if err != nil {
+			if renderErr == nil {
+				renderErr = fmt.Errorf("cannot render %s: %w", match, err)
+			}
+			return match
+		}
+		return stringify(value)
+	})
+	return rendered, renderErr
+}
+
+// Render the strings within a JSON-like value. A string made up of a single placeholder
+// is replaced by the value itself, so numbers and objects keep their type
+func renderTemplateValue(raw interface{}, wfVars map[string]interface{}) (interface{}, error) {
+	switch v := raw.(type) {
+	case string:
+		if match := placeholderPattern.FindStringSubmatchIndex(v); match != nil && match[0] == 0 && match[1] == len(v) {
+			value, err := renderPlaceholder(v[match[2]:match[3]], wfVars)
+			if err != nil {
+				return nil, fmt.Errorf("cannot render %s: %w", v, err)
+			}
+			return value, nil
+		}
+		return RenderTemplate(v, wfVars)
+
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			value, err := renderTemplateValue(item, wfVars)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = value
+		}
+		return rendered, nil
+
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := renderTemplateValue(item, wfVars)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = value
+		}
+		return rendered, nil
+	}
+
+	return raw, nil
+}
+
+// Evaluate the expression of a placeholder and apply its filters
+func renderPlaceholder(source string, wfVars map[string]interface{}) (interface{}, error) {
+	parts := splitFilters(source)
+
+	expr, err := ParseExpression(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	type call struct {
+		name   string
+		filter templateFilter
+		args   []interface{}
+	}
+	calls := make([]call, 0, len(parts)-1)
+	hasDefault := false
+	for _, part := range parts[1:] {
+		name, args, err := parseFilter(part, wfVars)
+		if err != nil {
+			return nil, err
+		}
+		filter, ok := templateFilters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter: %s", name)
+		}
+		if name == "default" {
+			hasDefault = true
+		}
+		calls = append(calls, call{name: name, filter: filter, args: args})
+	}
+
+	value, err := expr.Evaluate(wfVars)
+	if err != nil {
+		// Missing variables are only an error when there is no default
+		if !hasDefault {
+			return nil, err
+		}
+		value = nil
+	}
+
+	for _, c := range calls {
+		value, err = c.filter(value, c.args)
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %w", c.name, err)
+		}
+	}
+
+	return value, nil
+}
+
+// Split a placeholder on the pipes separating its filters, ignoring pipes
+// in string literals and the || operator
+func splitFilters(source string) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	runes := []rune(source)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == '\\' {
+				i++
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '|':
+			if i+1 < len(runes) && runes[i+1] == '|' {
+				i++
+				continue
+			}
+			parts = append(parts, strings.TrimSpace(string(runes[start:i])))
+			start = i + 1
+		}
+	}
+
+	return append(parts, strings.TrimSpace(string(runes[start:])))
+}
+
+// Parse a filter call such as upper or number(1). The arguments are expressions,
+// so they may be literals or variables
+func parseFilter(source string, wfVars map[string]interface{}) (string, []interface{}, error) {
+	open := strings.Index(source, "(")
+	if open < 0 {
+		return source, nil, nil
+	}
+	if !strings.HasSuffix(source, ")") {
+		return "", nil, fmt.Errorf("invalid filter %q", source)
+	}
+
+	name := strings.TrimSpace(source[:open])
+	value, err := EvaluateExpression("["+source[open+1:len(source)-1]+"]", wfVars)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid arguments for filter %s: %w", name, err)
+	}
+	args, _ := toList(value)
+	return name, args, nil
+}
+
+func defaultFilter(value interface{}, args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	if value == nil || value == "" {
+		return args[0], nil
+	}
+	return value, nil
+}
+
+func stringFilter(fn func(string) string) templateFilter {
+	return func(value interface{}, args []interface{}) (interface{}, error) {
+		return fn(stringify(value)), nil
+	}
+}
+
+func numberFilter(value interface{}, args []interface{}) (interface{}, error) {
+	f, ok := toFloat(value)
+	if !ok {
+		s, isString := value.(string)
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if !isString || err != nil {
+			return nil, fmt.Errorf("%v is not a number", value)
+		}
+		f = parsed
+	}
+
+	decimals := 0
+	if len(args) > 0 {
+		d, ok := toFloat(args[0])
+		if !ok || d < 0 {
+			return nil, fmt.Errorf("invalid number of decimals: %v", args[0])
+		}
+		decimals = int(d)
+	}
+
+	return strconv.FormatFloat(f, 'f', decimals, 64), nil
+}
+
+func dateFilter(value interface{}, args []interface{}) (interface{}, error) {
+	layout := time.RFC3339
+	if len(args) > 0 {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid layout: %v", args[0])
+		}
+		layout = s
+		if named, ok := dateLayouts[s]; ok {
+			layout = named
+		}
+	}
+
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case string:
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an RFC3339 time", v)
+		}
+		t = parsed
+	default:
+		seconds, ok := toFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a time", value)
+		}
+		t = time.Unix(int64(seconds), 0).UTC()
+	}
+
+	return t.Format(layout), nil
+}
+
+func jsonFilter(value interface{}, args []interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
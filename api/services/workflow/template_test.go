@@ -0,0 +1,97 @@
+package workflow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	wfVars := map[string]interface{}{
+		"city":        "Sydney",
+		"temperature": 30.456,
+		"empty":       "",
+		"weather":     map[string]interface{}{"wind": map[string]interface{}{"speed": 12.0}},
+		"tags":        []interface{}{"hot", "dry"},
+		"observedAt":  "2024-01-02T15:04:05Z",
+		"timestamp":   1704207845.0,
+		"sentAt":      time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name          string
+		template      string
+		expected      string
+		expectedError string
+	}{
+		{name: "plain text", template: "No placeholders", expected: "No placeholders"},
+		{name: "variables", template: "Weather alert for {{city}}! Temperature is {{ temperature }}°C!", expected: "Weather alert for Sydney! Temperature is 30.456°C!"},
+		{name: "nested fields", template: "Wind {{weather.wind.speed}} km/h, {{tags[1]}}", expected: "Wind 12 km/h, dry"},
+		{name: "expressions", template: "{{temperature > 30 && city == 'Sydney'}}", expected: "true"},
+		{name: "pipes inside expressions", template: "{{false || city == \"a|b\"}}", expected: "false"},
+		{name: "number", template: "{{temperature | number(1)}}", expected: "30.5"},
+		{name: "number without decimals", template: "{{temperature | number}}", expected: "30"},
+		{name: "upper and lower", template: "{{city | upper}} {{city | lower}}", expected: "SYDNEY sydney"},
+		{name: "default for missing variable", template: "{{country | default('Australia') | upper}}", expected: "AUSTRALIA"},
+		{name: "default for empty variable", template: "{{empty | default(city)}}", expected: "Sydney"},
+		{name: "default not used", template: "{{city | default('Perth')}}", expected: "Sydney"},
+		{name: "date with named layout", template: "{{observedAt | date('date')}}", expected: "2024-01-02"},
+		{name: "date with go layout", template: "{{timestamp | date('02 Jan 2006 15:04')}}", expected: "02 Jan 2024 15:04"},
+		{name: "date from time", template: "{{sentAt | date}}", expected: "2024-01-02T15:04:05Z"},
+		{name: "json", template: "{{tags | json}}", expected: `["hot","dry"]`},
+		{name: "missing variable", template: "Hello {{name}}", expectedError: "cannot render {{name}}: undefined variable: name"},
+		{name: "unknown filter", template: "{{city | reverse}}", expectedError: "unknown filter: reverse"},
+		{name: "invalid number", template: "{{city | number(1)}}", expectedError: "Sydney is not a number"},
+		{name: "invalid date", template: "{{city | date}}", expectedError: "is not an RFC3339 time"},
+		{name: "invalid expression", template: "{{city ==}}", expectedError: "unexpected end of expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := RenderTemplate(tt.template, wfVars)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rendered != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, rendered)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateValue(t *testing.T) {
+	wfVars := map[string]interface{}{
+		"city":    "Sydney",
+		"weather": map[string]interface{}{"temperature": 30.5},
+	}
+
+	value, err := renderTemplateValue(map[string]interface{}{
+		"temperature": "{{ weather.temperature }}",
+		"message":     "It is {{weather.temperature}} in {{city}}",
+		"tags":        []interface{}{"{{city | lower}}", true},
+	}, wfVars)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"temperature": 30.5,
+		"message":     "It is 30.5 in Sydney",
+		"tags":        []interface{}{"sydney", true},
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Expected %v, got %v", expected, value)
+	}
+
+	if _, err := renderTemplateValue([]interface{}{"{{missing}}"}, wfVars); err == nil {
+		t.Error("Expected missing variable error")
+	}
+}
@@ -0,0 +1,85 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Nodes that call external services time out after this long, unless they set a timeout
+const defaultHTTPTimeout = 10 * time.Second
+
+// The node types that call external services with the executor's HTTP client. They always
+// have a timeout, as the client has none of its own
+var externalNodeTypes = map[string]bool{
+	"integration": true,
+	"http":        true,
+}
+
+// errTimedOut is wrapped by the errors of nodes that ran out of time
+var errTimedOut = errors.New("timed out")
+
+// Read the timeout of a node from its "timeout" metadata, zero if it has none. Nodes
+// calling external services default to defaultHTTPTimeout, and cannot turn it off with a
+// timeout of zero.
+func nodeTimeout(node *Node) (time.Duration, error) {
+	raw, ok := node.Data.Metadata["timeout"]
+	if !ok || raw == nil {
+		if externalNodeTypes[node.Type] {
+			return defaultHTTPTimeout, nil
+		}
+		return 0, nil
+	}
+
+	timeout, err := parseDurationValue(raw)
+	if err != nil {
+		return 0, fmt.Errorf("timeout %w", err)
+	}
+	if timeout == 0 && externalNodeTypes[node.Type] {
+		return defaultHTTPTimeout, nil
+	}
+	return timeout, nil
+}
+
+// Read the longest a run of the workflow may take from the "maxRunDuration" metadata of
+// its start node, zero if the run is not limited
+func runTimeout(start *Node) (time.Duration, error) {
+	raw, ok := start.Data.Metadata["maxRunDuration"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+
+	timeout, err := parseDurationValue(raw)
+	if err != nil {
+		return 0, fmt.Errorf("maxRunDuration %w", err)
+	}
+	return timeout, nil
+}
+
+// Run a single attempt of the node's handler, with a deadline if the node has a timeout.
+// A handler that fails once its deadline has passed is reported as timed out.
+func runWithTimeout(ctx context.Context, timeout time.Duration, handle func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return handle(ctx)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := handle(attemptCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("node %w after %s: %v", errTimedOut, timeout, err)
+	}
+	return err
+}
+
+// Whether the step stopped the path it ran in
+func stepFailed(step *ExecutionStep) bool {
+	return step.Status == "failed" || step.Status == "timed_out"
+}
+
+// Whether the run has passed its deadline
+func (run *execution) timedOut() bool {
+	return !run.deadline.IsZero() && !time.Now().Before(run.deadline)
+}
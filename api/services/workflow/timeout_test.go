@@ -0,0 +1,174 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A handler that takes the given time, unless its context is done first
+func waitHandler(delay time.Duration) NodeHandler {
+	return NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		select {
+		case <-time.After(delay):
+			wfVars[node.ID] = "done"
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// A workflow running the nodes one after another
+func sequenceWorkflow(nodes ...Node) *Workflow {
+	wf := &Workflow{ID: "sequence", Definition: WorkflowGraph{Nodes: nodes}}
+	for i := 1; i < len(nodes); i++ {
+		wf.Definition.Edges = append(wf.Definition.Edges, Edge{ID: fmt.Sprintf("e%d", i), Source: nodes[i-1].ID, Target: nodes[i].ID})
+	}
+	return wf
+}
+
+func TestExecutor_NodeTimeout(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("wait", waitHandler(time.Second))
+
+	wf := sequenceWorkflow(
+		Node{ID: "start", Type: "start"},
+		Node{ID: "slow", Type: "wait", Data: NodeData{Metadata: map[string]interface{}{"timeout": "20ms"}}},
+		Node{ID: "end", Type: "end"},
+	)
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "failed" || len(result.Steps) != 2 {
+		t.Fatalf("Expected the run to fail at the slow node, got %s: %+v", result.Status, result.Steps)
+	}
+	step := result.Steps[1]
+	if step.Status != "timed_out" || !strings.Contains(step.Error, "node timed out after 20ms") {
+		t.Errorf("Expected the step to time out, got %s: %s", step.Status, step.Error)
+	}
+}
+
+func TestExecutor_IntegrationTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	wf := retryingWeatherWorkflow(server.URL, map[string]interface{}{"maxAttempts": 2, "initialDelay": 1})
+	wf.Definition.Nodes[1].Data.Metadata["timeout"] = 30
+
+	started := time.Now()
+	result := NewExecutor().Execute(context.Background(), wf, map[string]interface{}{"city": "Sydney"})
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the request to be cut short, took %s", elapsed)
+	}
+
+	step := result.Steps[1]
+	if result.Status != "failed" || step.Status != "timed_out" {
+		t.Fatalf("Expected the weather step to time out, got %s: %+v", result.Status, step)
+	}
+	// Timeouts are retried like any other error
+	attempts, _ := step.Output["attempts"].([]interface{})
+	if len(attempts) != 2 || attempts[0].(map[string]interface{})["status"] != "timed_out" {
+		t.Errorf("Expected two timed out attempts, got %v", step.Output)
+	}
+}
+
+func TestNodeTimeout_ExternalNodes(t *testing.T) {
+	tests := []struct {
+		nodeType string
+		timeout  interface{}
+		expected time.Duration
+	}{
+		{nodeType: "http", expected: defaultHTTPTimeout},
+		{nodeType: "integration", expected: defaultHTTPTimeout},
+		// External calls cannot turn their timeout off
+		{nodeType: "http", timeout: 0, expected: defaultHTTPTimeout},
+		{nodeType: "http", timeout: "0s", expected: defaultHTTPTimeout},
+		{nodeType: "http", timeout: "30s", expected: 30 * time.Second},
+		{nodeType: "form", expected: 0},
+		{nodeType: "form", timeout: 0, expected: 0},
+	}
+
+	for _, tt := range tests {
+		node := &Node{ID: "node", Type: tt.nodeType, Data: NodeData{Metadata: map[string]interface{}{}}}
+		if tt.timeout != nil {
+			node.Data.Metadata["timeout"] = tt.timeout
+		}
+		timeout, err := nodeTimeout(node)
+		if err != nil || timeout != tt.expected {
+			t.Errorf("Expected a %s node with timeout %v to time out after %s, got %s: %v", tt.nodeType, tt.timeout, tt.expected, timeout, err)
+		}
+	}
+}
+
+func TestExecutor_RunTimeout(t *testing.T) {
+	executor := NewExecutor()
+	executor.RegisterNodeType("wait", waitHandler(40*time.Millisecond))
+
+	// The deadline passes while the second node is waiting
+	start := Node{ID: "start", Type: "start", Data: NodeData{Metadata: map[string]interface{}{"maxRunDuration": "60ms"}}}
+	wf := sequenceWorkflow(start, Node{ID: "first", Type: "wait"}, Node{ID: "second", Type: "wait"}, Node{ID: "end", Type: "end"})
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "timed_out" || len(result.Steps) != 3 {
+		t.Fatalf("Expected the run to time out at the second node, got %s: %+v", result.Status, result.Steps)
+	}
+	if last := result.Steps[2]; last.NodeID != "second" || last.Status != "timed_out" {
+		t.Errorf("Expected the second step to time out, got %+v", last)
+	}
+	if result.Variables["first"] != "done" {
+		t.Errorf("Expected the first node to finish in time, got %v", result.Variables)
+	}
+
+	// Runs that finish in time are not affected
+	start.Data.Metadata["maxRunDuration"] = "1s"
+	result = executor.Execute(context.Background(), sequenceWorkflow(start, Node{ID: "first", Type: "wait"}), map[string]interface{}{})
+	if result.Status != "completed" {
+		t.Errorf("Expected the run to complete, got %s: %+v", result.Status, result.Steps)
+	}
+}
+
+func TestExecutor_RunDeadlineBetweenNodes(t *testing.T) {
+	// A handler that ignores its context, so the run only notices the deadline afterwards
+	executor := NewExecutor()
+	executor.RegisterNodeType("sleep", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	}))
+
+	start := Node{ID: "start", Type: "start", Data: NodeData{Metadata: map[string]interface{}{"maxRunDuration": 10}}}
+	wf := sequenceWorkflow(start, Node{ID: "sleep", Type: "sleep"}, Node{ID: "end", Type: "end"})
+
+	result := executor.Execute(context.Background(), wf, map[string]interface{}{})
+	if result.Status != "timed_out" || len(result.Steps) != 3 {
+		t.Fatalf("Expected the run to time out before the end node, got %s: %+v", result.Status, result.Steps)
+	}
+	last := result.Steps[2]
+	if last.NodeID != "system" || last.Status != "timed_out" || last.Error != "Run timed out after 10ms" {
+		t.Errorf("Expected a timed out system step, got %+v", last)
+	}
+}
+
+func TestValidate_Timeouts(t *testing.T) {
+	wf := testWorkflow()
+	wf.Definition.Nodes[0].Data.Metadata = map[string]interface{}{"maxRunDuration": "forever"}
+	wf.Definition.Nodes[1].Data.Metadata = map[string]interface{}{"timeout": "-1s"}
+
+	result := Validate(wf.Definition)
+	if result.Valid || len(result.Diagnostics) != 2 {
+		t.Fatalf("Expected two diagnostics, got %+v", result.Diagnostics)
+	}
+	for _, d := range result.Diagnostics {
+		if d.Code != "invalid_metadata" {
+			t.Errorf("Expected invalid metadata, got %+v", d)
+		}
+	}
+}
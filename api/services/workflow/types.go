@@ -6,10 +6,56 @@ type Workflow struct {
 	ID         string        `json:"id"`
 	Name       string        `json:"name"`
 	Definition WorkflowGraph `json:"definition"`
+	Version    int           `json:"version"`
 	CreatedAt  time.Time     `json:"created_at"`
 	UpdatedAt  time.Time     `json:"updated_at"`
 }
 
+// WorkflowVersion is an immutable revision of a workflow, created every time it is saved
+type WorkflowVersion struct {
+	WorkflowID string        `json:"workflow_id"`
+	Version    int           `json:"version"`
+	Name       string        `json:"name"`
+	Definition WorkflowGraph `json:"definition"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// WorkflowDiff describes the changes between two revisions of a workflow
+type WorkflowDiff struct {
+	From         int      `json:"from"`
+	To           int      `json:"to"`
+	NameChanged  bool     `json:"nameChanged"`
+	AddedNodes   []string `json:"addedNodes"`
+	RemovedNodes []string `json:"removedNodes"`
+	ChangedNodes []string `json:"changedNodes"`
+	AddedEdges   []string `json:"addedEdges"`
+	RemovedEdges []string `json:"removedEdges"`
+	ChangedEdges []string `json:"changedEdges"`
+}
+
+// WorkflowSummary is the representation of a workflow used in listings
+type WorkflowSummary struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListWorkflowsOptions controls the paging, filtering and ordering of workflow listings
+type ListWorkflowsOptions struct {
+	Limit     int
+	Offset    int
+	Search    string
+	Sort      string
+	Ascending bool
+}
+
+// WorkflowRequest is the body used to create or update a workflow
+type WorkflowRequest struct {
+	Name       string        `json:"name"`
+	Definition WorkflowGraph `json:"definition"`
+}
+
 type WorkflowGraph struct {
 	ID    string `json:"id"`
 	Nodes []Node `json:"nodes"`
@@ -44,6 +90,16 @@ type Edge struct {
 	Label        string                 `json:"label"`
 	LabelStyle   map[string]interface{} `json:"labelStyle,omitempty"`
 	SourceHandle string                 `json:"sourceHandle,omitempty"`
+	// Loop marks the edge as a loop back-edge, which may lead back to a node that has
+	// already run
+	Loop *EdgeLoop `json:"loop,omitempty"`
+}
+
+// EdgeLoop configures a loop back-edge
+type EdgeLoop struct {
+	// MaxIterations is how many times the edge may be followed in a run, the run
+	// fails if the loop goes round again
+	MaxIterations int `json:"maxIterations,omitempty"`
 }
 
 type ExecutionRequest struct {
@@ -53,9 +109,14 @@ type ExecutionRequest struct {
 }
 
 type ExecutionResponse struct {
+	ID         string          `json:"id,omitempty"`
 	ExecutedAt string          `json:"executedAt"`
 	Status     string          `json:"status"`
 	Steps      []ExecutionStep `json:"steps"`
+	// Variables are the workflow variables when the run finished
+	Variables map[string]interface{} `json:"-"`
+	// State is the state to resume the run from, when it stopped at a waiting node
+	State *RunState `json:"-"`
 }
 
 type ExecutionStep struct {
@@ -66,6 +127,118 @@ type ExecutionStep struct {
 	Status      string                 `json:"status"`
 	Output      map[string]interface{} `json:"output,omitempty"`
 	Error       string                 `json:"error,omitempty"`
+	StartedAt   time.Time              `json:"startedAt"`
+	DurationMs  int64                  `json:"durationMs"`
+
+	// SourceHandle is the output handle selected by a branching node,
+	// only edges leaving through this handle are followed
+	SourceHandle string `json:"sourceHandle,omitempty"`
+	// Branch identifies the parallel branch the step ran in, empty for the main branch
+	Branch string `json:"branch,omitempty"`
+	// Iteration counts the earlier runs of the node in its branch, it is 0 unless the
+	// node is revisited by a loop
+	Iteration int `json:"iteration,omitempty"`
+
+	// suspend is set on the steps of nodes that are waiting
+	suspend *SuspendError
+	// checkpoint is the state to resume the run from after the step, set on the steps
+	// of the main branch
+	checkpoint *RunState
+}
+
+// Execution is the persisted record of a single workflow run
+type Execution struct {
+	ID              string                 `json:"id"`
+	WorkflowID      string                 `json:"workflowId"`
+	WorkflowVersion int                    `json:"workflowVersion"`
+	Definition      WorkflowGraph          `json:"definition"`
+	Inputs          map[string]interface{} `json:"inputs"`
+	Status          string                 `json:"status"`
+	StartedAt       time.Time              `json:"startedAt"`
+	FinishedAt      *time.Time             `json:"finishedAt,omitempty"`
+	Steps           []ExecutionStep        `json:"steps,omitempty"`
+	// State is the state to resume the run from, its last checkpoint while it is running
+	// or the node it is waiting at
+	State *RunState `json:"-"`
+	// ParentID is the run whose subworkflow node started the run, and Depth how deeply
+	// the run is nested within subworkflow nodes
+	ParentID string `json:"parentId,omitempty"`
+	Depth    int    `json:"depth,omitempty"`
+}
+
+// RunState is everything needed to continue a run from a node, either a node it is
+// waiting at or the node of the last step it checkpointed
+type RunState struct {
+	NodeID string `json:"nodeId"`
+	// Waiting is set when the run is waiting at the node, rather than having run it
+	Waiting   bool                   `json:"waiting,omitempty"`
+	Variables map[string]interface{} `json:"variables"`
+	// Path, Visits and Iterations are the nodes the run has visited, in order, how many
+	// times each has run, and how many times each loop back-edge has been followed
+	Path       []string       `json:"path"`
+	Visits     map[string]int `json:"visits"`
+	Iterations map[string]int `json:"iterations"`
+	// Executed is the number of steps counted against the step budget
+	Executed int64 `json:"executed"`
+	// Steps is the number of steps the execution had recorded when it stopped
+	Steps int `json:"steps"`
+
+	// WaitUntil is when the wait expires, and the run is resumed through TimeoutHandle
+	// with TimeoutOutput. Waits without one last until the run is resumed
+	WaitUntil     *time.Time             `json:"waitUntil,omitempty"`
+	TimeoutHandle string                 `json:"timeoutHandle,omitempty"`
+	TimeoutOutput map[string]interface{} `json:"timeoutOutput,omitempty"`
+	// Variable receives the output the waiting node is resumed with
+	Variable string `json:"variable,omitempty"`
+	// Approvers may decide the waiting node, with the token TokenHash is the hash of
+	Approvers []string `json:"approvers,omitempty"`
+	TokenHash string   `json:"tokenHash,omitempty"`
+
+	// Handle is the handle the run continues through from the node. Output is what a
+	// waiting node is resumed with, both are set once it is resumed
+	Handle string                 `json:"handle,omitempty"`
+	Output map[string]interface{} `json:"output,omitempty"`
+}
+
+// Schedule runs a workflow periodically, on a cron expression evaluated in a timezone
+type Schedule struct {
+	ID             string                 `json:"id"`
+	WorkflowID     string                 `json:"workflowId"`
+	CronExpression string                 `json:"cron"`
+	Timezone       string                 `json:"timezone"`
+	FormData       map[string]interface{} `json:"formData"`
+	Condition      map[string]interface{} `json:"condition"`
+	// MissedFirePolicy decides what happens to fire times missed while no scheduler was running
+	MissedFirePolicy string     `json:"missedFirePolicy"`
+	Paused           bool       `json:"paused"`
+	NextRunAt        time.Time  `json:"nextRunAt"`
+	LastRunAt        *time.Time `json:"lastRunAt,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
+
+// ScheduleRequest is the body of a request to create a schedule
+type ScheduleRequest struct {
+	CronExpression   string                 `json:"cron"`
+	Timezone         string                 `json:"timezone"`
+	FormData         map[string]interface{} `json:"formData"`
+	Condition        map[string]interface{} `json:"condition"`
+	MissedFirePolicy string                 `json:"missedFirePolicy"`
+}
+
+// Webhook is the inbound URL of a workflow started by a webhook trigger
+type Webhook struct {
+	WorkflowID string `json:"workflowId"`
+	Token      string `json:"token"`
+	URL        string `json:"url"`
+	// Secret signs the requests to the webhook, it is only returned when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookRequest is the body of a request to create a webhook. A secret is generated if none is given
+type WebhookRequest struct {
+	Secret string `json:"secret"`
 }
 
 type WeatherResponse struct {
@@ -0,0 +1,545 @@
+package workflow
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Diagnostic severities, only errors make a graph invalid
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a single problem found when validating a workflow graph
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	NodeID   string `json:"nodeId,omitempty"`
+	EdgeID   string `json:"edgeId,omitempty"`
+}
+
+// ValidationResult is the outcome of validating a workflow graph
+type ValidationResult struct {
+	Valid       bool         `json:"valid"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Metadata keys the built-in node types cannot run without
+var requiredMetadata = map[string][]string{
+	"form":        {"inputFields"},
+	"integration": {"options"},
+	"http":        {"url"},
+	"foreach":     {"items"},
+	"switch":      {"cases"},
+}
+
+// Validate checks a workflow graph against the built-in node types
+func Validate(graph WorkflowGraph) *ValidationResult {
+	return NewExecutor().Validate(graph)
+}
+
+// Validate checks a workflow graph before it is saved or executed. Node types are
+// checked against the handlers registered on the executor.
+func (e *Executor) Validate(graph WorkflowGraph) *ValidationResult {
+	v := &validator{graph: graph, nodes: make(map[string]*Node)}
+
+	v.checkNodes(e)
+	v.checkInputSchemas()
+	v.checkEdges()
+
+	start := v.checkStart()
+	if start != nil {
+		v.checkTrigger(start)
+		reachable := v.reachableFrom(start.ID)
+		// Nodes on the failure path run when the workflow fails
+		if failure := v.checkFailure(); failure != nil {
+			for id := range v.reachableFrom(failure.ID) {
+				reachable[id] = true
+			}
+		}
+		v.checkReachability(reachable)
+		v.checkVariables(start.ID, reachable)
+	}
+
+	return v.result()
+}
+
+type validator struct {
+	graph       WorkflowGraph
+	nodes       map[string]*Node
+	diagnostics []Diagnostic
+}
+
+func (v *validator) errorf(code, nodeID, edgeID, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		NodeID:   nodeID,
+		EdgeID:   edgeID,
+	})
+}
+
+func (v *validator) warnf(code, nodeID, edgeID, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Severity: SeverityWarning,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		NodeID:   nodeID,
+		EdgeID:   edgeID,
+	})
+}
+
+func (v *validator) result() *ValidationResult {
+	result := &ValidationResult{Valid: true, Diagnostics: v.diagnostics}
+	if result.Diagnostics == nil {
+		result.Diagnostics = []Diagnostic{}
+	}
+	for _, d := range result.Diagnostics {
+		if d.Severity == SeverityError {
+			result.Valid = false
+		}
+	}
+	return result
+}
+
+// Check node IDs are unique, node types are known, and required metadata is present
+func (v *validator) checkNodes(e *Executor) {
+	for i := range v.graph.Nodes {
+		node := &v.graph.Nodes[i]
+
+		if node.ID == "" {
+			v.errorf("missing_node_id", "", "", "Node at index %d has no id", i)
+			continue
+		}
+		if _, exists := v.nodes[node.ID]; exists {
+			v.errorf("duplicate_node_id", node.ID, "", "Node id %s is used more than once", node.ID)
+			continue
+		}
+		v.nodes[node.ID] = node
+
+		if _, ok := e.nodeHandler(node.Type); !ok {
+			v.errorf("unknown_node_type", node.ID, "", "Node %s has unknown type %q", node.ID, node.Type)
+		}
+
+		for _, key := range requiredMetadata[node.Type] {
+			if _, ok := node.Data.Metadata[key]; !ok {
+				v.errorf("missing_metadata", node.ID, "", "Node %s is missing required metadata %q", node.ID, key)
+			}
+		}
+
+		if node.Type == "foreach" {
+			if _, err := parseForeachConfig(node); err != nil {
+				v.errorf("invalid_metadata", node.ID, "", "Node %s has invalid metadata: %v", node.ID, err)
+			}
+		}
+		if node.Type == "approval" {
+			config, err := parseApprovalConfig(node)
+			if err != nil {
+				v.errorf("invalid_metadata", node.ID, "", "Node %s has invalid metadata: %v", node.ID, err)
+			} else if config.allowAnyone {
+				v.warnf("open_approval", node.ID, "", "Approval %s can be decided by anyone, without a token", node.ID)
+			}
+		}
+		if node.Type == "delay" {
+			if _, err := parseDelayConfig(node); err != nil {
+				v.errorf("invalid_metadata", node.ID, "", "Node %s has invalid metadata: %v", node.ID, err)
+			}
+		}
+		if node.Type == "form" {
+			if _, err := parseInputSchema(node); err != nil {
+				v.errorf("invalid_metadata", node.ID, "", "Node %s has invalid metadata: %v", node.ID, err)
+			}
+		}
+		if node.Type == "subworkflow" {
+			if _, err := parseSubworkflowConfig(node); err != nil {
+				v.errorf("invalid_metadata", node.ID, "", "Node %s has invalid metadata: %v", node.ID, err)
+			}
+		}
+		if _, err := parseRetryPolicy(node); err != nil {
+			v.errorf("invalid_metadata", node.ID, "", "Node %s has invalid metadata: %v", node.ID, err)
+		}
+		if _, err := nodeTimeout(node); err != nil {
+			v.errorf("invalid_metadata", node.ID, "", "Node %s has invalid metadata: %v", node.ID, err)
+		}
+		if node.Type == "start" {
+			if _, err := runTimeout(node); err != nil {
+				v.errorf("invalid_metadata", node.ID, "", "Node %s has invalid metadata: %v", node.ID, err)
+			}
+		}
+	}
+}
+
+// Check form nodes declaring the same input agree on its type, as they set the same variable
+func (v *validator) checkInputSchemas() {
+	type declaration struct {
+		nodeID    string
+		fieldType string
+	}
+	declared := make(map[string]declaration)
+
+	for i := range v.graph.Nodes {
+		node := &v.graph.Nodes[i]
+		if node.Type != "form" {
+			continue
+		}
+		// Invalid schemas are reported with the node
+		schema, err := parseInputSchema(node)
+		if err != nil || schema == nil {
+			continue
+		}
+
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fieldType := schema.Properties[name].Type
+			previous, ok := declared[name]
+			if !ok {
+				declared[name] = declaration{nodeID: node.ID, fieldType: fieldType}
+				continue
+			}
+			if previous.fieldType != fieldType {
+				v.errorf("conflicting_input_schema", node.ID, "", "Node %s declares input %s as %s, but node %s declares it as %s",
+					node.ID, name, fieldType, previous.nodeID, previous.fieldType)
+			}
+		}
+	}
+}
+
+// Check edges connect existing nodes, and branching nodes have an edge for each handle
+func (v *validator) checkEdges() {
+	handles := make(map[string]map[string]bool)
+
+	for _, edge := range v.graph.Edges {
+		if _, ok := v.nodes[edge.Source]; !ok {
+			v.errorf("dangling_edge", "", edge.ID, "Edge %s starts at unknown node %q", edge.ID, edge.Source)
+		}
+		if _, ok := v.nodes[edge.Target]; !ok {
+			v.errorf("dangling_edge", "", edge.ID, "Edge %s ends at unknown node %q", edge.ID, edge.Target)
+		}
+
+		if edge.Loop != nil && edge.Loop.MaxIterations < 0 {
+			v.errorf("invalid_loop", "", edge.ID, "Loop edge %s must have a positive maxIterations", edge.ID)
+		}
+
+		if handles[edge.Source] == nil {
+			handles[edge.Source] = make(map[string]bool)
+		}
+		handles[edge.Source][edge.SourceHandle] = true
+	}
+
+	for _, node := range v.graph.Nodes {
+		for _, handle := range expectedHandles(&node) {
+			if !handles[node.ID][handle] {
+				v.errorf("missing_handle_edge", node.ID, "", "Node %s has no edge for its %q output", node.ID, handle)
+			}
+		}
+	}
+}
+
+// The output handles a branching node needs an edge for
+func expectedHandles(node *Node) []string {
+	switch node.Type {
+	case "condition":
+		return []string{"true", "false"}
+
+	case "foreach":
+		return []string{ForeachItemHandle}
+
+	case "approval":
+		handles := []string{ApprovalApprovedHandle, ApprovalRejectedHandle}
+		if config, err := parseApprovalConfig(node); err == nil && config.expiresAfter > 0 {
+			handles = append(handles, ApprovalTimeoutHandle)
+		}
+		return handles
+
+	case "switch":
+		var handles []string
+		cases, _ := node.Data.Metadata["cases"].([]interface{})
+		for _, c := range cases {
+			if switchCase, ok := c.(map[string]interface{}); ok {
+				if handle, ok := switchCase["handle"].(string); ok && handle != "" {
+					handles = append(handles, handle)
+				}
+			}
+		}
+		if handle, ok := node.Data.Metadata["defaultHandle"].(string); ok && handle != "" {
+			handles = append(handles, handle)
+		}
+		return handles
+	}
+
+	return nil
+}
+
+// Check there is exactly one start node, and return it
+func (v *validator) checkStart() *Node {
+	var starts []*Node
+	for i := range v.graph.Nodes {
+		if v.graph.Nodes[i].Type == "start" {
+			starts = append(starts, &v.graph.Nodes[i])
+		}
+	}
+
+	switch len(starts) {
+	case 0:
+		v.errorf("missing_start", "", "", "Workflow has no start node")
+		return nil
+	case 1:
+		return starts[0]
+	}
+
+	for _, start := range starts[1:] {
+		v.errorf("multiple_start", start.ID, "", "Workflow has more than one start node")
+	}
+	return nil
+}
+
+// Check there is at most one failure node, and return it
+func (v *validator) checkFailure() *Node {
+	var failure *Node
+	for i := range v.graph.Nodes {
+		node := &v.graph.Nodes[i]
+		if node.Type != "failure" {
+			continue
+		}
+		if failure != nil {
+			v.errorf("multiple_failure", node.ID, "", "Workflow has more than one failure node")
+			continue
+		}
+		failure = node
+	}
+	return failure
+}
+
+// Check the trigger configured on the start node
+func (v *validator) checkTrigger(start *Node) {
+	if _, err := parseTrigger(start); err != nil {
+		v.errorf("invalid_trigger", start.ID, "", "Start node %s has an invalid trigger: %v", start.ID, err)
+	}
+}
+
+// Find the nodes reachable from the given node
+func (v *validator) reachableFrom(id string) map[string]bool {
+	reachable := map[string]bool{id: true}
+	queue := []string{id}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, edge := range v.graph.Edges {
+			if edge.Source == current && !reachable[edge.Target] {
+				if _, ok := v.nodes[edge.Target]; ok {
+					reachable[edge.Target] = true
+					queue = append(queue, edge.Target)
+				}
+			}
+		}
+	}
+
+	return reachable
+}
+
+// Check an end node is reachable, and report nodes that can never run
+func (v *validator) checkReachability(reachable map[string]bool) {
+	endReachable := false
+	for _, node := range v.graph.Nodes {
+		if !reachable[node.ID] {
+			v.warnf("unreachable_node", node.ID, "", "Node %s cannot be reached from the start node", node.ID)
+			continue
+		}
+		if node.Type == "end" {
+			endReachable = true
+		}
+	}
+
+	if !endReachable {
+		v.errorf("unreachable_end", "", "", "No end node can be reached from the start node")
+	}
+}
+
+// Check every variable a node consumes (inputVariables) is produced (outputVariables) by a
+// node that runs before it on every path from the start node
+func (v *validator) checkVariables(startID string, reachable map[string]bool) {
+	available := v.flow(startID, reachable, func(edge Edge, in map[string]bool) map[string]bool {
+		return withOutputs(v.nodes[edge.Source], in, edge.SourceHandle == ErrorHandle)
+	})
+
+	for _, node := range v.graph.Nodes {
+		in, ok := available[node.ID]
+		if !ok {
+			continue
+		}
+		var missing []string
+		for _, name := range metadataStrings(node.Data.Metadata, "inputVariables") {
+			if !in[name] {
+				missing = append(missing, name)
+			}
+		}
+		sort.Strings(missing)
+		for _, name := range missing {
+			v.warnf("variable_not_produced", node.ID, "",
+				"Node %s uses variable %q before any node produces it", node.ID, name)
+		}
+	}
+}
+
+// The nodes that run before every end node is reached, whichever path the run takes
+func (v *validator) nodesOnEveryPath(startID string, reachable map[string]bool) map[string]bool {
+	ran := v.flow(startID, reachable, func(edge Edge, in map[string]bool) map[string]bool {
+		out := map[string]bool{edge.Source: true}
+		for id := range in {
+			out[id] = true
+		}
+		return out
+	})
+
+	var always map[string]bool
+	for _, node := range v.graph.Nodes {
+		in, ok := ran[node.ID]
+		if node.Type != "end" || !ok {
+			continue
+		}
+		if always == nil {
+			always = in
+			continue
+		}
+		for id := range always {
+			if !in[id] {
+				delete(always, id)
+			}
+		}
+	}
+	return always
+}
+
+// Forward dataflow from the start node: the set reaching a node is what every path leading
+// to it carries, except at a join waiting for all branches, where every branch has run and
+// what any of them carries reaches it. out is what an edge carries, given the set reaching
+// its source. Iterate until nothing changes, so loops settle too. Nodes that cannot be
+// reached from the start node are left out.
+func (v *validator) flow(startID string, reachable map[string]bool, out func(edge Edge, in map[string]bool) map[string]bool) map[string]map[string]bool {
+	incoming := make(map[string][]Edge)
+	for _, edge := range v.graph.Edges {
+		if reachable[edge.Source] && reachable[edge.Target] {
+			incoming[edge.Target] = append(incoming[edge.Target], edge)
+		}
+	}
+
+	sets := make(map[string]map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, node := range v.graph.Nodes {
+			if !reachable[node.ID] {
+				continue
+			}
+
+			in := make(map[string]bool)
+			if node.ID != startID {
+				union := node.Type == "join" && joinMode(&node) == JoinModeAll
+				first := true
+				for _, edge := range incoming[node.ID] {
+					source, ok := sets[edge.Source]
+					if !ok {
+						continue
+					}
+					carried := out(edge, source)
+					if first || union {
+						for name := range carried {
+							in[name] = true
+						}
+						first = false
+						continue
+					}
+					for name := range in {
+						if !carried[name] {
+							delete(in, name)
+						}
+					}
+				}
+				if first {
+					continue
+				}
+			}
+
+			if previous, ok := sets[node.ID]; !ok || !sameSet(previous, in) {
+				sets[node.ID] = in
+				changed = true
+			}
+		}
+	}
+
+	return sets
+}
+
+func sameSet(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name := range a {
+		if !b[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// The variables available after a node runs, or after it fails when leaving through its
+// error edges
+func withOutputs(node *Node, in map[string]bool, failed bool) map[string]bool {
+	out := make(map[string]bool, len(in))
+	for name := range in {
+		out[name] = true
+	}
+	if failed {
+		out[errorMessageVariable] = true
+		out[errorNodeVariable] = true
+		return out
+	}
+	for _, name := range metadataStrings(node.Data.Metadata, "outputVariables") {
+		out[name] = true
+	}
+
+	// Foreach nodes bind the loop variables for their body, and the results for after it
+	if node.Type == "foreach" {
+		if config, err := parseForeachConfig(node); err == nil {
+			out[config.itemVariable] = true
+			out[config.indexVariable] = true
+			out[config.resultVariable] = true
+		}
+	}
+	if node.Type == "approval" {
+		if config, err := parseApprovalConfig(node); err == nil {
+			out[config.resultVariable] = true
+		}
+	}
+	if node.Type == "subworkflow" {
+		if config, err := parseSubworkflowConfig(node); err == nil {
+			for name := range config.outputs {
+				out[name] = true
+			}
+		}
+	}
+	return out
+}
+
+// Read a list of strings from node metadata, which may be []string or []interface{}
+func metadataStrings(metadata map[string]interface{}, key string) []string {
+	list, ok := toList(metadata[key])
+	if !ok {
+		return nil
+	}
+	var values []string
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
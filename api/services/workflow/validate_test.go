@@ -0,0 +1,222 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+)
+
+// A cut down version of the seeded weather alert workflow, as it is loaded from the
+// database. The seed itself is validated by the tests in pkg/db
+func weatherAlertGraph() WorkflowGraph {
+	return WorkflowGraph{
+		ID: "weather",
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			{ID: "form", Type: "form", Data: NodeData{Metadata: map[string]interface{}{
+				"inputFields":     []interface{}{"name", "email", "city"},
+				"outputVariables": []interface{}{"name", "email", "city"},
+			}}},
+			{ID: "weather-api", Type: "integration", Data: NodeData{Metadata: map[string]interface{}{
+				"inputVariables":  []interface{}{"city"},
+				"options":         []interface{}{},
+				"outputVariables": []interface{}{"temperature"},
+			}}},
+			{ID: "condition", Type: "condition", Data: NodeData{Metadata: map[string]interface{}{
+				"outputVariables": []interface{}{"conditionMet"},
+			}}},
+			{ID: "email", Type: "email", Data: NodeData{Metadata: map[string]interface{}{
+				"inputVariables": []interface{}{"name", "city", "temperature"},
+			}}},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []Edge{
+			{ID: "e1", Source: "start", Target: "form"},
+			{ID: "e2", Source: "form", Target: "weather-api"},
+			{ID: "e3", Source: "weather-api", Target: "condition"},
+			{ID: "e4", Source: "condition", Target: "email", SourceHandle: "true"},
+			{ID: "e5", Source: "condition", Target: "end", SourceHandle: "false"},
+			{ID: "e6", Source: "email", Target: "end"},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(g *WorkflowGraph)
+		expectValid   bool
+		expectedCodes []string
+	}{
+		{
+			name:        "seeded workflow is valid",
+			modify:      func(g *WorkflowGraph) {},
+			expectValid: true,
+		},
+		{
+			name: "missing start node",
+			modify: func(g *WorkflowGraph) {
+				g.Nodes[0].Type = "end"
+			},
+			expectValid:   false,
+			expectedCodes: []string{"missing_start"},
+		},
+		{
+			name: "multiple start nodes",
+			modify: func(g *WorkflowGraph) {
+				g.Nodes = append(g.Nodes, Node{ID: "start-2", Type: "start"})
+			},
+			expectValid:   false,
+			expectedCodes: []string{"multiple_start"},
+		},
+		{
+			name: "dangling edge",
+			modify: func(g *WorkflowGraph) {
+				g.Edges = append(g.Edges, Edge{ID: "e7", Source: "email", Target: "sms"})
+			},
+			expectValid:   false,
+			expectedCodes: []string{"dangling_edge"},
+		},
+		{
+			name: "unknown node type",
+			modify: func(g *WorkflowGraph) {
+				g.Nodes[4].Type = "fax"
+			},
+			expectValid:   false,
+			expectedCodes: []string{"unknown_node_type"},
+		},
+		{
+			name: "condition missing false edge",
+			modify: func(g *WorkflowGraph) {
+				g.Edges = g.Edges[:4]
+				g.Edges = append(g.Edges, Edge{ID: "e6", Source: "email", Target: "end"})
+			},
+			expectValid:   false,
+			expectedCodes: []string{"missing_handle_edge"},
+		},
+		{
+			name: "missing required metadata",
+			modify: func(g *WorkflowGraph) {
+				delete(g.Nodes[1].Data.Metadata, "inputFields")
+			},
+			expectValid:   false,
+			expectedCodes: []string{"missing_metadata"},
+		},
+		{
+			name: "end node not reachable",
+			modify: func(g *WorkflowGraph) {
+				g.Edges = g.Edges[:1]
+			},
+			expectValid:   false,
+			expectedCodes: []string{"missing_handle_edge", "missing_handle_edge", "unreachable_node", "unreachable_node", "unreachable_node", "unreachable_node", "unreachable_end"},
+		},
+		{
+			name: "variable consumed before it is produced",
+			modify: func(g *WorkflowGraph) {
+				// Skip the weather API, so temperature is never produced
+				g.Edges[1].Target = "condition"
+				g.Edges[2].Source = "form"
+			},
+			expectValid:   true,
+			expectedCodes: []string{"unreachable_node", "variable_not_produced"},
+		},
+		{
+			name: "variable produced by one parallel branch before a join",
+			modify: func(g *WorkflowGraph) {
+				// The weather API runs alongside a lookup, and both must finish before the condition
+				g.Nodes = append(g.Nodes,
+					Node{ID: "lookup", Type: "http", Data: NodeData{Metadata: map[string]interface{}{"url": "https://example.com", "outputVariables": []interface{}{"country"}}}},
+					Node{ID: "join", Type: "join"},
+				)
+				g.Nodes[4].Data.Metadata["inputVariables"] = []interface{}{"name", "city", "temperature", "country"}
+				g.Edges[2].Target = "join"
+				g.Edges = append(g.Edges,
+					Edge{ID: "e7", Source: "form", Target: "lookup"},
+					Edge{ID: "e8", Source: "lookup", Target: "join"},
+					Edge{ID: "e9", Source: "join", Target: "condition"},
+				)
+			},
+			expectValid: true,
+		},
+		{
+			name: "variable produced by one parallel branch before an any join",
+			modify: func(g *WorkflowGraph) {
+				// The condition can start before the weather API finishes
+				g.Nodes = append(g.Nodes,
+					Node{ID: "lookup", Type: "http", Data: NodeData{Metadata: map[string]interface{}{"url": "https://example.com", "outputVariables": []interface{}{"country"}}}},
+					Node{ID: "join", Type: "join", Data: NodeData{Metadata: map[string]interface{}{"mode": JoinModeAny}}},
+				)
+				g.Nodes[4].Data.Metadata["inputVariables"] = []interface{}{"name", "city", "temperature", "country"}
+				g.Edges[2].Target = "join"
+				g.Edges = append(g.Edges,
+					Edge{ID: "e7", Source: "form", Target: "lookup"},
+					Edge{ID: "e8", Source: "lookup", Target: "join"},
+					Edge{ID: "e9", Source: "join", Target: "condition"},
+				)
+			},
+			expectValid:   true,
+			expectedCodes: []string{"variable_not_produced", "variable_not_produced"},
+		},
+		{
+			name: "variable only produced on one branch",
+			modify: func(g *WorkflowGraph) {
+				// The email node can now be reached without running the weather API
+				g.Edges = append(g.Edges, Edge{ID: "e7", Source: "form", Target: "email"})
+			},
+			expectValid:   true,
+			expectedCodes: []string{"variable_not_produced"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph := weatherAlertGraph()
+			tt.modify(&graph)
+
+			result := Validate(graph)
+
+			if result.Valid != tt.expectValid {
+				t.Errorf("Expected valid %v, got %v: %+v", tt.expectValid, result.Valid, result.Diagnostics)
+			}
+
+			var codes []string
+			for _, d := range result.Diagnostics {
+				codes = append(codes, d.Code)
+			}
+			if len(codes) != len(tt.expectedCodes) {
+				t.Fatalf("Expected diagnostics %v, got %v", tt.expectedCodes, codes)
+			}
+			for i := range codes {
+				if codes[i] != tt.expectedCodes[i] {
+					t.Errorf("Expected diagnostics %v, got %v", tt.expectedCodes, codes)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestExecutor_ValidateRegisteredNodeTypes(t *testing.T) {
+	graph := WorkflowGraph{
+		Nodes: []Node{
+			{ID: "start", Type: "start"},
+			{ID: "slack", Type: "slack"},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []Edge{
+			{ID: "e1", Source: "start", Target: "slack"},
+			{ID: "e2", Source: "slack", Target: "end"},
+		},
+	}
+
+	executor := NewExecutor()
+	if executor.Validate(graph).Valid {
+		t.Error("Expected unregistered node type to be invalid")
+	}
+
+	executor.RegisterNodeType("slack", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		return nil
+	}))
+	if result := executor.Validate(graph); !result.Valid {
+		t.Errorf("Expected registered node type to be valid, got %+v", result.Diagnostics)
+	}
+}
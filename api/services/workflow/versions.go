@@ -0,0 +1,63 @@
+package workflow
+
+import (
+	"reflect"
+	"sort"
+)
+
+// DiffWorkflowVersions compares two revisions of a workflow. Nodes and edges are
+// matched by ID, and reported as added, removed or changed.
+func DiffWorkflowVersions(from, to *WorkflowVersion) *WorkflowDiff {
+	diff := &WorkflowDiff{
+		From:        from.Version,
+		To:          to.Version,
+		NameChanged: from.Name != to.Name,
+	}
+
+	fromNodes := make(map[string]interface{}, len(from.Definition.Nodes))
+	for _, node := range from.Definition.Nodes {
+		fromNodes[node.ID] = node
+	}
+	toNodes := make(map[string]interface{}, len(to.Definition.Nodes))
+	for _, node := range to.Definition.Nodes {
+		toNodes[node.ID] = node
+	}
+	diff.AddedNodes, diff.RemovedNodes, diff.ChangedNodes = diffByID(fromNodes, toNodes)
+
+	fromEdges := make(map[string]interface{}, len(from.Definition.Edges))
+	for _, edge := range from.Definition.Edges {
+		fromEdges[edge.ID] = edge
+	}
+	toEdges := make(map[string]interface{}, len(to.Definition.Edges))
+	for _, edge := range to.Definition.Edges {
+		toEdges[edge.ID] = edge
+	}
+	diff.AddedEdges, diff.RemovedEdges, diff.ChangedEdges = diffByID(fromEdges, toEdges)
+
+	return diff
+}
+
+// Compare two sets of items keyed by ID, returning the sorted IDs that were added,
+// removed, or are present in both but differ
+func diffByID(from, to map[string]interface{}) (added, removed, changed []string) {
+	added, removed, changed = []string{}, []string{}, []string{}
+
+	for id, item := range to {
+		previous, ok := from[id]
+		if !ok {
+			added = append(added, id)
+		} else if !reflect.DeepEqual(previous, item) {
+			changed = append(changed, id)
+		}
+	}
+	for id := range from {
+		if _, ok := to[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
@@ -0,0 +1,195 @@
+package workflow
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Trigger types a start node can be configured with
+const (
+	TriggerManual  = "manual"
+	TriggerWebhook = "webhook"
+)
+
+// Webhook request bodies larger than this are rejected
+const maxWebhookBodyBytes = 1 << 20
+
+// The header carrying the signature of a webhook request, unless the trigger names another
+const defaultSignatureHeader = "X-Signature-256"
+
+// triggerConfig configures how a workflow is started, from the "trigger" metadata of its start node
+type triggerConfig struct {
+	Type string `json:"type"`
+	// BodyMapping maps variables to selectors into the JSON request body, such as
+	// $.location.city. Without a mapping the fields of the body become the variables
+	BodyMapping map[string]string `json:"bodyMapping"`
+	// HeaderMapping maps variables to the request headers they are read from
+	HeaderMapping map[string]string `json:"headerMapping"`
+	// VerifySignature rejects requests without a valid HMAC-SHA256 signature of the body,
+	// keyed with the webhook secret, in the signature header
+	VerifySignature bool   `json:"verifySignature"`
+	SignatureHeader string `json:"signatureHeader"`
+	// Wait responds once the run has finished, rather than straight away with its ID
+	Wait     bool             `json:"wait"`
+	Response *triggerResponse `json:"response"`
+}
+
+// triggerResponse is the response to a webhook request once the run has finished. Its
+// headers and body are templates rendered with the final workflow variables.
+type triggerResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    interface{}       `json:"body"`
+}
+
+// Read the trigger of a start node, a start node without one is started manually
+func parseTrigger(start *Node) (*triggerConfig, error) {
+	raw, ok := start.Data.Metadata["trigger"]
+	if !ok || raw == nil {
+		return &triggerConfig{Type: TriggerManual}, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var t triggerConfig
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid trigger: %w", err)
+	}
+
+	if t.Type == "" {
+		t.Type = TriggerManual
+	}
+	if t.Type != TriggerManual && t.Type != TriggerWebhook {
+		return nil, fmt.Errorf("unknown trigger type %q", t.Type)
+	}
+	if t.SignatureHeader == "" {
+		t.SignatureHeader = defaultSignatureHeader
+	}
+	if t.Response != nil && t.Response.Status != 0 && (t.Response.Status < 200 || t.Response.Status > 599) {
+		return nil, fmt.Errorf("invalid trigger response status %d", t.Response.Status)
+	}
+	return &t, nil
+}
+
+// The trigger of the workflow's start node
+func workflowTrigger(graph WorkflowGraph) (*triggerConfig, error) {
+	start := findNodeByType(graph.Nodes, "start")
+	if start == nil {
+		return nil, fmt.Errorf("workflow has no start node")
+	}
+	return parseTrigger(start)
+}
+
+// Generate a random URL-safe token, used for webhook tokens and secrets
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Check the signature is the hex HMAC-SHA256 of the body, with or without a sha256= prefix
+func verifySignature(secret string, body []byte, signature string) bool {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// Map a webhook request to the initial workflow variables
+func (t *triggerConfig) inputs(body []byte, header http.Header) (map[string]interface{}, error) {
+	inputs := make(map[string]interface{})
+
+	var document interface{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &document); err != nil {
+			return nil, fmt.Errorf("request body is not valid JSON")
+		}
+	}
+
+	if len(t.BodyMapping) == 0 {
+		fields, ok := document.(map[string]interface{})
+		if document != nil && !ok {
+			return nil, fmt.Errorf("request body must be a JSON object")
+		}
+		for k, v := range fields {
+			inputs[k] = v
+		}
+	}
+	for name, selector := range t.BodyMapping {
+		value, err := selectJSON(document, selector)
+		if err != nil {
+			return nil, fmt.Errorf("cannot map %s from the request body: %w", name, err)
+		}
+		inputs[name] = value
+	}
+
+	for name, key := range t.HeaderMapping {
+		if value := header.Get(key); value != "" {
+			inputs[name] = value
+		}
+	}
+
+	return inputs, nil
+}
+
+// Write the configured response for a finished run
+func (t *triggerConfig) respond(w http.ResponseWriter, result *ExecutionResponse) error {
+	vars := copyVars(result.Variables)
+	vars["executionId"] = result.ID
+	vars["status"] = result.Status
+
+	headers := make(map[string]string, len(t.Response.Headers))
+	for key, value := range t.Response.Headers {
+		rendered, err := RenderTemplate(value, vars)
+		if err != nil {
+			return err
+		}
+		headers[key] = rendered
+	}
+
+	body, err := renderTemplateValue(t.Response.Body, vars)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	contentType := "application/json"
+	if text, ok := body.(string); ok {
+		data = []byte(text)
+		contentType = "text/plain; charset=utf-8"
+	} else if body != nil {
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	status := t.Response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	for key, value := range headers {
+		w.Header().Set(key, value)
+	}
+	w.WriteHeader(status)
+	w.Write(data)
+	return nil
+}
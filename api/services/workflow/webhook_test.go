@@ -0,0 +1,246 @@
+package workflow
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// A workflow started by a webhook with the given trigger metadata
+func webhookWorkflow(trigger map[string]interface{}) *Workflow {
+	wf := testWorkflow()
+	trigger["type"] = TriggerWebhook
+	wf.Definition.Nodes[0].Data.Metadata = map[string]interface{}{"trigger": trigger}
+	return wf
+}
+
+// Create the webhook of the workflow, returning it with its secret
+func createWebhook(t *testing.T, router http.Handler, workflowID, body string) *Webhook {
+	t.Helper()
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+workflowID+"/webhook", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var webhook Webhook
+	if err := json.Unmarshal(rec.Body.Bytes(), &webhook); err != nil {
+		t.Fatalf("Failed to decode webhook: %v", err)
+	}
+	return &webhook
+}
+
+func postWebhook(router http.Handler, url, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", url, strings.NewReader(body))
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTriggerInputs(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Request-Id", "abc123")
+
+	trigger := &triggerConfig{HeaderMapping: map[string]string{"requestId": "X-Request-Id", "missing": "X-Missing"}}
+	inputs, err := trigger.inputs([]byte(`{"city": "Sydney", "email": "john@example.com"}`), header)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if inputs["city"] != "Sydney" || inputs["email"] != "john@example.com" || inputs["requestId"] != "abc123" {
+		t.Errorf("Expected the body fields and mapped headers, got %v", inputs)
+	}
+	if _, ok := inputs["missing"]; ok {
+		t.Errorf("Expected missing headers to be skipped, got %v", inputs)
+	}
+
+	trigger = &triggerConfig{BodyMapping: map[string]string{"city": "$.location.city", "first": "$.readings[0]"}}
+	inputs, err = trigger.inputs([]byte(`{"location": {"city": "Perth"}, "readings": [31.5, 29]}`), header)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(inputs) != 2 || inputs["city"] != "Perth" || inputs["first"] != 31.5 {
+		t.Errorf("Expected only the mapped fields, got %v", inputs)
+	}
+
+	for _, body := range []string{`{`, `[1, 2]`} {
+		if _, err := (&triggerConfig{}).inputs([]byte(body), header); err == nil {
+			t.Errorf("Expected error for body %s", body)
+		}
+	}
+	if inputs, err := (&triggerConfig{}).inputs(nil, header); err != nil || len(inputs) != 0 {
+		t.Errorf("Expected no inputs for an empty body, got %v, %v", inputs, err)
+	}
+}
+
+func TestValidate_Trigger(t *testing.T) {
+	wf := testWorkflow()
+	wf.Definition.Nodes[0].Data.Metadata = map[string]interface{}{"trigger": map[string]interface{}{"type": "carrier-pigeon"}}
+
+	result := Validate(wf.Definition)
+	if result.Valid || result.Diagnostics[0].Code != "invalid_trigger" {
+		t.Errorf("Expected an invalid trigger diagnostic, got %+v", result)
+	}
+
+	if result := Validate(webhookWorkflow(map[string]interface{}{"wait": true}).Definition); !result.Valid {
+		t.Errorf("Expected the webhook trigger to be valid, got %+v", result.Diagnostics)
+	}
+}
+
+func TestService_Webhook(t *testing.T) {
+	wf := webhookWorkflow(map[string]interface{}{})
+	service := NewServiceWithDependencies(NewMockRepository(wf), NewExecutor())
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	webhook := createWebhook(t, router, wf.ID, "")
+	if webhook.Token == "" || webhook.Secret == "" || webhook.URL != "/api/v1/hooks/"+webhook.Token {
+		t.Fatalf("Expected a token, secret and URL, got %+v", webhook)
+	}
+
+	rec := doRequest(router, "GET", "/api/v1/workflows/"+wf.ID+"/webhook", "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), webhook.Secret) {
+		t.Errorf("Expected the webhook without its secret, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Without waiting, the run is queued and its ID returned straight away
+	rec = postWebhook(router, webhook.URL, `{"city": "Sydney"}`, nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var queued struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &queued)
+	exec := waitForExecution(t, router, queued.ID, func(exec *Execution) bool {
+		return exec.Status == "completed"
+	})
+	if exec.Inputs["city"] != "Sydney" {
+		t.Errorf("Expected the body to be mapped to the inputs, got %v", exec.Inputs)
+	}
+
+	// Creating the webhook again rotates the token
+	rotated := createWebhook(t, router, wf.ID, `{"secret": "s3cret"}`)
+	if rotated.Token == webhook.Token || rotated.Secret != "s3cret" {
+		t.Errorf("Expected a new token with the given secret, got %+v", rotated)
+	}
+	if rec = postWebhook(router, webhook.URL, `{}`, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the old URL to stop working, got %d", rec.Code)
+	}
+
+	rec = doRequest(router, "DELETE", "/api/v1/workflows/"+wf.ID+"/webhook", "")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rec.Code)
+	}
+	if rec = postWebhook(router, rotated.URL, `{}`, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted webhook to stop working, got %d", rec.Code)
+	}
+}
+
+func TestService_WebhookWaitsForResponse(t *testing.T) {
+	wf := webhookWorkflow(map[string]interface{}{
+		"bodyMapping":     map[string]interface{}{"name": "$.user.name"},
+		"verifySignature": true,
+		"wait":            true,
+		"response": map[string]interface{}{
+			"status":  200,
+			"headers": map[string]interface{}{"X-Execution-Id": "{{executionId}}"},
+			"body":    map[string]interface{}{"message": "{{greeting}}", "status": "{{status}}"},
+		},
+	})
+	wf.Definition.Nodes = append(wf.Definition.Nodes, Node{ID: "greet", Type: "greet"})
+	wf.Definition.Edges = []Edge{
+		{ID: "e1", Source: "start", Target: "greet"},
+		{ID: "e2", Source: "greet", Target: "end"},
+	}
+
+	executor := NewExecutor()
+	executor.RegisterNodeType("greet", NodeHandlerFunc(func(ctx context.Context, node *Node, wfVars map[string]interface{}, step *ExecutionStep) error {
+		wfVars["greeting"] = "Hello " + wfVars["name"].(string)
+		return nil
+	}))
+	service := NewServiceWithDependencies(NewMockRepository(wf), executor)
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	webhook := createWebhook(t, router, wf.ID, `{"secret": "s3cret"}`)
+	body := `{"user": {"name": "Ada"}}`
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, invalid := range []string{"", "sha256=00", "not hex"} {
+		rec := postWebhook(router, webhook.URL, body, http.Header{"X-Signature-256": {invalid}})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for signature %q, got %d", invalid, rec.Code)
+		}
+	}
+
+	rec := postWebhook(router, webhook.URL, body, http.Header{"X-Signature-256": {signature}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response["message"] != "Hello Ada" || response["status"] != "completed" {
+		t.Errorf("Expected the configured response, got %v", response)
+	}
+
+	// The run is recorded in the execution history
+	rec = doRequest(router, "GET", "/api/v1/executions/"+rec.Header().Get("X-Execution-Id"), "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the run to be recorded, got %d", rec.Code)
+	}
+}
+
+func TestService_WebhookErrors(t *testing.T) {
+	manual := testWorkflow()
+	service := NewServiceWithDependencies(NewMockRepository(manual), NewExecutor())
+	service.Start(context.Background())
+	defer service.Close()
+	router := newTestRouter(service)
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+manual.ID+"/webhook", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a workflow without a webhook trigger, got %d", rec.Code)
+	}
+	rec = doRequest(router, "POST", "/api/v1/workflows/does-not-exist/webhook", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+	rec = doRequest(router, "GET", "/api/v1/workflows/"+manual.ID+"/webhook", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+	rec = postWebhook(router, "/api/v1/hooks/unknown-token", `{}`, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+
+	wf := webhookWorkflow(map[string]interface{}{})
+	wf.ID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	service = NewServiceWithDependencies(NewMockRepository(wf), NewExecutor())
+	service.Start(context.Background())
+	defer service.Close()
+	router = newTestRouter(service)
+	webhook := createWebhook(t, router, wf.ID, "")
+
+	rec = postWebhook(router, webhook.URL, `not json`, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+	rec = postWebhook(router, webhook.URL, `"`+strings.Repeat("x", maxWebhookBodyBytes)+`"`, nil)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rec.Code)
+	}
+}
@@ -1,13 +1,20 @@
 package workflow
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
 )
 
 func (s *Service) HandleGetWorkflow(w http.ResponseWriter, r *http.Request) {
@@ -40,6 +47,324 @@ func (s *Service) HandleGetWorkflow(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Service) HandleListWorkflows(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := ListWorkflowsOptions{
+		Limit:  limit,
+		Offset: offset,
+		Search: strings.TrimSpace(query.Get("search")),
+		Sort:   query.Get("sort"),
+	}
+	if opts.Sort == "" {
+		opts.Sort = "updated_at"
+	}
+	if _, ok := workflowSortColumns[opts.Sort]; !ok {
+		http.Error(w, fmt.Sprintf("Invalid sort field: %s", opts.Sort), http.StatusBadRequest)
+		return
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		opts.Ascending = true
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	workflows, total, err := s.repo.ListWorkflows(ctx, opts)
+	if err != nil {
+		slog.Error("Failed to list workflows", "error", err)
+		http.Error(w, "Failed to list workflows", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"workflows": workflows,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+func (s *Service) HandleCreateWorkflow(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeWorkflowRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkValid(w, req.Definition) {
+		return
+	}
+
+	// The server generates the id, the definition shares it
+	workflow := &Workflow{
+		ID:         uuid.NewString(),
+		Name:       req.Name,
+		Definition: req.Definition,
+	}
+	workflow.Definition.ID = workflow.ID
+	slog.Debug("Creating workflow", "id", workflow.ID, "name", workflow.Name)
+
+	ctx := r.Context()
+	if err := s.repo.CreateWorkflow(ctx, workflow); err != nil {
+		slog.Error("Failed to create workflow", "error", err)
+		http.Error(w, "Failed to create workflow", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", strings.TrimSuffix(r.URL.Path, "/"), workflow.ID))
+	writeJSON(w, http.StatusCreated, workflow)
+}
+
+func (s *Service) HandleUpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Invalid workflow id", http.StatusBadRequest)
+		return
+	}
+
+	req, err := decodeWorkflowRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkValid(w, req.Definition) {
+		return
+	}
+
+	workflow := &Workflow{
+		ID:         id,
+		Name:       req.Name,
+		Definition: req.Definition,
+	}
+	workflow.Definition.ID = id
+	slog.Debug("Updating workflow", "id", id)
+
+	ctx := r.Context()
+	if err := s.repo.UpdateWorkflow(ctx, workflow); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("Workflow not found: %s", id), http.StatusNotFound)
+			return
+		}
+		slog.Error("Failed to update workflow", "id", id, "error", err)
+		http.Error(w, "Failed to update workflow", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workflow)
+}
+
+func (s *Service) HandleDeleteWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Invalid workflow id", http.StatusBadRequest)
+		return
+	}
+	slog.Debug("Deleting workflow", "id", id)
+
+	ctx := r.Context()
+	if err := s.repo.DeleteWorkflow(ctx, id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("Workflow not found: %s", id), http.StatusNotFound)
+			return
+		}
+		slog.Error("Failed to delete workflow", "id", id, "error", err)
+		http.Error(w, "Failed to delete workflow", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) HandleListWorkflowVersions(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	slog.Debug("Listing versions for workflow", "id", id)
+
+	ctx := r.Context()
+	if _, err := s.repo.GetWorkflow(ctx, id); err != nil {
+		http.Error(w, fmt.Sprintf("Workflow not found: %s", err.Error()), http.StatusNotFound)
+		return
+	}
+
+	versions, err := s.repo.ListWorkflowVersions(ctx, id)
+	if err != nil {
+		slog.Error("Failed to list workflow versions", "id", id, "error", err)
+		http.Error(w, "Failed to list workflow versions", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"versions": versions})
+}
+
+func (s *Service) HandleGetWorkflowVersion(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	version, _ := strconv.Atoi(mux.Vars(r)["version"])
+	slog.Debug("Returning workflow version", "id", id, "version", version)
+
+	ctx := r.Context()
+	workflowVersion, err := s.repo.GetWorkflowVersion(ctx, id, version)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Workflow version not found: %s", err.Error()), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workflowVersion)
+}
+
+func (s *Service) HandleDiffWorkflowVersions(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "from must be a version number", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "to must be a version number", http.StatusBadRequest)
+		return
+	}
+	slog.Debug("Comparing workflow versions", "id", id, "from", from, "to", to)
+
+	ctx := r.Context()
+	fromVersion, err := s.repo.GetWorkflowVersion(ctx, id, from)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Workflow version %d not found: %s", from, err.Error()), http.StatusNotFound)
+		return
+	}
+	toVersion, err := s.repo.GetWorkflowVersion(ctx, id, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Workflow version %d not found: %s", to, err.Error()), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DiffWorkflowVersions(fromVersion, toVersion))
+}
+
+func (s *Service) HandleRollbackWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	version, _ := strconv.Atoi(mux.Vars(r)["version"])
+	slog.Debug("Rolling back workflow", "id", id, "version", version)
+
+	ctx := r.Context()
+	// Revisions saved before definitions were validated may not be valid
+	revision, err := s.repo.GetWorkflowVersion(ctx, id, version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("Workflow version not found: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		slog.Error("Failed to get workflow version", "id", id, "version", version, "error", err)
+		http.Error(w, "Failed to roll back workflow", http.StatusInternalServerError)
+		return
+	}
+	if !s.checkValid(w, revision.Definition) {
+		return
+	}
+
+	workflow, err := s.repo.RollbackWorkflow(ctx, id, version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("Workflow version not found: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		slog.Error("Failed to roll back workflow", "id", id, "version", version, "error", err)
+		http.Error(w, "Failed to roll back workflow", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Rolled back workflow", "id", id, "from", version, "version", workflow.Version)
+	writeJSON(w, http.StatusOK, workflow)
+}
+
+func (s *Service) HandleValidateWorkflow(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var graph WorkflowGraph
+	if err := json.NewDecoder(r.Body).Decode(&graph); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.executor.Validate(graph))
+}
+
+// Validate a workflow graph, responding with the diagnostics if it is invalid.
+// Returns true if the graph is valid
+func (s *Service) checkValid(w http.ResponseWriter, graph WorkflowGraph) bool {
+	result := s.executor.Validate(graph)
+	if result.Valid {
+		return true
+	}
+
+	slog.Debug("Rejected invalid workflow definition", "id", graph.ID, "diagnostics", len(result.Diagnostics))
+	writeJSON(w, http.StatusUnprocessableEntity, result)
+	return false
+}
+
+// Check the inputs of a run against the input schema of the workflow, responding with the
+// fields that do not match if any. Returns the inputs converted to the types of the schema,
+// and true if they match
+func (s *Service) checkInputs(w http.ResponseWriter, graph WorkflowGraph, inputs map[string]interface{}) (map[string]interface{}, bool) {
+	schema := workflowInputSchema(graph)
+	if schema == nil {
+		return inputs, true
+	}
+
+	checked, errs := schema.check(inputs)
+	if len(errs) == 0 {
+		return checked, true
+	}
+
+	slog.Debug("Rejected invalid workflow inputs", "id", graph.ID, "errors", len(errs))
+	writeJSON(w, http.StatusUnprocessableEntity, InputValidationResult{Valid: false, Errors: errs})
+	return nil, false
+}
+
+// Decode and check the body of a create or update request
+func decodeWorkflowRequest(r *http.Request) (*WorkflowRequest, error) {
+	defer r.Body.Close()
+
+	var req WorkflowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid request format")
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, fmt.Errorf("workflow name is required")
+	}
+	if len(req.Name) > 255 {
+		return nil, fmt.Errorf("workflow name must be at most 255 characters")
+	}
+	if req.Definition.Nodes == nil {
+		req.Definition.Nodes = []Node{}
+	}
+	if req.Definition.Edges == nil {
+		req.Definition.Edges = []Edge{}
+	}
+
+	return &req, nil
+}
+
+// Serialise a response to JSON with the given status code
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
+
 func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request) {
 	// Get the workflow id from the request
 	id := mux.Vars(r)["id"]
@@ -62,6 +387,15 @@ func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	async := false
+	if value := r.URL.Query().Get("async"); value != "" {
+		async, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Invalid async parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Get the workflow from the repository
 	ctx := r.Context()
 	workflow, err := s.repo.GetWorkflow(ctx, id)
@@ -71,21 +405,97 @@ func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Validate the definition before executing it, or saving a provided one
+	definition := workflow.Definition
+	if execReq.WorkflowDefinition != nil {
+		definition = *execReq.WorkflowDefinition
+	}
+	if !s.checkValid(w, definition) {
+		return
+	}
+	inputs, ok := s.checkInputs(w, definition, executionInputs(&execReq))
+	if !ok {
+		return
+	}
+
 	// If a workflow definition is provided, use it instead of the stored one
 	if execReq.WorkflowDefinition != nil {
 		slog.Debug("Using provided workflow definition for execution", "id", id)
 		workflow.Definition = *execReq.WorkflowDefinition
 
+		// The run records the revision it ran, so it cannot run a definition that was not saved
 		if err := s.repo.SaveWorkflow(ctx, workflow); err != nil {
 			slog.Error("Failed to save updated workflow definition", "id", id, "error", err)
-		} else {
-			slog.Debug("Successfully saved updated workflow definition", "id", id)
+			http.Error(w, "Failed to save workflow definition", http.StatusInternalServerError)
+			return
 		}
+		slog.Debug("Successfully saved updated workflow definition", "id", id, "version", workflow.Version)
 	} else {
 		slog.Debug("Using stored workflow definition for execution", "id", id)
 	}
 
-	// Normalise the inputs, include the form data and the operator and threshold
+	// Asynchronous runs are queued and executed by the runner, the client polls for the result
+	if async {
+		s.enqueueExecution(ctx, w, workflow, inputs)
+		return
+	}
+
+	executionResult := s.executeAndRecord(ctx, workflow, inputs)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	// Serialise the execution result to JSON, and return it to the frontend
+	if err := json.NewEncoder(w).Encode(executionResult); err != nil {
+		slog.Error("Failed to encode execution response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Execute the workflow with the inputs and record the run in the execution history. The
+// runner checkpoints the run as it goes, like the runs it takes from the queue
+func (s *Service) executeAndRecord(ctx context.Context, workflow *Workflow, inputs map[string]interface{}) *ExecutionResponse {
+	execution := &Execution{
+		ID:              uuid.NewString(),
+		WorkflowID:      workflow.ID,
+		WorkflowVersion: workflow.Version,
+		Definition:      workflow.Definition,
+		Inputs:          inputs,
+		StartedAt:       time.Now(),
+	}
+	return s.runner.Execute(ctx, execution)
+}
+
+func (s *Service) enqueueExecution(ctx context.Context, w http.ResponseWriter, workflow *Workflow, inputs map[string]interface{}) {
+	execution := &Execution{
+		ID:              uuid.NewString(),
+		WorkflowID:      workflow.ID,
+		WorkflowVersion: workflow.Version,
+		Definition:      workflow.Definition,
+		Inputs:          inputs,
+		Status:          "queued",
+		StartedAt:       time.Now(),
+		Steps:           []ExecutionStep{},
+	}
+
+	// The run is saved and queued together, so it can be polled as soon as its ID is returned
+	if err := s.runner.Enqueue(ctx, execution); err != nil {
+		slog.Error("Failed to queue execution", "id", workflow.ID, "error", err)
+		http.Error(w, "Failed to queue execution", http.StatusInternalServerError)
+		return
+	}
+
+	// The runner owns the execution once it is queued, so only its ID is read here
+	w.Header().Set("Location", executionURL(execution.ID))
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"id":     execution.ID,
+		"status": "queued",
+	})
+}
+
+// Normalise the inputs, include the form data and the operator and threshold
+func executionInputs(execReq *ExecutionRequest) map[string]interface{} {
 	inputs := make(map[string]interface{})
 
 	// Add the form data to the inputs
@@ -103,15 +513,449 @@ func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	// Execute the workflow with the inputs
-	executionResult := s.executor.Execute(ctx, workflow, inputs)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	return inputs
+}
 
-	// Serialise the execution result to JSON, and return it to the frontend
-	if err := json.NewEncoder(w).Encode(executionResult); err != nil {
-		slog.Error("Failed to encode execution response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+func (s *Service) HandleListExecutions(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	slog.Debug("Listing executions for workflow", "id", id)
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+
+	ctx := r.Context()
+	executions, err := s.repo.ListExecutions(ctx, id, limit, offset)
+	if err != nil {
+		slog.Error("Failed to list executions", "id", id, "error", err)
+		http.Error(w, "Failed to list executions", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"executions": executions,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+func (s *Service) HandleGetExecution(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["runId"]
+	slog.Debug("Returning execution", "runId", runID)
+
+	ctx := r.Context()
+	execution, err := s.repo.GetExecution(ctx, runID)
+	if err != nil {
+		slog.Error("Failed to get execution", "runId", runID, "error", err)
+		http.Error(w, fmt.Sprintf("Execution not found: %s", err.Error()), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, execution)
+}
+
+// The URL clients poll for the progress of a run, and decide its approvals at
+func executionURL(id string) string {
+	return "/api/v1/executions/" + id
+}
+
+func (s *Service) HandleApproveExecution(w http.ResponseWriter, r *http.Request) {
+	s.decideExecution(w, r, ApprovalApprovedHandle)
+}
+
+func (s *Service) HandleRejectExecution(w http.ResponseWriter, r *http.Request) {
+	s.decideExecution(w, r, ApprovalRejectedHandle)
+}
+
+// Approve or reject the approval a run is waiting at, and queue the run to continue
+// through the handle of the decision
+func (s *Service) decideExecution(w http.ResponseWriter, r *http.Request, handle string) {
+	runID := mux.Vars(r)["runId"]
+	slog.Debug("Deciding approval", "runId", runID, "decision", handle)
+
+	// The body is optional, it is needed to name the approver and give their token when the
+	// node has approvers
+	defer r.Body.Close()
+	var req ApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	execution, err := s.repo.GetExecution(ctx, runID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Execution not found: %s", err.Error()), http.StatusNotFound)
+		return
+	}
+
+	if err := decideApproval(execution, handle, &req, time.Now()); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, errNotApprover) || errors.Is(err, errApprovalToken) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	// Another decision, or the approval expiring, may have resumed the run meanwhile
+	if err := s.runner.Resume(ctx, execution); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, errNotAwaitingApproval.Error(), http.StatusConflict)
+			return
+		}
+		slog.Error("Failed to resume execution", "runId", runID, "error", err)
+		http.Error(w, "Failed to resume execution", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Decided approval", "runId", runID, "decision", handle, "approver", req.Approver)
+	w.Header().Set("Location", executionURL(execution.ID))
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"id":     execution.ID,
+		"status": "queued",
+	})
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// Parse the limit and offset query parameters used by the list endpoints
+func parsePagination(r *http.Request) (int, int, error) {
+	limit, offset := defaultPageLimit, 0
+	query := r.URL.Query()
+
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		limit = n
+	}
+
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+		offset = n
+	}
+
+	return limit, offset, nil
+}
+
+func (s *Service) HandleListSchedules(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	slog.Debug("Listing schedules for workflow", "id", id)
+
+	ctx := r.Context()
+	schedules, err := s.repo.ListSchedules(ctx, id)
+	if err != nil {
+		slog.Error("Failed to list schedules", "id", id, "error", err)
+		http.Error(w, "Failed to list schedules", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"schedules": schedules,
+	})
+}
+
+func (s *Service) HandleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	slog.Debug("Creating schedule for workflow", "id", id)
+
+	ctx := r.Context()
+	workflow, err := s.repo.GetWorkflow(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Workflow not found: %s", err.Error()), http.StatusNotFound)
+		return
+	}
+
+	defer r.Body.Close()
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	// Scheduled runs are checked against the schema as it is now, and again when they run
+	if _, ok := s.checkInputs(w, workflow.Definition, executionInputs(&ExecutionRequest{FormData: req.FormData, Condition: req.Condition})); !ok {
+		return
+	}
+
+	schedule, err := newSchedule(id, &req, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.repo.CreateSchedule(ctx, schedule); err != nil {
+		slog.Error("Failed to create schedule", "id", id, "error", err)
+		http.Error(w, "Failed to create schedule", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Created schedule", "id", id, "scheduleId", schedule.ID, "nextRunAt", schedule.NextRunAt)
+	w.Header().Set("Location", "/api/v1/schedules/"+schedule.ID)
+	writeJSON(w, http.StatusCreated, schedule)
+}
+
+func (s *Service) HandleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	scheduleID := mux.Vars(r)["scheduleId"]
+
+	ctx := r.Context()
+	schedule, err := s.repo.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Schedule not found: %s", err.Error()), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+func (s *Service) HandlePauseSchedule(w http.ResponseWriter, r *http.Request) {
+	s.setSchedulePaused(w, r, true)
+}
+
+func (s *Service) HandleResumeSchedule(w http.ResponseWriter, r *http.Request) {
+	s.setSchedulePaused(w, r, false)
+}
+
+// Pause or resume a schedule. A resumed schedule is next due at its first fire time from
+// now, so the fire times missed while it was paused are never caught up
+func (s *Service) setSchedulePaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	scheduleID := mux.Vars(r)["scheduleId"]
+	slog.Debug("Setting schedule paused", "scheduleId", scheduleID, "paused", paused)
+
+	ctx := r.Context()
+	schedule, err := s.repo.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Schedule not found: %s", err.Error()), http.StatusNotFound)
+		return
+	}
+
+	nextRunAt := schedule.NextRunAt
+	if schedule.Paused && !paused {
+		cronSchedule, loc, err := parseSchedule(schedule.CronExpression, schedule.Timezone)
+		if err != nil {
+			slog.Error("Failed to parse schedule", "scheduleId", scheduleID, "error", err)
+			http.Error(w, "Failed to resume schedule", http.StatusInternalServerError)
+			return
+		}
+		nextRunAt = cronSchedule.Next(time.Now().In(loc)).UTC()
+	}
+
+	if err := s.repo.SetSchedulePaused(ctx, scheduleID, paused, nextRunAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("Schedule not found: %s", scheduleID), http.StatusNotFound)
+			return
+		}
+		slog.Error("Failed to update schedule", "scheduleId", scheduleID, "error", err)
+		http.Error(w, "Failed to update schedule", http.StatusInternalServerError)
+		return
+	}
+
+	schedule.Paused = paused
+	schedule.NextRunAt = nextRunAt
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+func (s *Service) HandleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	scheduleID := mux.Vars(r)["scheduleId"]
+	slog.Debug("Deleting schedule", "scheduleId", scheduleID)
+
+	ctx := r.Context()
+	if err := s.repo.DeleteSchedule(ctx, scheduleID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("Schedule not found: %s", scheduleID), http.StatusNotFound)
+			return
+		}
+		slog.Error("Failed to delete schedule", "scheduleId", scheduleID, "error", err)
+		http.Error(w, "Failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// The URL external systems post to, to trigger a workflow
+func webhookURL(token string) string {
+	return "/api/v1/hooks/" + token
+}
+
+func (s *Service) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	slog.Debug("Creating webhook for workflow", "id", id)
+
+	ctx := r.Context()
+	workflow, err := s.repo.GetWorkflow(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Workflow not found: %s", err.Error()), http.StatusNotFound)
+		return
+	}
+	if trigger, err := workflowTrigger(workflow.Definition); err != nil || trigger.Type != TriggerWebhook {
+		http.Error(w, "Workflow is not started by a webhook trigger", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional, without one a secret is generated
+	defer r.Body.Close()
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	token, err := randomToken()
+	if err == nil && req.Secret == "" {
+		req.Secret, err = randomToken()
+	}
+	if err != nil {
+		slog.Error("Failed to generate webhook token", "id", id, "error", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	// Creating the webhook again replaces its token and secret, so the old URL stops working
+	webhook := &Webhook{WorkflowID: workflow.ID, Token: token, Secret: req.Secret}
+	if err := s.repo.SaveWebhook(ctx, webhook); err != nil {
+		slog.Error("Failed to save webhook", "id", id, "error", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	webhook.URL = webhookURL(webhook.Token)
+
+	slog.Info("Created webhook", "id", id)
+	w.Header().Set("Location", "/api/v1/workflows/"+workflow.ID+"/webhook")
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+func (s *Service) HandleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	webhook, err := s.repo.GetWebhook(r.Context(), id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Webhook not found: %s", err.Error()), http.StatusNotFound)
+		return
+	}
+
+	// The secret is only shown when the webhook is created
+	webhook.Secret = ""
+	webhook.URL = webhookURL(webhook.Token)
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+func (s *Service) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	slog.Debug("Deleting webhook for workflow", "id", id)
+
+	if err := s.repo.DeleteWebhook(r.Context(), id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("Webhook not found: %s", id), http.StatusNotFound)
+			return
+		}
+		slog.Error("Failed to delete webhook", "id", id, "error", err)
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTriggerWebhook starts a run of the workflow the webhook belongs to, with variables
+// mapped from the request. It responds with the queued run's ID straight away, or waits
+// for the run to finish if the trigger is configured to.
+func (s *Service) HandleTriggerWebhook(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	ctx := r.Context()
+	webhook, err := s.repo.GetWebhookByToken(ctx, token)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			slog.Error("Failed to get webhook", "error", err)
+		}
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	logger := slog.With("id", webhook.WorkflowID)
+
+	workflow, err := s.repo.GetWorkflow(ctx, webhook.WorkflowID)
+	if err != nil {
+		logger.Error("Failed to get workflow for webhook", "error", err)
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	// The webhook stops working if the trigger is removed from the workflow
+	trigger, err := workflowTrigger(workflow.Definition)
+	if err != nil || trigger.Type != TriggerWebhook {
+		logger.Warn("Webhook called for a workflow without a webhook trigger")
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	if trigger.VerifySignature && !verifySignature(webhook.Secret, body, r.Header.Get(trigger.SignatureHeader)) {
+		logger.Warn("Rejected webhook request with an invalid signature")
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	inputs, err := trigger.inputs(body, r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkValid(w, workflow.Definition) {
+		return
+	}
+	inputs, ok := s.checkInputs(w, workflow.Definition, inputs)
+	if !ok {
+		return
+	}
+
+	if !trigger.Wait {
+		s.enqueueExecution(ctx, w, workflow, inputs)
+		return
+	}
+
+	result := s.executeAndRecord(ctx, workflow, inputs)
+	switch {
+	case result.Status == "waiting":
+		// The run continues once it is resumed, the caller polls for the result
+		w.Header().Set("Location", executionURL(result.ID))
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"id":     result.ID,
+			"status": result.Status,
+		})
+	case result.Status != "completed":
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"id":     result.ID,
+			"status": result.Status,
+		})
+	case trigger.Response == nil:
+		writeJSON(w, http.StatusOK, result)
+	default:
+		if err := trigger.respond(w, result); err != nil {
+			logger.Error("Failed to render webhook response", "executionId", result.ID, "error", err)
+			http.Error(w, "Failed to render webhook response", http.StatusInternalServerError)
+		}
+	}
 }
@@ -0,0 +1,923 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// MockRepository is an in-memory RepositoryInterface
+type MockRepository struct {
+	mu         sync.Mutex
+	workflows  map[string]*Workflow
+	versions   map[string][]WorkflowVersion
+	executions map[string]*Execution
+	// queue holds the queued executions in the order they were queued
+	queue     []*mockQueuedRun
+	schedules map[string]*Schedule
+	webhooks  map[string]*Webhook
+}
+
+type mockQueuedRun struct {
+	id       string
+	owner    string
+	expires  time.Time
+	attempts int
+}
+
+func NewMockRepository(workflows ...*Workflow) *MockRepository {
+	repo := &MockRepository{
+		workflows:  make(map[string]*Workflow),
+		versions:   make(map[string][]WorkflowVersion),
+		executions: make(map[string]*Execution),
+		schedules:  make(map[string]*Schedule),
+		webhooks:   make(map[string]*Webhook),
+	}
+	for _, wf := range workflows {
+		repo.saveRevision(wf)
+	}
+	return repo
+}
+
+// Store a new revision of the workflow, unless it is unchanged. Callers hold the lock
+func (m *MockRepository) saveRevision(wf *Workflow) {
+	if existing, ok := m.workflows[wf.ID]; ok {
+		if existing.Name == wf.Name && reflect.DeepEqual(existing.Definition, wf.Definition) {
+			wf.Version, wf.CreatedAt, wf.UpdatedAt = existing.Version, existing.CreatedAt, existing.UpdatedAt
+			return
+		}
+		wf.Version, wf.CreatedAt = existing.Version+1, existing.CreatedAt
+	} else {
+		wf.Version, wf.CreatedAt = 1, time.Now()
+	}
+	wf.UpdatedAt = time.Now()
+
+	copied := *wf
+	m.workflows[wf.ID] = &copied
+	m.versions[wf.ID] = append(m.versions[wf.ID], WorkflowVersion{
+		WorkflowID: wf.ID,
+		Version:    wf.Version,
+		Name:       wf.Name,
+		Definition: wf.Definition,
+		CreatedAt:  wf.UpdatedAt,
+	})
+}
+
+func (m *MockRepository) GetWorkflow(ctx context.Context, id string) (*Workflow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wf, ok := m.workflows[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	copied := *wf
+	return &copied, nil
+}
+
+func (m *MockRepository) SaveWorkflow(ctx context.Context, wf *Workflow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saveRevision(wf)
+	return nil
+}
+
+func (m *MockRepository) CreateWorkflow(ctx context.Context, wf *Workflow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saveRevision(wf)
+	return nil
+}
+
+func (m *MockRepository) UpdateWorkflow(ctx context.Context, wf *Workflow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.workflows[wf.ID]; !ok {
+		return pgx.ErrNoRows
+	}
+	m.saveRevision(wf)
+	return nil
+}
+
+func (m *MockRepository) ListWorkflowVersions(ctx context.Context, workflowID string) ([]WorkflowVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := []WorkflowVersion{}
+	for i := len(m.versions[workflowID]) - 1; i >= 0; i-- {
+		v := m.versions[workflowID][i]
+		v.Definition = WorkflowGraph{}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+func (m *MockRepository) GetWorkflowVersion(ctx context.Context, workflowID string, version int) (*WorkflowVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.versions[workflowID] {
+		if v.Version == version {
+			return &v, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *MockRepository) RollbackWorkflow(ctx context.Context, workflowID string, version int) (*Workflow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.versions[workflowID] {
+		if v.Version == version {
+			wf := &Workflow{ID: workflowID, Name: v.Name, Definition: v.Definition}
+			m.saveRevision(wf)
+			return wf, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *MockRepository) DeleteWorkflow(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.workflows[id]; !ok {
+		return pgx.ErrNoRows
+	}
+	delete(m.workflows, id)
+	delete(m.versions, id)
+	delete(m.webhooks, id)
+	return nil
+}
+
+func (m *MockRepository) ListWorkflows(ctx context.Context, opts ListWorkflowsOptions) ([]WorkflowSummary, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	workflows := []WorkflowSummary{}
+	for _, wf := range m.workflows {
+		if strings.Contains(strings.ToLower(wf.Name), strings.ToLower(opts.Search)) {
+			workflows = append(workflows, WorkflowSummary{ID: wf.ID, Name: wf.Name, CreatedAt: wf.CreatedAt, UpdatedAt: wf.UpdatedAt})
+		}
+	}
+	sort.Slice(workflows, func(i, j int) bool {
+		less := workflows[i].UpdatedAt.Before(workflows[j].UpdatedAt)
+		if opts.Sort == "name" {
+			less = workflows[i].Name < workflows[j].Name
+		}
+		if opts.Ascending {
+			return less
+		}
+		return !less
+	})
+	return paginate(workflows, opts.Limit, opts.Offset), len(workflows), nil
+}
+
+func (m *MockRepository) SaveExecution(ctx context.Context, exec *Execution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *exec
+	copied.Steps = append([]ExecutionStep{}, exec.Steps...)
+	copied.State = copyRunState(exec.State)
+	m.executions[exec.ID] = &copied
+	return nil
+}
+
+func (m *MockRepository) AppendExecutionStep(ctx context.Context, exec *Execution, workerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.leased(exec.ID, workerID); !ok {
+		return pgx.ErrNoRows
+	}
+	stored, ok := m.executions[exec.ID]
+	if !ok || len(exec.Steps) == 0 {
+		return pgx.ErrNoRows
+	}
+	stored.Status = exec.Status
+	stored.State = copyRunState(exec.State)
+	stored.Steps = append(stored.Steps, exec.Steps[len(exec.Steps)-1])
+	return nil
+}
+
+// Copy the state through JSON, as it is stored in the database
+func copyRunState(state *RunState) *RunState {
+	if state == nil {
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		panic(err)
+	}
+	var copied RunState
+	if err := json.Unmarshal(data, &copied); err != nil {
+		panic(err)
+	}
+	return &copied
+}
+
+func (m *MockRepository) GetExecution(ctx context.Context, id string) (*Execution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	exec, ok := m.executions[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	copied := *exec
+	copied.State = copyRunState(exec.State)
+	return &copied, nil
+}
+
+func (m *MockRepository) ListExecutions(ctx context.Context, workflowID string, limit, offset int) ([]Execution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	executions := []Execution{}
+	for _, exec := range m.executions {
+		if exec.WorkflowID == workflowID {
+			executions = append(executions, *exec)
+		}
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].StartedAt.After(executions[j].StartedAt)
+	})
+	return paginate(executions, limit, offset), nil
+}
+
+func (m *MockRepository) EnqueueExecution(ctx context.Context, exec *Execution) error {
+	if err := m.SaveExecution(ctx, exec); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = append(m.queue, &mockQueuedRun{id: exec.ID})
+	return nil
+}
+
+func (m *MockRepository) StartExecution(ctx context.Context, exec *Execution, workerID string, lease time.Duration) error {
+	if err := m.SaveExecution(ctx, exec); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = append(m.queue, &mockQueuedRun{id: exec.ID, owner: workerID, expires: time.Now().Add(lease), attempts: 1})
+	return nil
+}
+
+func (m *MockRepository) ClaimExecution(ctx context.Context, workerID string, lease time.Duration) (*Execution, int, error) {
+	m.mu.Lock()
+	var claimed *mockQueuedRun
+	for _, run := range m.queue {
+		if run.owner == "" || time.Now().After(run.expires) {
+			run.owner, run.expires = workerID, time.Now().Add(lease)
+			run.attempts++
+			claimed = run
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if claimed == nil {
+		return nil, 0, pgx.ErrNoRows
+	}
+	exec, err := m.GetExecution(ctx, claimed.id)
+	return exec, claimed.attempts, err
+}
+
+// Find the queued run leased to the worker. Callers hold the lock
+func (m *MockRepository) leased(id, workerID string) (int, bool) {
+	for i, run := range m.queue {
+		if run.id == id && run.owner == workerID {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (m *MockRepository) RenewExecutionLease(ctx context.Context, id, workerID string, lease time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.leased(id, workerID)
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	m.queue[i].expires = time.Now().Add(lease)
+	return nil
+}
+
+func (m *MockRepository) ReleaseExecution(ctx context.Context, id, workerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.leased(id, workerID)
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	m.queue[i].owner = ""
+	m.queue[i].attempts = max(m.queue[i].attempts-1, 0)
+	return nil
+}
+
+func (m *MockRepository) CompleteExecution(ctx context.Context, exec *Execution, workerID string) error {
+	m.mu.Lock()
+	i, ok := m.leased(exec.ID, workerID)
+	if ok {
+		m.queue = append(m.queue[:i], m.queue[i+1:]...)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	return m.SaveExecution(ctx, exec)
+}
+
+func (m *MockRepository) ResumeExecution(ctx context.Context, exec *Execution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.executions[exec.ID]
+	if !ok || stored.Status != "waiting" {
+		return pgx.ErrNoRows
+	}
+	exec.Status = "queued"
+	stored.Status = "queued"
+	stored.State = copyRunState(exec.State)
+	m.queue = append(m.queue, &mockQueuedRun{id: exec.ID})
+	return nil
+}
+
+func (m *MockRepository) ListDueExecutions(ctx context.Context, now time.Time) ([]Execution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	executions := []Execution{}
+	for _, exec := range m.executions {
+		if exec.Status == "waiting" && exec.State != nil && exec.State.WaitUntil != nil && !exec.State.WaitUntil.After(now) {
+			copied := *exec
+			copied.State = copyRunState(exec.State)
+			executions = append(executions, copied)
+		}
+	}
+	return executions, nil
+}
+
+func (m *MockRepository) CreateSchedule(ctx context.Context, schedule *Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedule.CreatedAt = time.Now()
+	schedule.UpdatedAt = schedule.CreatedAt
+	copied := *schedule
+	m.schedules[schedule.ID] = &copied
+	return nil
+}
+
+func (m *MockRepository) GetSchedule(ctx context.Context, id string) (*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedule, ok := m.schedules[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	copied := *schedule
+	return &copied, nil
+}
+
+func (m *MockRepository) ListSchedules(ctx context.Context, workflowID string) ([]Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedules := []Schedule{}
+	for _, schedule := range m.schedules {
+		if schedule.WorkflowID == workflowID {
+			schedules = append(schedules, *schedule)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+	return schedules, nil
+}
+
+func (m *MockRepository) SetSchedulePaused(ctx context.Context, id string, paused bool, nextRunAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedule, ok := m.schedules[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	schedule.Paused = paused
+	schedule.NextRunAt = nextRunAt
+	schedule.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *MockRepository) DeleteSchedule(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.schedules[id]; !ok {
+		return pgx.ErrNoRows
+	}
+	delete(m.schedules, id)
+	return nil
+}
+
+func (m *MockRepository) FireDueSchedules(ctx context.Context, now time.Time, fire ScheduleFireFunc) error {
+	m.mu.Lock()
+	var due []*Schedule
+	for _, schedule := range m.schedules {
+		if !schedule.Paused && !schedule.NextRunAt.After(now) {
+			due = append(due, schedule)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, schedule := range due {
+		// Schedules that fail to fire are tried again later, without holding up the others
+		wf, err := m.GetWorkflow(ctx, schedule.WorkflowID)
+		if err != nil {
+			m.mu.Lock()
+			schedule.NextRunAt = now.Add(scheduleRetryDelay)
+			m.mu.Unlock()
+			continue
+		}
+		m.mu.Lock()
+		copied := *schedule
+		m.mu.Unlock()
+
+		executions, next := fire(&copied, wf)
+		for _, exec := range executions {
+			if err := m.EnqueueExecution(ctx, exec); err != nil {
+				return err
+			}
+		}
+
+		m.mu.Lock()
+		schedule.NextRunAt = next
+		if len(executions) > 0 {
+			lastRunAt := now
+			schedule.LastRunAt = &lastRunAt
+		}
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+func (m *MockRepository) SaveWebhook(ctx context.Context, webhook *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	webhook.CreatedAt = time.Now()
+	copied := *webhook
+	m.webhooks[webhook.WorkflowID] = &copied
+	return nil
+}
+
+func (m *MockRepository) GetWebhook(ctx context.Context, workflowID string) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	webhook, ok := m.webhooks[workflowID]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	copied := *webhook
+	return &copied, nil
+}
+
+func (m *MockRepository) GetWebhookByToken(ctx context.Context, token string) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, webhook := range m.webhooks {
+		if webhook.Token == token {
+			copied := *webhook
+			return &copied, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *MockRepository) DeleteWebhook(ctx context.Context, workflowID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.webhooks[workflowID]; !ok {
+		return pgx.ErrNoRows
+	}
+	delete(m.webhooks, workflowID)
+	return nil
+}
+
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// MockExecutor returns a fixed response for every execution
+type MockExecutor struct {
+	response *ExecutionResponse
+	inputs   map[string]interface{}
+}
+
+func (m *MockExecutor) Execute(ctx context.Context, wf *Workflow, inputs map[string]interface{}) *ExecutionResponse {
+	return m.ExecuteWithProgress(ctx, wf, inputs, nil)
+}
+
+func (m *MockExecutor) ExecuteWithProgress(ctx context.Context, wf *Workflow, inputs map[string]interface{}, onStep func(ExecutionStep)) *ExecutionResponse {
+	m.inputs = inputs
+	response := *m.response
+	for _, step := range response.Steps {
+		if onStep != nil {
+			onStep(step)
+		}
+	}
+	return &response
+}
+
+func (m *MockExecutor) Resume(ctx context.Context, wf *Workflow, state *RunState, onStep func(ExecutionStep)) *ExecutionResponse {
+	return m.ExecuteWithProgress(ctx, wf, state.Variables, onStep)
+}
+
+func (m *MockExecutor) Validate(graph WorkflowGraph) *ValidationResult {
+	return Validate(graph)
+}
+
+func testWorkflow() *Workflow {
+	return &Workflow{
+		ID:   "550e8400-e29b-41d4-a716-446655440000",
+		Name: "Test Workflow",
+		Definition: WorkflowGraph{
+			ID: "550e8400-e29b-41d4-a716-446655440000",
+			Nodes: []Node{
+				{ID: "start", Type: "start"},
+				{ID: "end", Type: "end"},
+			},
+			Edges: []Edge{{ID: "e1", Source: "start", Target: "end"}},
+		},
+	}
+}
+
+func newTestRouter(service *Service) *mux.Router {
+	router := mux.NewRouter()
+	service.LoadRoutes(router.PathPrefix("/api/v1").Subrouter(), false)
+	return router
+}
+
+func doRequest(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestService_ExecutionHistory(t *testing.T) {
+	wf := testWorkflow()
+	repo := NewMockRepository(wf)
+	executor := &MockExecutor{response: &ExecutionResponse{
+		Status: "completed",
+		Steps:  []ExecutionStep{{NodeID: "start", Status: "completed"}, {NodeID: "end", Status: "completed"}},
+	}}
+	router := newTestRouter(NewServiceWithDependencies(repo, executor))
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute",
+		`{"formData": {"city": "Sydney"}, "condition": {"operator": "greater_than", "threshold": 25}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result ExecutionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.ID == "" {
+		t.Fatal("Expected the execution ID to be returned")
+	}
+
+	t.Run("get execution", func(t *testing.T) {
+		rec := doRequest(router, "GET", "/api/v1/executions/"+result.ID, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		var exec Execution
+		if err := json.Unmarshal(rec.Body.Bytes(), &exec); err != nil {
+			t.Fatalf("Failed to decode execution: %v", err)
+		}
+		if exec.WorkflowID != wf.ID || exec.Status != "completed" || len(exec.Steps) != 2 {
+			t.Errorf("Unexpected execution record: %+v", exec)
+		}
+		if exec.Inputs["city"] != "Sydney" || exec.Inputs["operator"] != "greater_than" {
+			t.Errorf("Expected inputs to be recorded, got %v", exec.Inputs)
+		}
+		if exec.FinishedAt == nil {
+			t.Error("Expected finishedAt to be set")
+		}
+		if exec.WorkflowVersion != 1 {
+			t.Errorf("Expected workflow version 1, got %d", exec.WorkflowVersion)
+		}
+	})
+
+	t.Run("list executions", func(t *testing.T) {
+		rec := doRequest(router, "GET", "/api/v1/workflows/"+wf.ID+"/executions?limit=10", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		var response struct {
+			Executions []Execution `json:"executions"`
+			Limit      int         `json:"limit"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode executions: %v", err)
+		}
+		if len(response.Executions) != 1 || response.Executions[0].ID != result.ID {
+			t.Errorf("Expected the execution to be listed, got %+v", response.Executions)
+		}
+		if response.Limit != 10 {
+			t.Errorf("Expected limit 10, got %d", response.Limit)
+		}
+	})
+
+	t.Run("invalid pagination", func(t *testing.T) {
+		rec := doRequest(router, "GET", "/api/v1/workflows/"+wf.ID+"/executions?limit=1000", "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("unknown execution", func(t *testing.T) {
+		rec := doRequest(router, "GET", "/api/v1/executions/does-not-exist", "")
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestService_WorkflowCRUD(t *testing.T) {
+	repo := NewMockRepository()
+	router := newTestRouter(NewServiceWithDependencies(repo, NewExecutor()))
+
+	definition := `{"nodes": [{"id": "start", "type": "start"}, {"id": "end", "type": "end"}],
+		"edges": [{"id": "e1", "source": "start", "target": "end"}]}`
+
+	// Create
+	rec := doRequest(router, "POST", "/api/v1/workflows", `{"name": "Daily Report", "definition": `+definition+`}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created Workflow
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode workflow: %v", err)
+	}
+	if _, err := uuid.Parse(created.ID); err != nil {
+		t.Fatalf("Expected a generated UUID, got %q", created.ID)
+	}
+	if created.Definition.ID != created.ID {
+		t.Errorf("Expected definition id %s, got %s", created.ID, created.Definition.ID)
+	}
+	if rec.Header().Get("Location") != "/api/v1/workflows/"+created.ID {
+		t.Errorf("Unexpected Location header: %s", rec.Header().Get("Location"))
+	}
+
+	// A second workflow for listing
+	doRequest(router, "POST", "/api/v1/workflows", `{"name": "Weather Alert", "definition": `+definition+`}`)
+
+	// Update
+	rec = doRequest(router, "PUT", "/api/v1/workflows/"+created.ID, `{"name": "Daily Summary", "definition": `+definition+`}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if wf, _ := repo.GetWorkflow(context.Background(), created.ID); wf.Name != "Daily Summary" {
+		t.Errorf("Expected the name to be updated, got %s", wf.Name)
+	}
+
+	// List with search
+	rec = doRequest(router, "GET", "/api/v1/workflows?search=daily&sort=updated_at&order=desc", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	var list struct {
+		Workflows []WorkflowSummary `json:"workflows"`
+		Total     int               `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	if list.Total != 1 || len(list.Workflows) != 1 || list.Workflows[0].ID != created.ID {
+		t.Errorf("Expected only the updated workflow to match, got %+v", list)
+	}
+
+	// Delete
+	rec = doRequest(router, "DELETE", "/api/v1/workflows/"+created.ID, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", rec.Code)
+	}
+	rec = doRequest(router, "DELETE", "/api/v1/workflows/"+created.ID, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting twice, got %d", rec.Code)
+	}
+}
+
+func TestService_WorkflowCRUDErrors(t *testing.T) {
+	router := newTestRouter(NewServiceWithDependencies(NewMockRepository(), NewExecutor()))
+	missingID := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	valid := `{"name": "x", "definition": {"nodes": [{"id": "start", "type": "start"}, {"id": "end", "type": "end"}],
+		"edges": [{"id": "e1", "source": "start", "target": "end"}]}}`
+	invalid := `{"name": "x", "definition": {"nodes": [{"id": "end", "type": "end"}], "edges": []}}`
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "create without name", method: "POST", path: "/api/v1/workflows", body: `{"definition": {}}`, expectedStatus: http.StatusBadRequest},
+		{name: "create with invalid body", method: "POST", path: "/api/v1/workflows", body: `{`, expectedStatus: http.StatusBadRequest},
+		{name: "update missing workflow", method: "PUT", path: "/api/v1/workflows/" + missingID, body: valid, expectedStatus: http.StatusNotFound},
+		{name: "create invalid graph", method: "POST", path: "/api/v1/workflows", body: invalid, expectedStatus: http.StatusUnprocessableEntity},
+		{name: "update invalid graph", method: "PUT", path: "/api/v1/workflows/" + missingID, body: invalid, expectedStatus: http.StatusUnprocessableEntity},
+		{name: "update invalid id", method: "PUT", path: "/api/v1/workflows/not-a-uuid", body: `{"name": "x"}`, expectedStatus: http.StatusBadRequest},
+		{name: "delete missing workflow", method: "DELETE", path: "/api/v1/workflows/" + missingID, expectedStatus: http.StatusNotFound},
+		{name: "list with invalid sort", method: "GET", path: "/api/v1/workflows?sort=definition", expectedStatus: http.StatusBadRequest},
+		{name: "list with invalid order", method: "GET", path: "/api/v1/workflows?order=sideways", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, tt.method, tt.path, tt.body)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestService_WorkflowVersions(t *testing.T) {
+	wf := testWorkflow()
+	repo := NewMockRepository(wf)
+	router := newTestRouter(NewServiceWithDependencies(repo, NewExecutor()))
+	base := "/api/v1/workflows/" + wf.ID
+
+	// Revision 2 adds a node, revision 3 renames the workflow
+	v2 := `{"name": "Test Workflow", "definition": {"nodes": [{"id": "start", "type": "start"}, {"id": "form", "type": "form", "data": {"metadata": {"inputFields": []}}},
+		{"id": "end", "type": "end"}], "edges": [{"id": "e1", "source": "start", "target": "form"},
+		{"id": "e2", "source": "form", "target": "end"}]}}`
+	if rec := doRequest(router, "PUT", base, v2); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	// Saving the same definition again does not create a revision
+	doRequest(router, "PUT", base, v2)
+	v3 := strings.Replace(v2, `"Test Workflow"`, `"Renamed Workflow"`, 1)
+	doRequest(router, "PUT", base, v3)
+
+	t.Run("list versions", func(t *testing.T) {
+		rec := doRequest(router, "GET", base+"/versions", "")
+		var response struct {
+			Versions []WorkflowVersion `json:"versions"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode versions: %v", err)
+		}
+		var numbers []int
+		for _, v := range response.Versions {
+			numbers = append(numbers, v.Version)
+		}
+		if !reflect.DeepEqual(numbers, []int{3, 2, 1}) {
+			t.Errorf("Expected versions [3 2 1], got %v", numbers)
+		}
+	})
+
+	t.Run("get version", func(t *testing.T) {
+		rec := doRequest(router, "GET", base+"/versions/1", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+		var v WorkflowVersion
+		if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+			t.Fatalf("Failed to decode version: %v", err)
+		}
+		if len(v.Definition.Nodes) != 2 {
+			t.Errorf("Expected the original definition, got %d nodes", len(v.Definition.Nodes))
+		}
+
+		if rec := doRequest(router, "GET", base+"/versions/9", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for a missing version, got %d", rec.Code)
+		}
+	})
+
+	t.Run("diff versions", func(t *testing.T) {
+		rec := doRequest(router, "GET", base+"/diff?from=1&to=3", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+		var diff WorkflowDiff
+		if err := json.Unmarshal(rec.Body.Bytes(), &diff); err != nil {
+			t.Fatalf("Failed to decode diff: %v", err)
+		}
+		if !diff.NameChanged {
+			t.Error("Expected the name change to be reported")
+		}
+		if !reflect.DeepEqual(diff.AddedNodes, []string{"form"}) {
+			t.Errorf("Expected form to be added, got %v", diff.AddedNodes)
+		}
+		if !reflect.DeepEqual(diff.AddedEdges, []string{"e2"}) || !reflect.DeepEqual(diff.ChangedEdges, []string{"e1"}) {
+			t.Errorf("Unexpected edge changes: added %v, changed %v", diff.AddedEdges, diff.ChangedEdges)
+		}
+
+		if rec := doRequest(router, "GET", base+"/diff?from=1", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 without to, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		rec := doRequest(router, "POST", base+"/versions/1/rollback", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		current, _ := repo.GetWorkflow(context.Background(), wf.ID)
+		if current.Version != 4 || current.Name != "Test Workflow" || len(current.Definition.Nodes) != 2 {
+			t.Errorf("Expected revision 1 to be promoted as revision 4, got %+v", current)
+		}
+
+		if rec := doRequest(router, "POST", base+"/versions/42/rollback", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for a missing version, got %d", rec.Code)
+		}
+
+		// A revision saved before definitions were validated is not promoted
+		repo.mu.Lock()
+		repo.versions[wf.ID] = append(repo.versions[wf.ID], WorkflowVersion{
+			WorkflowID: wf.ID,
+			Version:    5,
+			Name:       "Test Workflow",
+			Definition: WorkflowGraph{Nodes: []Node{{ID: "end", Type: "end"}}},
+		})
+		repo.mu.Unlock()
+		if rec := doRequest(router, "POST", base+"/versions/5/rollback", ""); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for an invalid version, got %d", rec.Code)
+		}
+		if current, _ := repo.GetWorkflow(context.Background(), wf.ID); current.Version != 4 {
+			t.Errorf("Expected revision 4 to stay current, got %d", current.Version)
+		}
+	})
+}
+
+// A repository that cannot save workflows
+type failingSaveRepository struct {
+	*MockRepository
+}
+
+func (r failingSaveRepository) SaveWorkflow(ctx context.Context, wf *Workflow) error {
+	return errors.New("database unavailable")
+}
+
+func TestService_ExecuteFailsWhenDefinitionNotSaved(t *testing.T) {
+	wf := testWorkflow()
+	executor := &MockExecutor{response: &ExecutionResponse{Status: "completed"}}
+	repo := NewMockRepository(wf)
+	router := newTestRouter(NewServiceWithDependencies(failingSaveRepository{repo}, executor))
+
+	definition, _ := json.Marshal(wf.Definition)
+	rec := doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute", `{"workflowDefinition": `+string(definition)+`}`)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if executor.inputs != nil {
+		t.Error("Expected the workflow not to be executed")
+	}
+}
+
+func TestService_ValidateWorkflow(t *testing.T) {
+	wf := testWorkflow()
+	executor := &MockExecutor{response: &ExecutionResponse{Status: "completed"}}
+	router := newTestRouter(NewServiceWithDependencies(NewMockRepository(wf), executor))
+
+	rec := doRequest(router, "POST", "/api/v1/workflows/validate",
+		`{"nodes": [{"id": "start", "type": "start"}], "edges": [{"id": "e1", "source": "start", "target": "gone"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	var result ValidationResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if result.Valid || len(result.Diagnostics) == 0 {
+		t.Errorf("Expected diagnostics for an invalid graph, got %+v", result)
+	}
+
+	// Executing with an invalid definition is rejected before anything runs or is saved
+	rec = doRequest(router, "POST", "/api/v1/workflows/"+wf.ID+"/execute",
+		`{"workflowDefinition": {"nodes": [{"id": "end", "type": "end"}], "edges": []}}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rec.Code)
+	}
+	if executor.inputs != nil {
+		t.Error("Expected the workflow not to be executed")
+	}
+}